@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/coder/acp-go-sdk"
+	"github.com/openai/openai-go/v2"
+	"github.com/pterm/pterm"
+
+	"open-coder/engine"
+)
+
+// acpAgent speaks the Agent Client Protocol with an editor over stdio. Each
+// editor session is a session of the agent; its turns are streamed to the
+// editor as session updates, tools that change something need the editor's
+// permission, and files are read and written through the editor when it
+// offers to.
+type acpAgent struct {
+	pool *agentPool
+	conn *acp.AgentSideConnection
+	fs   acp.FileSystemCapability // What the editor does with files for us
+
+	mu       sync.Mutex
+	sessions map[acp.SessionId]*acpSession
+}
+
+// acpSession is an editor session
+type acpSession struct {
+	id    acp.SessionId
+	agent *SimpleAgent
+	cwd   string
+
+	mu    sync.Mutex // One prompt turn at a time
+	asked int        // Questions asked so far, for IDs
+}
+
+var (
+	_ acp.Agent       = (*acpAgent)(nil)
+	_ acp.AgentLoader = (*acpAgent)(nil)
+)
+
+// acpToolKinds tells the editor what the known tools do, so it can show them
+// fittingly. Other tools count as reads when read-only.
+var acpToolKinds = map[string]acp.ToolKind{
+	"read_file":            acp.ToolKindRead,
+	"read_line_range":      acp.ToolKindRead,
+	"read_image":           acp.ToolKindRead,
+	"list_directory":       acp.ToolKindRead,
+	"repo_map":             acp.ToolKindRead,
+	"search_files":         acp.ToolKindSearch,
+	"search_content":       acp.ToolKindSearch,
+	"write_file":           acp.ToolKindEdit,
+	"edit_line_range":      acp.ToolKindEdit,
+	"delete_file":          acp.ToolKindDelete,
+	"run_command":          acp.ToolKindExecute,
+	"run_command_with_env": acp.ToolKindExecute,
+	"run_command_in_dir":   acp.ToolKindExecute,
+	"delegate_task":        acp.ToolKindThink,
+	"todo_write":           acp.ToolKindThink,
+	"todo_read":            acp.ToolKindThink,
+	"scratchpad":           acp.ToolKindThink,
+}
+
+// acpPermissionOptions offer engine.PermissionOptions to the editor
+var acpPermissionOptions = []acp.PermissionOption{
+	{OptionId: "allow", Name: engine.PermissionOptions[engine.PermitOnce], Kind: acp.PermissionOptionKindAllowOnce},
+	{OptionId: "always", Name: engine.PermissionOptions[engine.PermitAlways], Kind: acp.PermissionOptionKindAllowAlways},
+	{OptionId: "reject", Name: engine.PermissionOptions[engine.PermitReject], Kind: acp.PermissionOptionKindRejectOnce},
+}
+
+// runACP runs `open-coder acp` until the editor disconnects
+func runACP(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("acp", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Standard output carries the protocol, so everything else that would be
+	// printed goes to standard error
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	pterm.SetDefaultOutput(os.Stderr)
+
+	pool, err := newAgentPool(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.close()
+
+	agent := &acpAgent{pool: pool, sessions: make(map[acp.SessionId]*acpSession)}
+	agent.conn = acp.NewAgentSideConnection(agent, out, os.Stdin)
+	select {
+	case <-agent.conn.Done():
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func (a *acpAgent) Initialize(ctx context.Context, params acp.InitializeRequest) (acp.InitializeResponse, error) {
+	a.mu.Lock()
+	a.fs = params.ClientCapabilities.Fs
+	a.mu.Unlock()
+
+	return acp.InitializeResponse{
+		ProtocolVersion: acp.ProtocolVersionNumber,
+		AgentCapabilities: acp.AgentCapabilities{
+			LoadSession:        true,
+			PromptCapabilities: acp.PromptCapabilities{EmbeddedContext: true},
+		},
+		AgentInfo:   &acp.Implementation{Name: "open-coder", Version: "1.0.0"},
+		AuthMethods: []acp.AuthMethod{},
+	}, nil
+}
+
+func (a *acpAgent) Authenticate(ctx context.Context, params acp.AuthenticateRequest) (acp.AuthenticateResponse, error) {
+	return acp.AuthenticateResponse{}, nil
+}
+
+func (a *acpAgent) NewSession(ctx context.Context, params acp.NewSessionRequest) (acp.NewSessionResponse, error) {
+	session, err := a.open(params.Cwd, nil)
+	if err != nil {
+		return acp.NewSessionResponse{}, err
+	}
+	return acp.NewSessionResponse{SessionId: session.id}, nil
+}
+
+func (a *acpAgent) LoadSession(ctx context.Context, params acp.LoadSessionRequest) (acp.LoadSessionResponse, error) {
+	saved, err := loadSession(string(params.SessionId))
+	if err != nil {
+		return acp.LoadSessionResponse{}, err
+	}
+	session, err := a.open(params.Cwd, saved)
+	if err != nil {
+		return acp.LoadSessionResponse{}, err
+	}
+
+	// The editor shows the conversation again from these updates
+	for _, message := range session.agent.engine.Messages {
+		switch {
+		case message.OfUser != nil:
+			if text := userMessageText(message.OfUser); text != "" {
+				session.update(ctx, a.conn, acp.UpdateUserMessageText(text))
+			}
+		case message.OfAssistant != nil:
+			if text := message.OfAssistant.Content.OfString.Value; text != "" {
+				session.update(ctx, a.conn, acp.UpdateAgentMessageText(text))
+			}
+			for _, call := range message.OfAssistant.ToolCalls {
+				if fn := call.OfFunction; fn != nil {
+					args, _ := session.agent.parseToolArguments(fn.Function.Name, fn.Function.Arguments)
+					session.update(ctx, a.conn, session.startToolCall(fn.ID, fn.Function.Name, args, acp.ToolCallStatusCompleted))
+				}
+			}
+		}
+	}
+	return acp.LoadSessionResponse{}, nil
+}
+
+func (a *acpAgent) SetSessionMode(ctx context.Context, params acp.SetSessionModeRequest) (acp.SetSessionModeResponse, error) {
+	return acp.SetSessionModeResponse{}, nil
+}
+
+// Cancel needs nothing more: the connection cancels the prompt's context
+func (a *acpAgent) Cancel(ctx context.Context, params acp.CancelNotification) error {
+	return nil
+}
+
+func (a *acpAgent) Prompt(ctx context.Context, params acp.PromptRequest) (acp.PromptResponse, error) {
+	a.mu.Lock()
+	session := a.sessions[params.SessionId]
+	a.mu.Unlock()
+	if session == nil {
+		return acp.PromptResponse{}, fmt.Errorf("session %s not found", params.SessionId)
+	}
+
+	// The turn holds the pool only while it resolves paths against the
+	// working directory, so other sessions go on while it waits on the model
+	// or the editor
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	var turnErr error
+	for ev := range session.agent.Run(ctx, promptText(params.Prompt, session.cwd)) {
+		if q, ok := ev.(engine.Question); ok {
+			q.Answer(session.ask(ctx, a.conn, q))
+			continue
+		}
+		if err, ok := ev.(engine.Error); ok {
+			turnErr = err.Err
+			continue
+		}
+		if update, ok := session.translate(ev); ok {
+			session.update(ctx, a.conn, update)
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		return acp.PromptResponse{StopReason: acp.StopReasonCancelled}, nil
+	case turnErr != nil:
+		return acp.PromptResponse{}, turnErr
+	}
+	return acp.PromptResponse{StopReason: acp.StopReasonEndTurn}, nil
+}
+
+// open starts a session in cwd, continuing saved when it is not nil
+func (a *acpAgent) open(cwd string, saved *sessionFile) (*acpSession, error) {
+	base, err := a.pool.enter(cwd)
+	if err != nil {
+		return nil, err
+	}
+	agent := base.newSession()
+	if saved != nil {
+		agent.restoreSession(saved)
+	}
+	a.pool.leave()
+
+	session := &acpSession{id: acp.SessionId(agent.sessionID), agent: agent, cwd: filepath.Clean(cwd)}
+	agent.engine.ConfirmTools = true
+	agent.inDir = func(fn func()) { a.pool.in(session.cwd, fn) }
+	a.mu.Lock()
+	fs := &editorFS{conn: a.conn, sessionID: session.id, cwd: session.cwd}
+	for _, tool := range fs.tools(a.fs) {
+		agent.RegisterTool(tool)
+	}
+	a.mu.Unlock()
+	if err := agent.RefreshTools(); err != nil {
+		return nil, fmt.Errorf("failed to load tools: %w", err)
+	}
+
+	a.mu.Lock()
+	a.sessions[session.id] = session
+	a.mu.Unlock()
+	return session, nil
+}
+
+// update sends a session update; one the editor misses is not worth failing
+// the turn over
+func (s *acpSession) update(ctx context.Context, conn *acp.AgentSideConnection, update acp.SessionUpdate) {
+	_ = conn.SessionUpdate(ctx, acp.SessionNotification{SessionId: s.id, Update: update})
+}
+
+// translate converts a turn event to a session update, if the editor shows it
+func (s *acpSession) translate(ev engine.Event) (acp.SessionUpdate, bool) {
+	switch ev := ev.(type) {
+	case engine.TextDelta:
+		return acp.UpdateAgentMessageText(ev.Text), true
+	case engine.Notice:
+		return acp.UpdateAgentThoughtText(ev.Text + "\n"), true
+	case engine.ToolCallStarted:
+		return s.startToolCall(ev.ID, ev.Name, ev.Args, acp.ToolCallStatusPending), true
+	case engine.ToolCallInvalid:
+		return acp.StartToolCall(acp.ToolCallId(ev.ID), ev.Name,
+			acp.WithStartKind(s.toolKind(ev.Name)),
+			acp.WithStartStatus(acp.ToolCallStatusFailed),
+			acp.WithStartContent([]acp.ToolCallContent{acp.ToolContent(acp.TextBlock(ev.Err.Error()))}),
+		), true
+	case engine.ToolCallRunning:
+		return acp.UpdateToolCall(acp.ToolCallId(ev.ID), acp.WithUpdateStatus(acp.ToolCallStatusInProgress)), true
+	case engine.ToolCallResult:
+		status, output := acp.ToolCallStatusCompleted, ev.Result
+		if ev.Err != nil {
+			status, output = acp.ToolCallStatusFailed, ev.Err.Error()
+		}
+		return acp.UpdateToolCall(acp.ToolCallId(ev.ID),
+			acp.WithUpdateStatus(status),
+			acp.WithUpdateContent([]acp.ToolCallContent{acp.ToolContent(acp.TextBlock(output))}),
+		), true
+	case engine.TodosChanged:
+		entries := make([]acp.PlanEntry, len(ev.Items))
+		for i, item := range ev.Items {
+			entries[i] = acp.PlanEntry{
+				Content:  item.Content,
+				Priority: acp.PlanEntryPriorityMedium,
+				Status:   acp.PlanEntryStatus(item.Status),
+			}
+		}
+		return acp.UpdatePlan(entries...), true
+	}
+	return acp.SessionUpdate{}, false
+}
+
+// startToolCall announces a tool call with the files it touches
+func (s *acpSession) startToolCall(id, name string, args map[string]any, status acp.ToolCallStatus) acp.SessionUpdate {
+	opts := []acp.ToolCallStartOpt{
+		acp.WithStartKind(s.toolKind(name)),
+		acp.WithStartStatus(status),
+		acp.WithStartRawInput(args),
+	}
+	if locations := s.toolLocations(args); len(locations) > 0 {
+		opts = append(opts, acp.WithStartLocations(locations))
+	}
+	return acp.StartToolCall(acp.ToolCallId(id), engine.ToolCallLabel(name, args), opts...)
+}
+
+// toolKind returns what a tool does, for the editor
+func (s *acpSession) toolKind(name string) acp.ToolKind {
+	if kind, ok := acpToolKinds[name]; ok {
+		return kind
+	}
+	if s.agent.readOnlyTools[name] {
+		return acp.ToolKindRead
+	}
+	return acp.ToolKindOther
+}
+
+// toolLocations returns the file a tool call works on, and the line when it
+// names one, so the editor can follow along
+func (s *acpSession) toolLocations(args map[string]any) []acp.ToolCallLocation {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.cwd, path)
+	}
+	location := acp.ToolCallLocation{Path: path}
+	for _, key := range []string{"start_line", "offset"} {
+		if line := intArg(args, key, 0); line > 0 {
+			location.Line = acp.Ptr(line)
+			break
+		}
+	}
+	return []acp.ToolCallLocation{location}
+}
+
+// ask puts a question to the editor as a permission request. The protocol
+// has no free-text answers, so a question without options goes unanswered
+// and the agent falls back as when nobody can answer.
+func (s *acpSession) ask(ctx context.Context, conn *acp.AgentSideConnection, q engine.Question) engine.Reply {
+	if len(q.Options) == 0 {
+		return engine.Reply{Choice: -1, Err: engine.ErrNoUser}
+	}
+
+	request := acp.RequestPermissionRequest{SessionId: s.id}
+	if q.ToolCallID != "" {
+		request.ToolCall = acp.RequestPermissionToolCall{ToolCallId: acp.ToolCallId(q.ToolCallID)}
+		request.Options = acpPermissionOptions
+	} else {
+		// Any other question becomes a request of its own
+		s.asked++
+		request.ToolCall = acp.RequestPermissionToolCall{
+			ToolCallId: acp.ToolCallId(fmt.Sprintf("question-%d", s.asked)),
+			Title:      acp.Ptr(q.Prompt),
+			Kind:       acp.Ptr(acp.ToolKindOther),
+		}
+		for i, option := range q.Options {
+			request.Options = append(request.Options, acp.PermissionOption{
+				OptionId: acp.PermissionOptionId(fmt.Sprint(i)),
+				Name:     option,
+				Kind:     acp.PermissionOptionKindAllowOnce,
+			})
+		}
+	}
+
+	resp, err := conn.RequestPermission(ctx, request)
+	if err != nil {
+		return engine.Reply{Choice: -1, Err: err}
+	}
+	selected := resp.Outcome.Selected
+	if selected == nil {
+		return engine.Reply{Choice: -1, Err: errors.New("the permission request was cancelled")}
+	}
+	for i, option := range request.Options {
+		if option.OptionId == selected.OptionId {
+			return engine.Reply{Choice: i, Text: q.Options[i]}
+		}
+	}
+	return engine.Reply{Choice: -1, Err: fmt.Errorf("unknown option %q", selected.OptionId)}
+}
+
+// promptText turns the editor's prompt into input for the agent. Linked
+// files become @ mentions, so they are attached as in the terminal, and
+// embedded ones are included as they are.
+func promptText(blocks []acp.ContentBlock, cwd string) string {
+	var parts []string
+	for _, block := range blocks {
+		switch {
+		case block.Text != nil:
+			parts = append(parts, block.Text.Text)
+		case block.ResourceLink != nil:
+			path := strings.TrimPrefix(block.ResourceLink.Uri, "file://")
+			if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+			parts = append(parts, "@"+path)
+		case block.Resource != nil && block.Resource.Resource.TextResourceContents != nil:
+			res := block.Resource.Resource.TextResourceContents
+			parts = append(parts, fmt.Sprintf("%s:\n```\n%s\n```", res.Uri, res.Text))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// userMessageText returns what the user wrote in a message, without the
+// files it mentions
+func userMessageText(m *openai.ChatCompletionUserMessageParam) string {
+	text := m.Content.OfString.Value
+	for _, part := range m.Content.OfArrayOfContentParts {
+		if part.OfText != nil {
+			text = part.OfText.Text
+			break
+		}
+	}
+	text, _, _ = strings.Cut(text, mentionContentsHeading)
+	return text
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// agentPool keeps an agent for each working directory that programs driving
+// open-coder ask it to work in. The MCP servers resolve paths against the
+// directory they were started in, so each directory gets its own
+// connections, kept for later work there. The process has one working
+// directory, so work holds the pool from enter until leave, or for the
+// length of in.
+type agentPool struct {
+	ctx  context.Context
+	home string // Directory open-coder was started in
+
+	mu     sync.Mutex
+	agents map[string]*SimpleAgent // Agents by directory
+}
+
+// newAgentPool starts the pool with an agent for the current directory, so
+// configuration problems show up at start-up
+func newAgentPool(ctx context.Context) (*agentPool, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	agent, _, err := startHeadlessAgent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &agentPool{ctx: ctx, home: wd, agents: map[string]*SimpleAgent{wd: agent}}, nil
+}
+
+// enter makes dir, or the start-up directory when it is empty, the working
+// directory and returns its agent, connecting one on first use. Unless it
+// fails, it must be followed by leave.
+func (p *agentPool) enter(dir string) (*SimpleAgent, error) {
+	if dir == "" {
+		dir = p.home
+	}
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("cwd must be an absolute path, got %q", dir)
+	}
+	dir = filepath.Clean(dir)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("cwd %q is not a directory", dir)
+	}
+
+	p.mu.Lock()
+	if err := os.Chdir(dir); err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	if agent, ok := p.agents[dir]; ok {
+		return agent, nil
+	}
+	agent, _, err := startHeadlessAgent(p.ctx)
+	if err != nil {
+		p.leave()
+		return nil, err
+	}
+	p.agents[dir] = agent
+	return agent, nil
+}
+
+// leave returns to the start-up directory and lets other work enter
+func (p *agentPool) leave() {
+	_ = os.Chdir(p.home)
+	p.mu.Unlock()
+}
+
+// in runs fn with dir as the working directory, holding the pool meanwhile.
+// It is for the steps of longer work that resolve paths against the working
+// directory, so the work need not hold the pool throughout.
+func (p *agentPool) in(dir string, fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := os.Chdir(dir); err == nil {
+		defer func() { _ = os.Chdir(p.home) }()
+	}
+	fn()
+}
+
+// close disconnects every agent's MCP servers
+func (p *agentPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, agent := range p.agents {
+		agent.Close()
+	}
+}
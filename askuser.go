@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"open-coder/engine"
+)
+
+// defaultAskUserFallback answers ask_user when nobody is at the terminal and
+// the config sets no fallback
+const defaultAskUserFallback = "No user is available to answer. Decide yourself, pick the safest reasonable option and state your assumption."
+
+// otherAnswer is the menu entry for typing a free-form answer
+const otherAnswer = "✏️  Something else (type an answer)"
+
+// interactiveTool is implemented by tools that talk to the user. They run
+// one at a time before the other calls of a response, while no spinners are
+// drawn, so the question and the answer are not overwritten.
+type interactiveTool interface {
+	Interactive() bool
+}
+
+// askUserTool lets the model ask the user a question in the middle of a turn
+// and continue with the answer, instead of ending the turn to ask
+type askUserTool struct {
+	mu sync.Mutex // one question at a time
+}
+
+func (t *askUserTool) Name() string { return "ask_user" }
+
+func (t *askUserTool) Description() string {
+	return "Ask the user a question and wait for the answer. Use it when a decision is needed that you cannot make from the code, " +
+		"e.g. choosing between approaches; offer options when the possible answers are known"
+}
+
+func (t *askUserTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"question": map[string]any{
+				"type":        "string",
+				"description": "The question to ask",
+			},
+			"options": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Possible answers to choose from (optional); the user can still type a different one",
+			},
+		},
+		"required": []any{"question"},
+	}
+}
+
+func (t *askUserTool) ReadOnly() bool { return true }
+
+func (t *askUserTool) Interactive() bool { return true }
+
+func (t *askUserTool) Call(a *SimpleAgent, args map[string]any) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	question, _ := args["question"].(string)
+	var options []string
+	if list, ok := args["options"].([]any); ok {
+		for _, o := range list {
+			if s, ok := o.(string); ok && strings.TrimSpace(s) != "" {
+				options = append(options, strings.TrimSpace(s))
+			}
+		}
+	}
+
+	reply := a.ask(engine.Question{Prompt: "❓ " + question, Options: options, AllowText: true})
+	if errors.Is(reply.Err, engine.ErrNoUser) {
+		// Nobody can answer; use the configured fallback
+		fallback := a.askUserFallback
+		if fallback == "" {
+			fallback = defaultAskUserFallback
+		}
+		a.notify(engine.NoticeInfo, "❓ %s\n   (no terminal; answering: %s)", question, fallback)
+		return fallback, nil
+	}
+	if reply.Err != nil {
+		return "", reply.Err
+	}
+	if reply.Choice >= 0 {
+		return "The user chose: " + reply.Text, nil
+	}
+	answer := strings.TrimSpace(reply.Text)
+	if answer == "" {
+		return "The user gave no answer; decide yourself and state your assumption.", nil
+	}
+	return "The user answered: " + answer, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openai/openai-go/v2"
+
+	"open-coder/engine"
+	"open-coder/internal/fsutil"
+)
+
+// clipboardToken attaches the image on the clipboard
+const clipboardToken = "@clipboard"
+
+// attachmentToken matches an @ mention at the start of the input or after whitespace
+var attachmentToken = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// imageAttachment is an image sent to the model with a message
+type imageAttachment struct {
+	name     string
+	mimeType string
+	data     []byte
+}
+
+// contentPart turns the image into a content part of a user message
+func (img imageAttachment) contentPart() openai.ChatCompletionContentPartUnionParam {
+	return openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+		URL: fsutil.ImageDataURL(img.mimeType, img.data),
+	})
+}
+
+// toolResult is the result of a tool that returned images next to its text.
+// Tool messages can only carry text, so the images follow in a user message.
+type toolResult struct {
+	text   string
+	images []imageAttachment
+}
+
+func (r toolResult) String() string { return r.text }
+
+// Images returns the images as content parts, making toolResult an
+// engine.ImageResult
+func (r toolResult) Images() []openai.ChatCompletionContentPartUnionParam {
+	parts := make([]openai.ChatCompletionContentPartUnionParam, len(r.images))
+	for i, img := range r.images {
+		parts[i] = img.contentPart()
+	}
+	return parts
+}
+
+// mcpToolResult converts an MCP tool result into the value CallTool returns
+func mcpToolResult(toolName string, res *mcp.CallToolResult) interface{} {
+	text := toolResultText(res)
+	var images []imageAttachment
+	for _, content := range res.Content {
+		if image, ok := content.(*mcp.ImageContent); ok && len(image.Data) > 0 {
+			images = append(images, imageAttachment{
+				name:     fmt.Sprintf("%s result %d", toolName, len(images)+1),
+				mimeType: image.MIMEType,
+				data:     image.Data,
+			})
+		}
+	}
+	if text == "" {
+		text = "Tool executed successfully"
+		if len(images) > 0 {
+			text = fmt.Sprintf("Returned %d image(s), attached below", len(images))
+		}
+	}
+	if len(images) == 0 {
+		return text
+	}
+	return toolResult{text: text, images: images}
+}
+
+// mentionContentsHeading separates a message from the files it mentions
+const mentionContentsHeading = "\n\nContents of the files mentioned above:\n\n"
+
+// buildUserMessage turns user input into a message with what its @ mentions
+// refer to: images from @image.png and @clipboard, and the contents of
+// mentioned files, line ranges and directories as labeled context blocks
+func (a *SimpleAgent) buildUserMessage(input string) (openai.ChatCompletionMessageParamUnion, error) {
+	var images []imageAttachment
+	var mentions mentionContext
+	var attachErr error
+	text := attachmentToken.ReplaceAllStringFunc(input, func(match string) string {
+		if attachErr != nil {
+			return match
+		}
+		lead := match[:len(match)-len(strings.TrimLeft(match, " \t\r\n"))]
+		token := strings.TrimRight(strings.TrimSpace(match), ".,;:!?)")
+		trailing := strings.TrimPrefix(strings.TrimSpace(match), token)
+
+		var img imageAttachment
+		switch {
+		case token == clipboardToken:
+			data, mimeType, err := readClipboardImage()
+			if err != nil {
+				attachErr = fmt.Errorf("clipboard: %w", err)
+				return match
+			}
+			img = imageAttachment{name: "clipboard", mimeType: mimeType, data: data}
+		default:
+			m, ok := a.resolveMention(&mentions, token[1:])
+			if !ok {
+				return match // not a path; leave the mention as typed
+			}
+			if m.start == 0 && fsutil.IsImagePath(m.path) {
+				data, mimeType, err := fsutil.ReadImage(m.path)
+				if err != nil {
+					attachErr = err
+					return match
+				}
+				img = imageAttachment{name: m.path, mimeType: mimeType, data: data}
+				break
+			}
+			summary, err := mentions.attach(m)
+			if err != nil {
+				a.notify(engine.NoticeError, "⚠️  Not attaching @%s: %v", m.label(), err)
+				return match
+			}
+			if summary != "" {
+				a.notify(engine.NoticeInfo, "📎 Attached %s", summary)
+			}
+			return lead + "@" + m.label() + trailing
+		}
+
+		images = append(images, img)
+		a.notify(engine.NoticeInfo, "🖼️  Attached image %s (%s, %d KB)", img.name, img.mimeType, (len(img.data)+1023)/1024)
+		return fmt.Sprintf("%s[image %d: %s]%s", lead, len(images), img.name, trailing)
+	})
+	if attachErr != nil {
+		return openai.ChatCompletionMessageParamUnion{}, fmt.Errorf("attaching image: %w", attachErr)
+	}
+	if len(mentions.blocks) > 0 {
+		text += mentionContentsHeading + mentions.String()
+	}
+	if len(images) == 0 {
+		return openai.UserMessage(text), nil
+	}
+
+	parts := []openai.ChatCompletionContentPartUnionParam{openai.TextContentPart(text)}
+	for _, img := range images {
+		parts = append(parts, img.contentPart())
+	}
+	return openai.UserMessage(parts), nil
+}
+
+// readClipboardImage reads a PNG image from the system clipboard using the
+// platform's clipboard tool
+func readClipboardImage() ([]byte, string, error) {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pngpaste", "-"}}
+	case "windows":
+		candidates = [][]string{{"powershell", "-NoProfile", "-Command",
+			"Add-Type -AssemblyName System.Windows.Forms; $img = [Windows.Forms.Clipboard]::GetImage(); " +
+				"if ($img) { $ms = New-Object IO.MemoryStream; $img.Save($ms, [Drawing.Imaging.ImageFormat]::Png); " +
+				"[Console]::OpenStandardOutput().Write($ms.ToArray(), 0, $ms.Length) }"}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, []string{"wl-paste", "--no-newline", "--type", "image/png"})
+		}
+		candidates = append(candidates, []string{"xclip", "-selection", "clipboard", "-t", "image/png", "-o"})
+	}
+
+	var tried []string
+	for _, args := range candidates {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			tried = append(tried, args[0])
+			continue
+		}
+		var out bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = &out
+		if err := cmd.Run(); err != nil || out.Len() == 0 {
+			return nil, "", fmt.Errorf("no image on the clipboard")
+		}
+		if out.Len() > fsutil.MaxImageSize {
+			return nil, "", fmt.Errorf("clipboard image is too large (%d bytes, limit %d)", out.Len(), fsutil.MaxImageSize)
+		}
+		mimeType, ok := fsutil.ImageMIMEType("clipboard.png", out.Bytes())
+		if !ok {
+			return nil, "", fmt.Errorf("clipboard does not hold a PNG, JPEG, GIF or WebP image")
+		}
+		return out.Bytes(), mimeType, nil
+	}
+	return nil, "", fmt.Errorf("no clipboard tool found (install %s)", strings.Join(tried, " or "))
+}
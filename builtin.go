@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// BuiltinTool is a tool the agent provides itself instead of an MCP server.
+// Built-in tools are offered next to the MCP tools by RefreshTools and run
+// in-process by CallTool.
+type BuiltinTool interface {
+	// Name is the tool name shown to the model; it hides MCP tools of the same name
+	Name() string
+	// Description tells the model what the tool does and when to use it
+	Description() string
+	// Parameters is the JSON schema of the arguments
+	Parameters() map[string]any
+	// ReadOnly reports whether the tool leaves files and the system unchanged,
+	// which makes it available in plan mode
+	ReadOnly() bool
+	// Call runs the tool with validated arguments
+	Call(a *SimpleAgent, args map[string]any) (string, error)
+}
+
+// RegisterTool adds a built-in tool, replacing one with the same name. Call
+// RefreshTools afterwards to offer it to the model.
+func (a *SimpleAgent) RegisterTool(tool BuiltinTool) {
+	for i, t := range a.builtins {
+		if t.Name() == tool.Name() {
+			a.builtins[i] = tool
+			return
+		}
+	}
+	a.builtins = append(a.builtins, tool)
+}
+
+// builtinTool returns the registered built-in tool with the given name
+func (a *SimpleAgent) builtinTool(name string) BuiltinTool {
+	for _, t := range a.builtins {
+		if t.Name() == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// builtinToolParam describes a built-in tool to the model
+func builtinToolParam(t BuiltinTool) openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+		Name:        t.Name(),
+		Description: openai.String(t.Description()),
+		Parameters:  openai.FunctionParameters(t.Parameters()),
+	})
+}
+
+// defaultBuiltinTools are registered on every new agent
+func defaultBuiltinTools() []BuiltinTool {
+	return []BuiltinTool{
+		&delegateTaskTool{},
+		&todoWriteTool{},
+		&todoReadTool{},
+		&scratchpadTool{},
+		&environmentTool{},
+		&askUserTool{},
+	}
+}
+
+// scratchpadTool keeps notes for the rest of the session, outside the
+// conversation, so the model can record findings and read them back later
+type scratchpadTool struct {
+	mu    sync.Mutex
+	notes []string
+}
+
+func (t *scratchpadTool) Name() string { return "scratchpad" }
+
+func (t *scratchpadTool) Description() string {
+	return "Keep working notes for this session: findings, decisions, things to check later. " +
+		"Actions: 'add' a note, 'read' all notes, 'clear' them"
+}
+
+func (t *scratchpadTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []any{"add", "read", "clear"},
+				"description": "What to do with the notes",
+			},
+			"note": map[string]any{
+				"type":        "string",
+				"description": "The note to add (for 'add')",
+			},
+		},
+		"required": []any{"action"},
+	}
+}
+
+func (t *scratchpadTool) ReadOnly() bool { return true }
+
+func (t *scratchpadTool) Call(_ *SimpleAgent, args map[string]any) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch args["action"] {
+	case "add":
+		note, _ := args["note"].(string)
+		if strings.TrimSpace(note) == "" {
+			return "", fmt.Errorf("note is required for 'add'")
+		}
+		t.notes = append(t.notes, strings.TrimSpace(note))
+		return fmt.Sprintf("Note %d saved", len(t.notes)), nil
+	case "clear":
+		t.notes = nil
+		return "Notes cleared", nil
+	default:
+		if len(t.notes) == 0 {
+			return "No notes yet", nil
+		}
+		var b strings.Builder
+		for i, note := range t.notes {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, note)
+		}
+		return b.String(), nil
+	}
+}
+
+// environmentTool reports the current time and the environment the agent runs in
+type environmentTool struct{}
+
+func (t *environmentTool) Name() string { return "environment_info" }
+
+func (t *environmentTool) Description() string {
+	return "Get the current date and time, time zone, operating system, working directory, shell and user"
+}
+
+func (t *environmentTool) Parameters() map[string]any {
+	return map[string]any{"type": "object", "properties": map[string]any{}}
+}
+
+func (t *environmentTool) ReadOnly() bool { return true }
+
+func (t *environmentTool) Call(a *SimpleAgent, _ map[string]any) (string, error) {
+	now := time.Now()
+	zone, offset := now.Zone()
+	var wd string
+	a.inWorkDir(func() { wd, _ = os.Getwd() })
+	hostname, _ := os.Hostname()
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME")
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = os.Getenv("ComSpec")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Time: %s\n", now.Format("Monday, 2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "Time zone: %s (UTC%+.1f)\n", zone, float64(offset)/3600)
+	fmt.Fprintf(&b, "OS: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Working directory: %s\n", wd)
+	fmt.Fprintf(&b, "Shell: %s\n", shell)
+	fmt.Fprintf(&b, "User: %s\n", user)
+	fmt.Fprintf(&b, "Host: %s\n", hostname)
+	return b.String(), nil
+}
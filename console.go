@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/pterm/pterm"
+
+	"open-coder/engine"
+)
+
+// console is the plain REPL front end: it prints events as they come, with
+// markdown rendering, spinners and bordered tool boxes
+type console struct {
+	agent *SimpleAgent
+
+	md       *markdownRenderer
+	wrote    bool                  // text was written in the current response
+	spinner  *pterm.SpinnerPrinter // waiting for the model
+	multi    *pterm.MultiPrinter
+	spinners map[string]*pterm.SpinnerPrinter // tool call ID -> spinner
+}
+
+func newConsole(a *SimpleAgent) *console {
+	return &console{agent: a}
+}
+
+// runTurn runs a turn for the input and prints its events, returning the
+// turn's error. Ctrl+C stops the turn instead of the program.
+func (a *SimpleAgent) runTurn(input string) error {
+	ctx, stop := signal.NotifyContext(a.ctx, os.Interrupt)
+	defer stop()
+
+	c := newConsole(a)
+	var err error
+	for ev := range a.Run(ctx, input) {
+		if failed, ok := ev.(engine.Error); ok {
+			err = failed.Err
+			continue
+		}
+		c.Handle(ev)
+	}
+	c.stopSpinner()
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		a.getSystemColorStyle().Println("\n⏹️  Turn stopped.")
+		return nil
+	}
+	return err
+}
+
+// Handle prints one event
+func (c *console) Handle(ev engine.Event) {
+	a := c.agent
+	switch ev := ev.(type) {
+	case engine.TurnStarted:
+		a.printAssistantHeader()
+
+	case engine.ResponseStarted:
+		c.md = a.newMarkdownRenderer()
+		c.wrote = false
+		c.spinner, _ = themedSpinner().
+			WithRemoveWhenDone(true).
+			WithShowTimer(false).
+			Start("")
+
+	case engine.TextDelta:
+		c.stopSpinner()
+		if c.md == nil {
+			c.md = a.newMarkdownRenderer()
+		}
+		c.md.Write(ev.Text)
+		c.wrote = true
+
+	case engine.ResponseFinished:
+		c.stopSpinner()
+		if c.md != nil {
+			c.md.Flush()
+		}
+		if ev.Err != nil && c.wrote {
+			pterm.Println()
+		}
+		c.md = nil
+
+	case engine.Notice:
+		c.stopSpinner()
+		style := a.getSystemColorStyle()
+		switch ev.Level {
+		case engine.NoticeWarning:
+			style = ui.warning
+		case engine.NoticeError:
+			style = a.getErrorColorStyle()
+		}
+		style.Println(ev.Text)
+
+	case engine.ToolCallInvalid:
+		a.getErrorColorStyle().Printf("✗ %s: %v\n", ev.Name, ev.Err)
+
+	case engine.ToolCallStarted:
+		// Compact mode only shows a summary line once the call is done
+		if !a.compactMode {
+			a.displayToolCallDetails(ev.Name, ev.Args)
+		}
+
+	case engine.ToolBatchStarted:
+		multi := pterm.DefaultMultiPrinter
+		c.multi = &multi
+		c.spinners = make(map[string]*pterm.SpinnerPrinter)
+		for i, call := range ev.Calls {
+			status := "Running"
+			if i >= ev.Limit {
+				status = "Queued"
+			}
+			c.spinners[call.ID], _ = themedSpinner().
+				WithWriter(c.multi.NewWriter()).
+				WithShowTimer(false).
+				WithRemoveWhenDone(a.compactMode). // compact mode shows a summary line instead
+				Start(a.getToolColorStyle().Sprint(fmt.Sprintf("%s %s", status, call.Label)))
+		}
+		_, _ = c.multi.Start()
+
+	case engine.ToolCallRunning:
+		if s := c.spinners[ev.ID]; s != nil {
+			s.UpdateText(a.getToolColorStyle().Sprint("Running " + ev.Label))
+		}
+
+	case engine.ToolCallDone:
+		s := c.spinners[ev.ID]
+		if s == nil {
+			return
+		}
+		elapsed := formatElapsed(ev.Duration)
+		if ev.Err != nil {
+			s.Fail(fmt.Sprintf("%s failed (%s)", ev.Label, elapsed))
+		} else {
+			s.Success(fmt.Sprintf("%s (%s)", ev.Label, elapsed))
+		}
+
+	case engine.ToolBatchFinished:
+		if c.multi != nil {
+			_, _ = c.multi.Stop()
+		}
+		c.multi, c.spinners = nil, nil
+
+	case engine.ToolCallResult:
+		if a.compactMode {
+			a.displayToolSummary(ev)
+			return
+		}
+		var result any = ev.Result
+		if ev.Err != nil {
+			a.getErrorColorStyle().Printf("Tool Error: %v\n", ev.Err)
+			result = fmt.Sprintf("Error: %v", ev.Err)
+		}
+		a.displayToolResult(ev.Name, result, ev.Err)
+
+	case engine.TodosChanged:
+		showTodoPanel(ev.Items)
+
+	case engine.TurnFinished:
+		if a.showTimestamps {
+			ui.muted.Printf("\n⏱  Turn took %s\n", formatElapsed(ev.Elapsed))
+		}
+		ui.text.Println("\n" + strings.Repeat("─", 50))
+
+	case engine.Question:
+		c.stopSpinner()
+		ev.Answer(c.ask(ev))
+	}
+}
+
+// stopSpinner removes the waiting spinner once something else is shown
+func (c *console) stopSpinner() {
+	if c.spinner != nil {
+		_ = c.spinner.Stop()
+		c.spinner = nil
+	}
+}
+
+// stdinIsTerminal reports whether standard input is an interactive terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// ask shows a question and reads the answer from the terminal: a selection
+// menu when there are options, otherwise a line of text
+func (c *console) ask(q engine.Question) engine.Reply {
+	if !stdinIsTerminal() {
+		return engine.Reply{Choice: -1, Err: engine.ErrNoUser}
+	}
+
+	pterm.Println()
+	if len(q.Options) > 0 {
+		options := q.Options
+		if q.AllowText {
+			options = append(append([]string{}, options...), otherAnswer)
+		}
+		choice, err := pterm.DefaultInteractiveSelect.
+			WithOptions(options).
+			WithMaxHeight(10).
+			Show(q.Prompt)
+		if err != nil {
+			return engine.Reply{Choice: -1, Err: err}
+		}
+		for i, option := range q.Options {
+			if option == choice {
+				return engine.Reply{Choice: i, Text: choice}
+			}
+		}
+	} else {
+		ui.accent.Println(q.Prompt)
+	}
+	ui.text.Print("Answer: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return engine.Reply{Choice: -1, Err: fmt.Errorf("reading the answer: %w", err)}
+	}
+	return engine.Reply{Choice: -1, Text: strings.TrimSpace(input)}
+}
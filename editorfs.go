@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/coder/acp-go-sdk"
+
+	"open-coder/internal/lines"
+)
+
+// editorFS reaches the files of an editor session through the editor, which
+// sees unsaved changes and keeps its buffers in step with the agent's edits.
+// Its tools replace the file-access tools of the same name.
+type editorFS struct {
+	conn      *acp.AgentSideConnection
+	sessionID acp.SessionId
+	cwd       string
+}
+
+// tools returns the file tools the editor can serve
+func (e *editorFS) tools(caps acp.FileSystemCapability) []BuiltinTool {
+	var tools []BuiltinTool
+	if caps.ReadTextFile {
+		tools = append(tools, &editorReadFileTool{e}, &editorReadLineRangeTool{e})
+	}
+	if caps.WriteTextFile {
+		tools = append(tools, &editorWriteFileTool{e})
+	}
+	if caps.ReadTextFile && caps.WriteTextFile {
+		tools = append(tools, &editorEditLineRangeTool{e})
+	}
+	return tools
+}
+
+// abs resolves path against the session's directory; the editor wants
+// absolute paths
+func (e *editorFS) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(e.cwd, path)
+}
+
+// read returns the file's text as the editor has it
+func (e *editorFS) read(a *SimpleAgent, path string) (string, error) {
+	resp, err := e.conn.ReadTextFile(a.ctx, acp.ReadTextFileRequest{SessionId: e.sessionID, Path: e.abs(path)})
+	if err != nil {
+		return "", fmt.Errorf("Failed to read file: %v", err)
+	}
+	return resp.Content, nil
+}
+
+// write replaces the file's text in the editor
+func (e *editorFS) write(a *SimpleAgent, path, content string) error {
+	_, err := e.conn.WriteTextFile(a.ctx, acp.WriteTextFileRequest{SessionId: e.sessionID, Path: e.abs(path), Content: content})
+	if err != nil {
+		return fmt.Errorf("Failed to write file: %v", err)
+	}
+	return nil
+}
+
+// intArg returns a whole-number argument, or def when it is missing
+func intArg(args map[string]any, key string, def int) int {
+	if v, ok := args[key].(float64); ok {
+		return int(v)
+	}
+	return def
+}
+
+// editorReadFileTool is read_file served by the editor
+type editorReadFileTool struct{ fs *editorFS }
+
+func (t *editorReadFileTool) Name() string { return "read_file" }
+
+func (t *editorReadFileTool) Description() string {
+	return "Read the contents of a file with optional line numbers"
+}
+
+func (t *editorReadFileTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Path to the file to read (relative to current directory)",
+			},
+			"offset": map[string]any{
+				"type":        "number",
+				"description": "Line number to start reading from (1-based, optional)",
+			},
+			"limit": map[string]any{
+				"type":        "number",
+				"description": "Number of lines to read (optional, reads entire file if not specified)",
+			},
+			"show_line_numbers": map[string]any{
+				"type":        "boolean",
+				"description": "Whether to include line numbers in the output (default: false)",
+			},
+		},
+		"required": []any{"path"},
+	}
+}
+
+func (t *editorReadFileTool) ReadOnly() bool { return true }
+
+func (t *editorReadFileTool) Call(a *SimpleAgent, args map[string]any) (string, error) {
+	path, _ := args["path"].(string)
+	text, err := t.fs.read(a, path)
+	if err != nil {
+		return "", err
+	}
+
+	offset := max(intArg(args, "offset", 1), 1)
+	end := 0 // through the last line
+	if limit := intArg(args, "limit", -1); limit > 0 {
+		end = offset + limit - 1
+	}
+	numbered, _ := args["show_line_numbers"].(bool)
+	return lines.Format(lines.Range(text, offset, end), offset, numbered), nil
+}
+
+// editorReadLineRangeTool is read_line_range served by the editor
+type editorReadLineRangeTool struct{ fs *editorFS }
+
+func (t *editorReadLineRangeTool) Name() string { return "read_line_range" }
+
+func (t *editorReadLineRangeTool) Description() string {
+	return "Read specific lines or a range of lines from a file"
+}
+
+func (t *editorReadLineRangeTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Path to the file to read (relative to current directory)",
+			},
+			"start_line": map[string]any{
+				"type":        "number",
+				"description": "Starting line number (1-based)",
+			},
+			"end_line": map[string]any{
+				"type":        "number",
+				"description": "Ending line number (1-based, optional - if not provided, reads only the start_line)",
+			},
+			"show_line_numbers": map[string]any{
+				"type":        "boolean",
+				"description": "Whether to include line numbers in the output (default: true)",
+			},
+		},
+		"required": []any{"path", "start_line"},
+	}
+}
+
+func (t *editorReadLineRangeTool) ReadOnly() bool { return true }
+
+func (t *editorReadLineRangeTool) Call(a *SimpleAgent, args map[string]any) (string, error) {
+	start := intArg(args, "start_line", 1)
+	if start < 1 {
+		return "", fmt.Errorf("start_line must be >= 1")
+	}
+	end := intArg(args, "end_line", start)
+	if end < start {
+		return "", fmt.Errorf("end_line must be >= start_line")
+	}
+
+	path, _ := args["path"].(string)
+	text, err := t.fs.read(a, path)
+	if err != nil {
+		return "", err
+	}
+	numbered := true
+	if v, ok := args["show_line_numbers"].(bool); ok {
+		numbered = v
+	}
+	return lines.Format(lines.Range(text, start, end), start, numbered), nil
+}
+
+// editorWriteFileTool is write_file served by the editor
+type editorWriteFileTool struct{ fs *editorFS }
+
+func (t *editorWriteFileTool) Name() string { return "write_file" }
+
+func (t *editorWriteFileTool) Description() string {
+	return "Write content to a file (creates or overwrites)"
+}
+
+func (t *editorWriteFileTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Path to the file to write (relative to current directory)",
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "Content to write to the file",
+			},
+		},
+		"required": []any{"path", "content"},
+	}
+}
+
+func (t *editorWriteFileTool) ReadOnly() bool { return false }
+
+func (t *editorWriteFileTool) Call(a *SimpleAgent, args map[string]any) (string, error) {
+	path, _ := args["path"].(string)
+	content, _ := args["content"].(string)
+	if err := t.fs.write(a, path, content); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Successfully wrote %d bytes to %s", len(content), path), nil
+}
+
+// editorEditLineRangeTool is edit_line_range served by the editor
+type editorEditLineRangeTool struct{ fs *editorFS }
+
+func (t *editorEditLineRangeTool) Name() string { return "edit_line_range" }
+
+func (t *editorEditLineRangeTool) Description() string {
+	return "Edit specific lines or a range of lines in a file"
+}
+
+func (t *editorEditLineRangeTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Path to the file to edit (relative to current directory)",
+			},
+			"start_line": map[string]any{
+				"type":        "number",
+				"description": "Starting line number to edit (1-based)",
+			},
+			"end_line": map[string]any{
+				"type":        "number",
+				"description": "Ending line number to edit (1-based, optional - if not provided, edits only the start_line)",
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "New content to replace the specified lines (use \\n for line breaks)",
+			},
+			"operation": map[string]any{
+				"type":        "string",
+				"description": "Operation type: 'replace' (default), 'insert_before', or 'insert_after'",
+			},
+		},
+		"required": []any{"path", "start_line", "content"},
+	}
+}
+
+func (t *editorEditLineRangeTool) ReadOnly() bool { return false }
+
+func (t *editorEditLineRangeTool) Call(a *SimpleAgent, args map[string]any) (string, error) {
+	start := intArg(args, "start_line", 1)
+	if start < 1 {
+		return "", fmt.Errorf("start_line must be >= 1")
+	}
+	end := intArg(args, "end_line", start)
+	if end < start {
+		return "", fmt.Errorf("end_line must be >= start_line")
+	}
+	operation, _ := args["operation"].(string)
+	if operation == "" {
+		operation = lines.Replace
+	}
+
+	path, _ := args["path"].(string)
+	content, _ := args["content"].(string)
+	text, err := t.fs.read(a, path)
+	if err != nil {
+		return "", err
+	}
+	edited, err := lines.Edit(text, start, end, content, operation)
+	if err != nil {
+		return "", err
+	}
+	if err := t.fs.write(a, path, edited); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Successfully edited lines %d-%d in %s using operation '%s'", start, end, path, operation), nil
+}
@@ -0,0 +1,59 @@
+// Package engine runs the turns of a conversation with a model: an Engine
+// streams each response, retrying and falling back to other providers, runs
+// the tool calls it asks for and stops runaway turns at their limits. A turn
+// reports what it does as a stream of events (streamed text, tool calls and
+// their results, token usage, notices and questions for the user) instead of
+// printing, so the same turns can be shown by a terminal REPL, a full-screen
+// TUI or a remote client.
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+// eventBuffer is how many events a turn may get ahead of its consumer
+const eventBuffer = 64
+
+// ErrNoUser is the reply to a question when nobody can answer it, e.g.
+// without a terminal; the turn then goes on with a default
+var ErrNoUser = errors.New("no user to ask")
+
+// Agent runs the turns of a conversation
+type Agent interface {
+	// Run starts a turn for the user's input and returns its events. The
+	// channel is closed when the turn is over; a turn that failed ends with
+	// an Error event. Cancelling ctx stops the turn.
+	Run(ctx context.Context, input string) <-chan Event
+}
+
+// TurnFunc runs one turn, reporting what happens through emit
+type TurnFunc func(ctx context.Context, input string, emit func(Event)) error
+
+// Stream runs turn in the background and returns its events, closing the
+// channel once the turn returns. The consumer must read until the channel is
+// closed, also after cancelling ctx, or the turn blocks.
+func Stream(ctx context.Context, input string, turn TurnFunc) <-chan Event {
+	events := make(chan Event, eventBuffer)
+	go func() {
+		defer close(events)
+		emit := func(ev Event) { events <- ev }
+		if err := turn(ctx, input, emit); err != nil {
+			emit(Error{Err: err})
+		}
+	}()
+	return events
+}
+
+// Ask sends a question through emit and waits for the answer, or until ctx
+// is done
+func Ask(ctx context.Context, emit func(Event), q Question) Reply {
+	q.reply = make(chan Reply, 1)
+	emit(q)
+	select {
+	case r := <-q.reply:
+		return r
+	case <-ctx.Done():
+		return Reply{Choice: -1, Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,186 @@
+package engine
+
+import "time"
+
+// Event is something that happens during a turn
+type Event interface {
+	isEvent()
+}
+
+// TurnStarted begins a turn for the user's input
+type TurnStarted struct {
+	Input string
+}
+
+// TurnFinished ends a turn that ran to completion or was stopped at a limit
+type TurnFinished struct {
+	Elapsed time.Duration
+}
+
+// ResponseStarted is sent when a request is made to the model
+type ResponseStarted struct{}
+
+// TextDelta is a piece of the assistant's answer as it streams in
+type TextDelta struct {
+	Text string
+}
+
+// ResponseFinished ends a model response; Err is set when the stream failed
+// part way, and the response may be retried
+type ResponseFinished struct {
+	Err error
+}
+
+// Error ends a turn that failed
+type Error struct {
+	Err error
+}
+
+// Usage reports the tokens used by one model request
+type Usage struct {
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+}
+
+// NoticeLevel is how prominent a notice is
+type NoticeLevel int
+
+const (
+	NoticeInfo NoticeLevel = iota
+	NoticeWarning
+	NoticeError
+)
+
+// Notice is a status message, such as a retry or an attached file
+type Notice struct {
+	Level NoticeLevel
+	Text  string
+}
+
+// ToolCallStarted announces a tool call whose arguments are valid, before it
+// runs. Args is shared with the tool and later events, so consumers must not
+// change it.
+type ToolCallStarted struct {
+	ID   string
+	Name string
+	Args map[string]any
+}
+
+// ToolCallInvalid reports a tool call whose arguments failed validation; it is not run
+type ToolCallInvalid struct {
+	ID   string
+	Name string
+	Err  error
+}
+
+// ToolBatchStarted is sent before tool calls run concurrently; calls after
+// the first Limit wait for a free slot
+type ToolBatchStarted struct {
+	Calls []ToolCallRef
+	Limit int
+}
+
+// ToolCallRef identifies a tool call in batch events
+type ToolCallRef struct {
+	ID    string
+	Label string
+}
+
+// ToolCallRunning is sent when a tool call starts running
+type ToolCallRunning struct {
+	ID    string
+	Label string
+}
+
+// ToolCallDone is sent as soon as a tool call returns
+type ToolCallDone struct {
+	ID       string
+	Label    string
+	Err      error
+	Duration time.Duration
+}
+
+// ToolBatchFinished is sent once every call of a batch has returned
+type ToolBatchFinished struct{}
+
+// ToolCallResult is the outcome of a tool call, reported in the order the
+// model asked for the calls
+type ToolCallResult struct {
+	ID       string
+	Name     string
+	Args     map[string]any
+	Result   string
+	Err      error
+	Duration time.Duration
+}
+
+// TodosChanged carries the todo list after the model updated it
+type TodosChanged struct {
+	Items []TodoItem
+}
+
+// TodoItem is one entry of the todo list
+type TodoItem struct {
+	Content string `json:"content"`
+	Status  string `json:"status"` // "pending", "in_progress" or "completed"
+}
+
+// Question asks the user something in the middle of a turn, such as whether
+// to go on at a limit or which of several files was meant: a choice among
+// Options, free text when AllowText is set, or both. The turn waits until
+// the front end calls Answer. A question asking permission to run a tool
+// call names it in ToolCallID and offers PermissionOptions.
+type Question struct {
+	Prompt     string
+	Options    []string
+	AllowText  bool
+	ToolCallID string
+	reply      chan Reply
+}
+
+// PermissionOptions are the Options of a tool call permission question, in
+// order: run it, run this tool without asking for the rest of the session,
+// or do not run it
+var PermissionOptions = []string{"Allow", "Always allow", "Reject"}
+
+// Choices of a permission question
+const (
+	PermitOnce = iota
+	PermitAlways
+	PermitReject
+)
+
+// Reply is the user's answer to a Question. Choice is the index of the
+// chosen option, or -1 for a typed answer.
+type Reply struct {
+	Choice int
+	Text   string
+	Err    error
+}
+
+// Answer delivers the reply to the waiting turn; only the first answer counts
+func (q Question) Answer(r Reply) {
+	select {
+	case q.reply <- r:
+	default:
+	}
+}
+
+func (TurnStarted) isEvent()       {}
+func (TurnFinished) isEvent()      {}
+func (ResponseStarted) isEvent()   {}
+func (TextDelta) isEvent()         {}
+func (ResponseFinished) isEvent()  {}
+func (Usage) isEvent()             {}
+func (Notice) isEvent()            {}
+func (ToolCallStarted) isEvent()   {}
+func (ToolCallInvalid) isEvent()   {}
+func (ToolBatchStarted) isEvent()  {}
+func (ToolCallRunning) isEvent()   {}
+func (ToolCallDone) isEvent()      {}
+func (ToolBatchFinished) isEvent() {}
+func (ToolCallResult) isEvent()    {}
+func (TodosChanged) isEvent()      {}
+func (Question) isEvent()          {}
+func (Error) isEvent()             {}
@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// imageTokenEstimate is roughly what one attached image costs, used instead
+// of the size of its data URL when the provider reports no usage
+const imageTokenEstimate = 1000
+
+// dataURLPattern matches base64 image data URLs in a serialized request
+var dataURLPattern = regexp.MustCompile(`data:image/[a-z]+;base64,[A-Za-z0-9+/=]+`)
+
+// TurnLimits bound the work done for one user message. Zero fields use the
+// defaults and negative fields disable that limit.
+type TurnLimits struct {
+	MaxIterations    int `json:"max_iterations,omitempty"`     // model requests
+	MaxToolCalls     int `json:"max_tool_calls,omitempty"`     // tool calls run
+	MaxSeconds       int `json:"max_seconds,omitempty"`        // wall-clock time
+	MaxTokens        int `json:"max_tokens,omitempty"`         // prompt and completion tokens
+	MaxRepeatedCalls int `json:"max_repeated_calls,omitempty"` // identical calls (same tool and arguments)
+}
+
+// defaultTurnLimits are generous enough for real work but stop a model that
+// is going in circles
+var defaultTurnLimits = TurnLimits{
+	MaxIterations:    25,
+	MaxToolCalls:     100,
+	MaxSeconds:       600,
+	MaxTokens:        500000,
+	MaxRepeatedCalls: 3,
+}
+
+// withDefaults fills unset limits from defaultTurnLimits
+func (l TurnLimits) withDefaults() TurnLimits {
+	pick := func(v, def int) int {
+		if v == 0 {
+			return def
+		}
+		return v
+	}
+	return TurnLimits{
+		MaxIterations:    pick(l.MaxIterations, defaultTurnLimits.MaxIterations),
+		MaxToolCalls:     pick(l.MaxToolCalls, defaultTurnLimits.MaxToolCalls),
+		MaxSeconds:       pick(l.MaxSeconds, defaultTurnLimits.MaxSeconds),
+		MaxTokens:        pick(l.MaxTokens, defaultTurnLimits.MaxTokens),
+		MaxRepeatedCalls: pick(l.MaxRepeatedCalls, defaultTurnLimits.MaxRepeatedCalls),
+	}
+}
+
+// turnGuard tracks one turn against its limits
+type turnGuard struct {
+	limits     TurnLimits
+	start      time.Time
+	iterations int
+	toolCalls  int
+	tokens     int64
+	repeats    map[string]int // tool call signature -> times called
+	repeated   string         // label of the last call that hit MaxRepeatedCalls
+}
+
+// newTurnGuard starts tracking a turn
+func newTurnGuard(limits TurnLimits) *turnGuard {
+	g := &turnGuard{limits: limits.withDefaults()}
+	g.reset()
+	return g
+}
+
+// reset starts counting afresh, giving the turn a new allowance
+func (g *turnGuard) reset() {
+	g.start = time.Now()
+	g.iterations, g.toolCalls, g.tokens = 0, 0, 0
+	g.repeats = make(map[string]int)
+	g.repeated = ""
+}
+
+// recordResponse counts a model request and the tokens it used
+func (g *turnGuard) recordResponse(tokens int64) {
+	g.iterations++
+	g.tokens += tokens
+}
+
+// recordCall counts a tool call that was run
+func (g *turnGuard) recordCall(name string, args map[string]any) {
+	g.toolCalls++
+	encoded, _ := json.Marshal(args) // map keys are sorted, so equal arguments encode equally
+	key := name + " " + string(encoded)
+	g.repeats[key]++
+	if limit := g.limits.MaxRepeatedCalls; limit > 0 && g.repeats[key] >= limit {
+		g.repeated = ToolCallLabel(name, args)
+	}
+}
+
+// limitCalls returns the calls that fit in what is left of MaxToolCalls.
+// The others get an error telling the model they were skipped.
+func (g *turnGuard) limitCalls(calls []*toolCall) []*toolCall {
+	limit := g.limits.MaxToolCalls
+	room := limit - g.toolCalls
+	if limit <= 0 || len(calls) <= room {
+		return calls
+	}
+	room = max(room, 0)
+	for _, call := range calls[room:] {
+		call.err = fmt.Errorf("skipped: this turn reached its limit of %d tool calls", limit)
+	}
+	return calls[:room]
+}
+
+// exceeded describes the first limit the turn has reached, or returns ""
+func (g *turnGuard) exceeded() string {
+	l := g.limits
+	switch {
+	case g.repeated != "":
+		return fmt.Sprintf("the same call (%s) was made %d times", g.repeated, l.MaxRepeatedCalls)
+	case l.MaxIterations > 0 && g.iterations >= l.MaxIterations:
+		return fmt.Sprintf("%d model requests", g.iterations)
+	case l.MaxToolCalls > 0 && g.toolCalls >= l.MaxToolCalls:
+		return fmt.Sprintf("%d tool calls", g.toolCalls)
+	case l.MaxSeconds > 0 && time.Since(g.start) >= time.Duration(l.MaxSeconds)*time.Second:
+		return fmt.Sprintf("%s elapsed", time.Since(g.start).Round(time.Second))
+	case l.MaxTokens > 0 && g.tokens >= int64(l.MaxTokens):
+		return fmt.Sprintf("%d tokens used", g.tokens)
+	}
+	return ""
+}
+
+// LimitAction is how a turn goes on once it reaches a limit
+type LimitAction int
+
+const (
+	LimitStop     LimitAction = iota // End the turn
+	LimitContinue                    // Keep going with a fresh allowance
+	LimitRedirect                    // Send new instructions and keep going
+	LimitWrapUp                      // Send instructions and take one last reply, without tools
+)
+
+// atLimit decides how to go on at a limit, with Config.AtLimit or else by
+// asking the user. The instructions go with LimitRedirect and LimitWrapUp.
+func (t *turn) atLimit(reason string) (LimitAction, string) {
+	if t.AtLimit != nil {
+		return t.AtLimit(reason)
+	}
+	return t.askAtLimit(reason)
+}
+
+// askAtLimit tells the user which limit was reached and asks whether to keep
+// going, stop, or give the model new instructions. Without anyone to ask,
+// the turn stops.
+func (t *turn) askAtLimit(reason string) (LimitAction, string) {
+	t.notify(NoticeWarning, "\n⏸️  Turn limit reached: %s", reason)
+	reply := t.ask(Question{
+		Prompt:  "What now?",
+		Options: []string{"Continue", "Stop", "Redirect with new instructions"},
+	})
+	if errors.Is(reply.Err, ErrNoUser) {
+		t.notify(NoticeWarning, "Stopping this turn (no terminal to ask).")
+		return LimitStop, ""
+	}
+	switch {
+	case reply.Err != nil:
+		return LimitStop, ""
+	case reply.Choice == 0:
+		return LimitContinue, ""
+	case reply.Choice == 2:
+		instructions := t.ask(Question{Prompt: "New instructions", AllowText: true})
+		text := strings.TrimSpace(instructions.Text)
+		if instructions.Err != nil || text == "" {
+			return LimitStop, ""
+		}
+		return LimitRedirect, text
+	}
+	return LimitStop, ""
+}
+
+// estimateRequestTokens approximates the tokens of a request and its answer
+// for providers that do not report usage
+func estimateRequestTokens(messages []openai.ChatCompletionMessageParamUnion, answer string) int64 {
+	size := len(answer)
+	for _, m := range messages {
+		if b, err := json.Marshal(m); err == nil {
+			size += len(b)
+			// Images cost a roughly fixed amount, not the size of their data
+			for _, url := range dataURLPattern.FindAll(b, -1) {
+				size += imageTokenEstimate*4 - len(url)
+			}
+		}
+	}
+	return int64(size+3) / 4
+}
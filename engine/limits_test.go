@@ -0,0 +1,242 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTurnLimitsWithDefaults(t *testing.T) {
+	got := TurnLimits{MaxIterations: 5, MaxToolCalls: -1}.withDefaults()
+	want := TurnLimits{
+		MaxIterations:    5,
+		MaxToolCalls:     -1,
+		MaxSeconds:       defaultTurnLimits.MaxSeconds,
+		MaxTokens:        defaultTurnLimits.MaxTokens,
+		MaxRepeatedCalls: defaultTurnLimits.MaxRepeatedCalls,
+	}
+	if got != want {
+		t.Errorf("withDefaults() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTurnGuardExceeded(t *testing.T) {
+	// Negative limits are off, so each case only trips the limit it sets
+	off := TurnLimits{MaxIterations: -1, MaxToolCalls: -1, MaxSeconds: -1, MaxTokens: -1, MaxRepeatedCalls: -1}
+	with := func(set func(*TurnLimits)) TurnLimits {
+		l := off
+		set(&l)
+		return l
+	}
+
+	tests := []struct {
+		name   string
+		limits TurnLimits
+		run    func(g *turnGuard)
+		want   string
+	}{
+		{
+			name:   "within limits",
+			limits: with(func(l *TurnLimits) { l.MaxIterations, l.MaxToolCalls = 3, 3 }),
+			run: func(g *turnGuard) {
+				g.recordResponse(10)
+				g.recordCall("read_file", map[string]any{"path": "a.go"})
+			},
+		},
+		{
+			name:   "model requests",
+			limits: with(func(l *TurnLimits) { l.MaxIterations = 2 }),
+			run: func(g *turnGuard) {
+				g.recordResponse(10)
+				g.recordResponse(10)
+			},
+			want: "2 model requests",
+		},
+		{
+			name:   "tool calls",
+			limits: with(func(l *TurnLimits) { l.MaxToolCalls = 2 }),
+			run: func(g *turnGuard) {
+				g.recordCall("read_file", map[string]any{"path": "a.go"})
+				g.recordCall("read_file", map[string]any{"path": "b.go"})
+			},
+			want: "2 tool calls",
+		},
+		{
+			name:   "tokens",
+			limits: with(func(l *TurnLimits) { l.MaxTokens = 100 }),
+			run: func(g *turnGuard) {
+				g.recordResponse(60)
+				g.recordResponse(60)
+			},
+			want: "120 tokens used",
+		},
+		{
+			name:   "time",
+			limits: with(func(l *TurnLimits) { l.MaxSeconds = 1 }),
+			run:    func(g *turnGuard) { g.start = time.Now().Add(-2 * time.Second) },
+			want:   "2s elapsed",
+		},
+		{
+			name:   "repeated call",
+			limits: with(func(l *TurnLimits) { l.MaxRepeatedCalls = 2 }),
+			run: func(g *turnGuard) {
+				g.recordCall("read_file", map[string]any{"path": "a.go", "limit": 5.0})
+				g.recordCall("read_file", map[string]any{"limit": 5.0, "path": "a.go"})
+			},
+			want: "the same call (read_file a.go) was made 2 times",
+		},
+		{
+			name:   "different arguments are not repeats",
+			limits: with(func(l *TurnLimits) { l.MaxRepeatedCalls = 2 }),
+			run: func(g *turnGuard) {
+				g.recordCall("read_file", map[string]any{"path": "a.go"})
+				g.recordCall("read_file", map[string]any{"path": "b.go"})
+				g.recordCall("write_file", map[string]any{"path": "a.go"})
+			},
+		},
+		{
+			name:   "repeated call reported first",
+			limits: with(func(l *TurnLimits) { l.MaxRepeatedCalls, l.MaxToolCalls = 2, 2 }),
+			run: func(g *turnGuard) {
+				g.recordCall("run_command", map[string]any{"command": "ls"})
+				g.recordCall("run_command", map[string]any{"command": "ls"})
+			},
+			want: "the same call (run_command ls) was made 2 times",
+		},
+		{
+			name:   "reset gives a fresh allowance",
+			limits: with(func(l *TurnLimits) { l.MaxIterations, l.MaxRepeatedCalls = 1, 1 }),
+			run: func(g *turnGuard) {
+				g.recordResponse(10)
+				g.recordCall("read_file", map[string]any{"path": "a.go"})
+				g.reset()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTurnGuard(tt.limits)
+			tt.run(g)
+			if got := g.exceeded(); got != tt.want {
+				t.Errorf("exceeded() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTurnGuardLimitCalls(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		made      int // calls already run this turn
+		calls     int
+		wantRun   int
+		wantError string
+	}{
+		{name: "room for all", limit: 5, made: 1, calls: 4, wantRun: 4},
+		{name: "partly over", limit: 5, made: 3, calls: 4, wantRun: 2, wantError: "skipped: this turn reached its limit of 5 tool calls"},
+		{name: "none left", limit: 2, made: 2, calls: 2, wantRun: 0, wantError: "skipped: this turn reached its limit of 2 tool calls"},
+		{name: "already past", limit: 2, made: 3, calls: 1, wantRun: 0, wantError: "skipped: this turn reached its limit of 2 tool calls"},
+		{name: "no limit", limit: -1, made: 50, calls: 3, wantRun: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTurnGuard(TurnLimits{MaxToolCalls: tt.limit})
+			g.toolCalls = tt.made
+			calls := make([]*toolCall, tt.calls)
+			for i := range calls {
+				calls[i] = &toolCall{name: "read_file"}
+			}
+
+			run := g.limitCalls(calls)
+			if len(run) != tt.wantRun {
+				t.Fatalf("limitCalls() ran %d calls, want %d", len(run), tt.wantRun)
+			}
+			for i, call := range calls {
+				switch {
+				case i < tt.wantRun && call.err != nil:
+					t.Errorf("call %d: unexpected error %v", i, call.err)
+				case i >= tt.wantRun && (call.err == nil || call.err.Error() != tt.wantError):
+					t.Errorf("call %d: error %v, want %q", i, call.err, tt.wantError)
+				}
+			}
+		})
+	}
+}
+
+func TestTurnStopsAfterToolRepairs(t *testing.T) {
+	model := newFakeModel(t, func(fakeRequest) fakeResponse {
+		return fakeResponse{toolCall: "read_file", arguments: `{"path": 7}`}
+	})
+	e := New(Config{
+		Providers:      []Provider{model.provider("primary")},
+		Tools:          rejectingTools{},
+		MaxToolRepairs: 2,
+	}, "system")
+
+	var events eventLog
+	err := e.Turn(context.Background(), "read it", events.add)
+	if err == nil || !strings.Contains(err.Error(), "failed validation 3 times") {
+		t.Fatalf("Turn() error = %v, want the repair cap", err)
+	}
+	if got := model.requests(); len(got) != 3 {
+		t.Errorf("made %d requests, want 3", len(got))
+	}
+	if got := events.count(func(ev Event) bool { _, ok := ev.(ToolCallInvalid); return ok }); got != 3 {
+		t.Errorf("reported %d invalid calls, want 3", got)
+	}
+}
+
+func TestTurnAtLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       LimitAction
+		wantRequests int
+		wantReply    string
+	}{
+		{name: "stop", action: LimitStop, wantRequests: 2},
+		{name: "wrap up", action: LimitWrapUp, wantRequests: 3, wantReply: "summary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := newFakeModel(t, func(r fakeRequest) fakeResponse {
+				if r.n == 2 {
+					return fakeResponse{text: "summary"}
+				}
+				return fakeResponse{toolCall: "read_file", arguments: `{"path": "a.go"}`}
+			})
+			var reasons []string
+			e := New(Config{
+				Providers: []Provider{model.provider("primary")},
+				Tools:     echoTools{},
+				Limits:    TurnLimits{MaxIterations: 2},
+				AtLimit: func(reason string) (LimitAction, string) {
+					reasons = append(reasons, reason)
+					return tt.action, "Summarize."
+				},
+			}, "system")
+
+			var events eventLog
+			if err := e.Turn(context.Background(), "read it", events.add); err != nil {
+				t.Fatalf("Turn() error = %v", err)
+			}
+			if len(reasons) != 1 || reasons[0] != "2 model requests" {
+				t.Errorf("AtLimit reasons = %q, want [\"2 model requests\"]", reasons)
+			}
+			requests := model.requests()
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("made %d requests, want %d", len(requests), tt.wantRequests)
+			}
+			if last := requests[len(requests)-1]; tt.action == LimitWrapUp && last.tools {
+				t.Error("the wrap-up request offered tools")
+			}
+			if e.LastReply != tt.wantReply {
+				t.Errorf("LastReply = %q, want %q", e.LastReply, tt.wantReply)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+// Retry defaults for the chat completion stream
+const (
+	defaultMaxRetries = 3
+	retryBaseDelay    = time.Second
+	retryMaxDelay     = 30 * time.Second
+	maxRetryAfter     = 2 * time.Minute
+)
+
+// continuePrompt asks the model to finish a response that was cut off
+const continuePrompt = "Your previous response was cut off by a connection problem. Continue exactly where it stopped, without repeating anything already written."
+
+// errStreamCut reports a stream that ended without the [DONE] marker or a
+// finish reason
+var errStreamCut = errors.New("response stream ended early")
+
+// streamResponse streams one assistant response, retrying transient failures
+// with exponential backoff and jitter and then moving on to fallback
+// providers. Text already shown is kept: a retry after partial output asks
+// the model to continue from where it stopped and the pieces are merged into
+// one message. If every attempt fails, the partial text is still returned so
+// the conversation matches what the user saw. The tokens used by all
+// attempts are returned too.
+func (t *turn) streamResponse(tools []openai.ChatCompletionToolUnionParam) (openai.ChatCompletionMessage, int64, error) {
+	maxRetries := t.MaxRetries
+	switch {
+	case maxRetries == 0:
+		maxRetries = defaultMaxRetries
+	case maxRetries < 0:
+		maxRetries = 0
+	}
+
+	var partial strings.Builder
+	var lastErr error
+	var tokens int64
+	providers := t.Providers
+	if len(providers) == 0 {
+		return openai.ChatCompletionMessage{Role: "assistant"}, 0, errors.New("no model provider is configured")
+	}
+
+	for p, provider := range providers {
+		if p > 0 {
+			t.notify(NoticeWarning, "↪️  Switching to fallback %s at %s", provider.Model, provider.Host)
+		}
+
+		for attempt := 0; attempt <= maxRetries; attempt++ {
+			msg, used, err := t.streamAttempt(provider, tools, partial.String())
+			partial.WriteString(msg.Content)
+			tokens += used
+			if err == nil {
+				msg.Content = partial.String()
+				return msg, tokens, nil
+			}
+			lastErr = err
+			if t.ctx.Err() != nil {
+				return openai.ChatCompletionMessage{Role: "assistant", Content: partial.String()}, tokens, err
+			}
+
+			retryable, wait, reason := classifyStreamError(err)
+			if !retryable || attempt == maxRetries {
+				if p < len(providers)-1 {
+					t.notify(NoticeWarning, "⚠️  %s: %s", reason, summarizeError(err))
+				}
+				break
+			}
+
+			delay := backoffDelay(attempt)
+			if wait > delay {
+				delay = min(wait, maxRetryAfter)
+			}
+			t.notify(NoticeWarning, "⚠️  %s, retrying in %s (attempt %d of %d)",
+				reason, delay.Round(100*time.Millisecond), attempt+2, maxRetries+1)
+			if err := sleepContext(t.ctx, delay); err != nil {
+				return openai.ChatCompletionMessage{Role: "assistant", Content: partial.String()}, tokens, err
+			}
+		}
+	}
+
+	return openai.ChatCompletionMessage{Role: "assistant", Content: partial.String()}, tokens, lastErr
+}
+
+// streamAttempt makes one streaming request and reports its text as it
+// arrives. The returned message holds whatever arrived, even on error;
+// tool calls are only kept when the response completed. Token usage is taken
+// from the provider's report, or estimated when it sends none.
+func (t *turn) streamAttempt(provider Provider, tools []openai.ChatCompletionToolUnionParam, partial string) (openai.ChatCompletionMessage, int64, error) {
+	messages := t.Messages
+	if partial != "" {
+		messages = append(append([]openai.ChatCompletionMessageParamUnion{}, t.Messages...),
+			openai.AssistantMessage(partial),
+			openai.UserMessage(continuePrompt),
+		)
+	}
+
+	t.emit(ResponseStarted{})
+
+	// Create streaming request
+	params := openai.ChatCompletionNewParams{
+		Messages:      messages,
+		Model:         openai.ChatModel(provider.Model),
+		StreamOptions: openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)},
+	}
+	if len(tools) > 0 {
+		params.Tools = tools
+		params.ParallelToolCalls = openai.Bool(true)
+	}
+	body := &doneWatcher{}
+	stream := provider.Client.Chat.Completions.NewStreaming(t.ctx, params, option.WithMiddleware(body.watch))
+	defer stream.Close()
+
+	// Use ChatCompletionAccumulator to properly handle tool calls
+	acc := openai.ChatCompletionAccumulator{}
+
+	var text strings.Builder
+	for stream.Next() {
+		current := stream.Current()
+		acc.AddChunk(current)
+
+		if len(current.Choices) > 0 {
+			if delta := current.Choices[0].Delta.Content; delta != "" {
+				t.emit(TextDelta{Text: delta})
+				text.WriteString(delta)
+			}
+		}
+	}
+
+	usage := Usage{
+		PromptTokens:     acc.Usage.PromptTokens,
+		CompletionTokens: acc.Usage.CompletionTokens,
+		TotalTokens:      acc.Usage.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = estimateRequestTokens(messages, text.String())
+	}
+	t.emit(usage)
+	tokens := usage.TotalTokens
+
+	// Some providers leave out the finish reason, so a stream only counts as
+	// cut off when the [DONE] marker is missing too
+	err := stream.Err()
+	finished := len(acc.Choices) > 0 && acc.Choices[0].FinishReason != ""
+	if err == nil && !body.done && !finished {
+		err = errStreamCut
+	}
+	if err == nil && len(acc.Choices) == 0 {
+		acc.Choices = append(acc.Choices, openai.ChatCompletionChoice{})
+	}
+	t.emit(ResponseFinished{Err: err})
+	if err != nil {
+		return openai.ChatCompletionMessage{Role: "assistant", Content: text.String()}, tokens, err
+	}
+
+	msg := acc.Choices[0].Message
+	msg.Content = text.String()
+	return msg, tokens, nil
+}
+
+// doneWatcher notes whether a response stream carried the SSE [DONE] marker
+type doneWatcher struct {
+	body io.ReadCloser
+	tail []byte // End of what was read so far, for a marker split across reads
+	done bool
+}
+
+// doneMarker ends an OpenAI-compatible event stream
+var doneMarker = []byte("data: [DONE]")
+
+// watch is request middleware that routes the response body through w
+func (w *doneWatcher) watch(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	resp, err := next(req)
+	if resp != nil && resp.Body != nil {
+		w.body = resp.Body
+		resp.Body = w
+	}
+	return resp, err
+}
+
+func (w *doneWatcher) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 && !w.done {
+		w.tail = append(w.tail, p[:n]...)
+		w.done = bytes.Contains(w.tail, doneMarker)
+		if keep := len(doneMarker) - 1; len(w.tail) > keep {
+			w.tail = append(w.tail[:0], w.tail[len(w.tail)-keep:]...)
+		}
+	}
+	return n, err
+}
+
+func (w *doneWatcher) Close() error {
+	return w.body.Close()
+}
+
+// classifyStreamError decides whether a failed request is worth retrying and
+// how long the server asked to wait
+func classifyStreamError(err error) (retryable bool, wait time.Duration, reason string) {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		status := apiErr.StatusCode
+		if apiErr.Response != nil {
+			wait = retryAfter(apiErr.Response.Header)
+		}
+		switch {
+		case status == http.StatusTooManyRequests:
+			return true, wait, "Rate limited (429)"
+		case status == http.StatusRequestTimeout, status == http.StatusConflict:
+			return true, wait, fmt.Sprintf("Request failed (%d)", status)
+		case status >= 500:
+			return true, wait, fmt.Sprintf("Server error (%d)", status)
+		default:
+			return false, 0, fmt.Sprintf("Request rejected (%d)", status)
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false, 0, "Cancelled"
+	}
+	if errors.Is(err, errStreamCut) {
+		return true, 0, "Response stream ended early"
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, context.DeadlineExceeded) {
+		return true, 0, "Connection dropped"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true, 0, "Network error"
+	}
+	if strings.Contains(err.Error(), "received error while streaming") {
+		return true, 0, "Provider reported an error mid-stream"
+	}
+	return false, 0, "Request failed"
+}
+
+// retryAfter reads the server's requested delay from Retry-After (seconds or
+// HTTP date) or retry-after-ms headers
+func retryAfter(header http.Header) time.Duration {
+	if ms := header.Get("Retry-After-Ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n > 0 {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// backoffDelay is exponential in the attempt number, with jitter spreading
+// each delay over its upper half so concurrent clients don't retry in step
+func backoffDelay(attempt int) time.Duration {
+	d := retryBaseDelay << attempt
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// summarizeError shortens an API error to its first line
+func summarizeError(err error) string {
+	s := err.Error()
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return s
+}
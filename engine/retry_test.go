@@ -0,0 +1,325 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+	"github.com/openai/openai-go/v2/shared"
+)
+
+// fakeRequest is a chat completion request received by a fakeModel
+type fakeRequest struct {
+	n        int    // Requests before this one, across providers
+	provider string // Name given to fakeModel.provider
+	model    string
+	tools    bool // The request offered tools
+}
+
+// fakeResponse is what a fakeModel answers: an HTTP error status, or a
+// streamed reply with text and at most one tool call
+type fakeResponse struct {
+	status    int
+	text      string
+	toolCall  string
+	arguments string
+	cut       bool // End the stream without a finish reason or [DONE]
+}
+
+// fakeModel is an OpenAI-compatible server whose replies come from respond
+type fakeModel struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	log     []fakeRequest
+	respond func(fakeRequest) fakeResponse
+}
+
+func newFakeModel(t *testing.T, respond func(fakeRequest) fakeResponse) *fakeModel {
+	m := &fakeModel{respond: respond}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// provider returns a provider that reaches the server under name
+func (m *fakeModel) provider(name string) Provider {
+	client := openai.NewClient(
+		option.WithAPIKey("test"),
+		option.WithBaseURL(m.server.URL+"/"+name+"/"),
+		option.WithMaxRetries(0),
+	)
+	return Provider{Client: &client, Model: name + "-model", Host: name}
+}
+
+// requests returns the requests received so far
+func (m *fakeModel) requests() []fakeRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]fakeRequest(nil), m.log...)
+}
+
+func (m *fakeModel) serve(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model string            `json:"model"`
+		Tools []json.RawMessage `json:"tools"`
+	}
+	data, _ := io.ReadAll(r.Body)
+	json.Unmarshal(data, &body)
+
+	m.mu.Lock()
+	req := fakeRequest{
+		n:        len(m.log),
+		provider: strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0],
+		model:    body.Model,
+		tools:    len(body.Tools) > 0,
+	}
+	m.log = append(m.log, req)
+	m.mu.Unlock()
+
+	resp := m.respond(req)
+	if resp.status != 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		fmt.Fprintf(w, `{"error": {"message": "status %d"}}`, resp.status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	chunk := func(delta map[string]any, finish any) {
+		b, _ := json.Marshal(map[string]any{
+			"id": "chunk", "object": "chat.completion.chunk", "created": 0, "model": req.model,
+			"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", b)
+	}
+	if resp.text != "" {
+		chunk(map[string]any{"role": "assistant", "content": resp.text}, nil)
+	}
+	if resp.cut {
+		return
+	}
+	finish := "stop"
+	if resp.toolCall != "" {
+		chunk(map[string]any{"tool_calls": []any{map[string]any{
+			"index": 0, "id": fmt.Sprintf("call_%d", req.n), "type": "function",
+			"function": map[string]any{"name": resp.toolCall, "arguments": resp.arguments},
+		}}}, nil)
+		finish = "tool_calls"
+	}
+	chunk(map[string]any{}, finish)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// eventLog collects the events of a turn
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (l *eventLog) add(ev Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, ev)
+}
+
+// count returns how many events match
+func (l *eventLog) count(match func(Event) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, ev := range l.events {
+		if match(ev) {
+			n++
+		}
+	}
+	return n
+}
+
+// notices returns the text of the notices
+func (l *eventLog) notices() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var texts []string
+	for _, ev := range l.events {
+		if n, ok := ev.(Notice); ok {
+			texts = append(texts, n.Text)
+		}
+	}
+	return texts
+}
+
+// echoTools offers one read-only tool that accepts any arguments
+type echoTools struct{}
+
+func (echoTools) Definitions() []openai.ChatCompletionToolUnionParam {
+	return []openai.ChatCompletionToolUnionParam{
+		openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{Name: "read_file"}),
+	}
+}
+
+func (echoTools) Parse(_, arguments string) (map[string]any, error) {
+	args := map[string]any{}
+	err := json.Unmarshal([]byte(arguments), &args)
+	return args, err
+}
+
+func (echoTools) Call(_ context.Context, name string, _ map[string]any) (any, error) {
+	return name + " ok", nil
+}
+
+func (echoTools) ReadOnly(string) bool    { return true }
+func (echoTools) Interactive(string) bool { return false }
+
+// rejectingTools finds every call's arguments invalid
+type rejectingTools struct{ echoTools }
+
+func (rejectingTools) Parse(string, string) (map[string]any, error) {
+	return nil, errors.New("path: expected string, got integer")
+}
+
+func TestStreamResponseFallbackOrder(t *testing.T) {
+	model := newFakeModel(t, func(r fakeRequest) fakeResponse {
+		switch r.provider {
+		case "primary":
+			return fakeResponse{status: http.StatusServiceUnavailable}
+		case "rejecting":
+			return fakeResponse{status: http.StatusBadRequest}
+		}
+		return fakeResponse{text: "answer"}
+	})
+	e := New(Config{
+		Providers: []Provider{
+			model.provider("primary"),
+			model.provider("rejecting"),
+			model.provider("working"),
+			model.provider("unused"),
+		},
+		MaxRetries: 1,
+	}, "system")
+
+	var events eventLog
+	if err := e.Turn(context.Background(), "hello", events.add); err != nil {
+		t.Fatalf("Turn() error = %v", err)
+	}
+	if e.LastReply != "answer" {
+		t.Errorf("LastReply = %q, want %q", e.LastReply, "answer")
+	}
+
+	// A server error is retried; a rejected request moves straight on
+	var order []string
+	for _, r := range model.requests() {
+		order = append(order, r.model)
+	}
+	want := []string{"primary-model", "primary-model", "rejecting-model", "working-model"}
+	if strings.Join(order, " ") != strings.Join(want, " ") {
+		t.Errorf("requests went to %q, want %q", order, want)
+	}
+
+	var switches []string
+	for _, text := range events.notices() {
+		if strings.Contains(text, "Switching to fallback") {
+			switches = append(switches, text)
+		}
+	}
+	if len(switches) != 2 || !strings.Contains(switches[0], "rejecting-model") || !strings.Contains(switches[1], "working-model") {
+		t.Errorf("fallback notices = %q", switches)
+	}
+}
+
+func TestStreamResponseKeepsPartialText(t *testing.T) {
+	model := newFakeModel(t, func(r fakeRequest) fakeResponse {
+		if r.n == 0 {
+			return fakeResponse{text: "Hello, ", cut: true}
+		}
+		return fakeResponse{text: "world"}
+	})
+	e := New(Config{Providers: []Provider{model.provider("primary")}, MaxRetries: 1}, "system")
+
+	var events eventLog
+	if err := e.Turn(context.Background(), "greet", events.add); err != nil {
+		t.Fatalf("Turn() error = %v", err)
+	}
+	if e.LastReply != "Hello, world" {
+		t.Errorf("LastReply = %q, want the two parts joined", e.LastReply)
+	}
+}
+
+func TestStreamResponseAllProvidersFail(t *testing.T) {
+	model := newFakeModel(t, func(fakeRequest) fakeResponse {
+		return fakeResponse{status: http.StatusUnauthorized}
+	})
+	e := New(Config{
+		Providers:  []Provider{model.provider("primary"), model.provider("fallback")},
+		MaxRetries: 3,
+	}, "system")
+
+	var events eventLog
+	err := e.Turn(context.Background(), "hello", events.add)
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Turn() error = %v, want the last provider's 401", err)
+	}
+	if got := len(model.requests()); got != 2 {
+		t.Errorf("made %d requests, want one per provider", got)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := range 10 {
+		limit := min(retryBaseDelay<<attempt, retryMaxDelay)
+		for range 20 {
+			if d := backoffDelay(attempt); d < limit/2 || d > limit {
+				t.Fatalf("backoffDelay(%d) = %s, want between %s and %s", attempt, d, limit/2, limit)
+			}
+		}
+	}
+	if d := backoffDelay(100); d < retryMaxDelay/2 || d > retryMaxDelay {
+		t.Errorf("backoffDelay(100) = %s, want at most %s", d, retryMaxDelay)
+	}
+}
+
+func TestClassifyStreamError(t *testing.T) {
+	apiError := func(status int, header http.Header) error {
+		return &openai.Error{StatusCode: status, Response: &http.Response{StatusCode: status, Header: header}}
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		wait      time.Duration
+	}{
+		{name: "rate limited", err: apiError(429, http.Header{"Retry-After": {"7"}}), retryable: true, wait: 7 * time.Second},
+		{name: "rate limited in ms", err: apiError(429, http.Header{"Retry-After-Ms": {"250"}}), retryable: true, wait: 250 * time.Millisecond},
+		{name: "server error", err: apiError(502, http.Header{}), retryable: true},
+		{name: "timeout", err: apiError(408, http.Header{}), retryable: true},
+		{name: "bad request", err: apiError(400, http.Header{}), retryable: false},
+		{name: "unauthorized", err: apiError(401, http.Header{"Retry-After": {"7"}}), retryable: false},
+		{name: "stream cut", err: errStreamCut, retryable: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), retryable: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, retryable: true},
+		{name: "cancelled", err: context.Canceled, retryable: false},
+		{name: "mid-stream error", err: errors.New("received error while streaming: overloaded"), retryable: true},
+		{name: "other", err: errors.New("bad"), retryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryable, wait, _ := classifyStreamError(tt.err)
+			if retryable != tt.retryable || wait != tt.wait {
+				t.Errorf("classifyStreamError() = %v, %s, want %v, %s", retryable, wait, tt.retryable, tt.wait)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// defaultMaxParallelTools bounds concurrent tool calls when the config does not
+const defaultMaxParallelTools = 4
+
+// toolCall is a tool call requested by the model and, once run, its outcome
+type toolCall struct {
+	id       string
+	name     string
+	args     map[string]any
+	invalid  bool // arguments failed validation, so the call is not run
+	result   any
+	err      error
+	duration time.Duration
+}
+
+// runToolCalls executes tool calls concurrently, at most ParallelTools at a
+// time, reporting when each starts and returns. Tools that talk to the user
+// run first, one at a time and outside the batch, so their questions are not
+// drawn over. Results are stored on the calls so the caller can record them
+// in the order the model requested them.
+func (t *turn) runToolCalls(calls []*toolCall) {
+	calls = t.confirmToolCalls(calls)
+
+	var background []*toolCall
+	for _, call := range calls {
+		if !t.Tools.Interactive(call.name) {
+			background = append(background, call)
+			continue
+		}
+		start := time.Now()
+		call.result, call.err = t.Tools.Call(t.ctx, call.name, call.args)
+		call.duration = time.Since(start)
+	}
+	calls = background
+	if len(calls) == 0 {
+		return
+	}
+
+	limit := t.ParallelTools
+	if limit <= 0 {
+		limit = defaultMaxParallelTools
+	}
+
+	refs := make([]ToolCallRef, len(calls))
+	for i, call := range calls {
+		refs[i] = ToolCallRef{ID: call.id, Label: ToolCallLabel(call.name, call.args)}
+	}
+	t.emit(ToolBatchStarted{Calls: refs, Limit: limit})
+
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			label := refs[i].Label
+			t.emit(ToolCallRunning{ID: call.id, Label: label})
+
+			start := time.Now()
+			call.result, call.err = t.Tools.Call(t.ctx, call.name, call.args)
+			call.duration = time.Since(start)
+
+			t.emit(ToolCallDone{ID: call.id, Label: label, Err: call.err, Duration: call.duration})
+		}()
+	}
+	wg.Wait()
+	t.emit(ToolBatchFinished{})
+}
+
+// errToolDeclined answers a tool call the user did not allow
+var errToolDeclined = errors.New("the user declined to run this tool call")
+
+// confirmToolCalls asks permission for each call of a tool that is not
+// read-only when ConfirmTools is on, and returns the calls that may run.
+// Declined calls, and calls nobody could be asked about, get errToolDeclined.
+func (t *turn) confirmToolCalls(calls []*toolCall) []*toolCall {
+	if !t.ConfirmTools {
+		return calls
+	}
+
+	allowed := make([]*toolCall, 0, len(calls))
+	for _, call := range calls {
+		if t.Tools.ReadOnly(call.name) || t.alwaysAllowed[call.name] {
+			allowed = append(allowed, call)
+			continue
+		}
+
+		reply := t.ask(Question{
+			Prompt:     fmt.Sprintf("Allow %s?", ToolCallLabel(call.name, call.args)),
+			Options:    PermissionOptions,
+			ToolCallID: call.id,
+		})
+		switch {
+		case reply.Err != nil || reply.Choice == PermitReject || reply.Choice < 0:
+			call.err = errToolDeclined
+			continue
+		case reply.Choice == PermitAlways:
+			if t.alwaysAllowed == nil {
+				t.alwaysAllowed = make(map[string]bool)
+			}
+			t.alwaysAllowed[call.name] = true
+		}
+		allowed = append(allowed, call)
+	}
+	return allowed
+}
+
+// toolImagesMessage carries the images returned by a round of tool calls,
+// or reports false when there were none
+func toolImagesMessage(calls []*toolCall) (openai.ChatCompletionMessageParamUnion, bool) {
+	var parts []openai.ChatCompletionContentPartUnionParam
+	for _, call := range calls {
+		result, ok := call.result.(ImageResult)
+		if !ok || call.err != nil {
+			continue
+		}
+		parts = append(parts, openai.TextContentPart(fmt.Sprintf("Image(s) returned by %s:", ToolCallLabel(call.name, call.args))))
+		parts = append(parts, result.Images()...)
+	}
+	if len(parts) == 0 {
+		return openai.ChatCompletionMessageParamUnion{}, false
+	}
+	return openai.UserMessage(parts), true
+}
+
+// ToolCallLabel names a tool call by its tool and its most telling argument,
+// so several calls to the same tool can be told apart
+func ToolCallLabel(name string, args map[string]any) string {
+	for _, key := range []string{"path", "pattern", "command", "symbol", "query", "url", "task"} {
+		if v, ok := args[key].(string); ok && v != "" {
+			if runes := []rune(v); len(runes) > 40 {
+				v = string(runes[:37]) + "..."
+			}
+			return fmt.Sprintf("%s %s", name, strings.ReplaceAll(v, "\n", " "))
+		}
+	}
+	return name
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestToolCallLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		args map[string]any
+		want string
+	}{
+		{name: "no arguments", tool: "env_info", want: "env_info"},
+		{name: "path", tool: "read_file", args: map[string]any{"path": "main.go"}, want: "read_file main.go"},
+		{name: "first telling key wins", tool: "grep", args: map[string]any{"query": "q", "path": "src"}, want: "grep src"},
+		{name: "empty value skipped", tool: "grep", args: map[string]any{"path": "", "pattern": "TODO"}, want: "grep TODO"},
+		{name: "newlines flattened", tool: "run_command", args: map[string]any{"command": "a\nb"}, want: "run_command a b"},
+		{
+			name: "long value shortened",
+			tool: "run_command",
+			args: map[string]any{"command": strings.Repeat("x", 50)},
+			want: "run_command " + strings.Repeat("x", 37) + "...",
+		},
+		{
+			name: "shortened on a rune boundary",
+			tool: "delegate_task",
+			args: map[string]any{"task": strings.Repeat("é", 50)},
+			want: "delegate_task " + strings.Repeat("é", 37) + "...",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ToolCallLabel(tt.tool, tt.args)
+			if got != tt.want {
+				t.Errorf("ToolCallLabel() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("ToolCallLabel() = %q is not valid UTF-8", got)
+			}
+		})
+	}
+}
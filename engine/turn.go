@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// defaultMaxToolRepairs bounds how many times per turn the model may resend
+// tool calls whose arguments failed validation
+const defaultMaxToolRepairs = 3
+
+// Provider is an endpoint and model to stream completions from
+type Provider struct {
+	Client *openai.Client
+	Model  string
+	Host   string // Shown when a turn switches to this provider
+}
+
+// Tools are what the model may call during a turn
+type Tools interface {
+	// Definitions returns the tools offered to the model
+	Definitions() []openai.ChatCompletionToolUnionParam
+	// Parse decodes a call's JSON arguments and checks them. The error is
+	// written for the model, so it can correct the call.
+	Parse(name, arguments string) (map[string]any, error)
+	// Call runs a tool. A result with images implements ImageResult; other
+	// results are sent to the model as formatted by %v. args are also
+	// published in the turn's events, so Call must not change them.
+	Call(ctx context.Context, name string, args map[string]any) (any, error)
+	// ReadOnly reports whether a tool only reads, so it needs no permission
+	ReadOnly(name string) bool
+	// Interactive reports whether a tool talks to the user. Such calls run
+	// one at a time before the others, so their questions are not drawn over.
+	Interactive(name string) bool
+}
+
+// ImageResult is a tool result with images next to its text. Tool messages
+// can only carry text, so the images follow in a user message.
+type ImageResult interface {
+	String() string
+	Images() []openai.ChatCompletionContentPartUnionParam
+}
+
+// Config sets up an Engine. Zero limits and counts use the defaults.
+type Config struct {
+	// Providers are tried in order: the first one, then the others once it
+	// keeps failing
+	Providers []Provider
+	// Tools are offered to the model; nil offers none
+	Tools Tools
+
+	Limits         TurnLimits // Per-turn limits
+	MaxRetries     int        // Retries per provider (default 3); negative disables retries
+	MaxToolRepairs int        // Tool call rounds with invalid arguments allowed per turn (default 3)
+	ParallelTools  int        // Concurrent tool calls (default 4)
+	ConfirmTools   bool       // Ask before running tools that are not read-only
+
+	// UserMessage turns the user's input into the message sent to the
+	// model; nil sends the input as it is
+	UserMessage func(input string) (openai.ChatCompletionMessageParamUnion, error)
+	// AfterTools is called after each round of tool calls, to report what
+	// the tools changed
+	AfterTools func(emit func(Event))
+	// AtLimit decides how a turn goes on once it reaches a limit; nil asks
+	// the user
+	AtLimit func(reason string) (LimitAction, string)
+}
+
+// Engine runs the turns of one conversation: it streams the model's
+// responses, retrying and falling back as needed, and runs the tool calls
+// they ask for until the model answers without any
+type Engine struct {
+	Config
+
+	// Messages is the conversation so far, starting with the system prompt.
+	// Callers may replace it between turns, to restore a saved conversation.
+	Messages []openai.ChatCompletionMessageParamUnion
+	// LastReply is the text of the last final assistant message
+	LastReply string
+
+	alwaysAllowed map[string]bool // Tools the user allowed for the rest of the session
+}
+
+// New returns an engine for a new conversation that starts with the system
+// prompt
+func New(config Config, system string) *Engine {
+	e := &Engine{Config: config}
+	e.Reset(system)
+	return e
+}
+
+// Reset starts a new conversation with the system prompt, forgetting which
+// tools the user allowed
+func (e *Engine) Reset(system string) {
+	e.Messages = []openai.ChatCompletionMessageParamUnion{openai.SystemMessage(system)}
+	e.LastReply = ""
+	e.alwaysAllowed = nil
+}
+
+// Run starts a turn for the user's input and returns its events, making
+// Engine an Agent. Turns must not overlap.
+func (e *Engine) Run(ctx context.Context, input string) <-chan Event {
+	return Stream(ctx, input, e.Turn)
+}
+
+// turn is the state of one running turn
+type turn struct {
+	*Engine
+	ctx  context.Context
+	emit func(Event)
+}
+
+// notify sends a notice
+func (t *turn) notify(level NoticeLevel, format string, args ...any) {
+	t.emit(Notice{Level: level, Text: fmt.Sprintf(format, args...)})
+}
+
+// ask puts a question to the user and waits for the reply
+func (t *turn) ask(q Question) Reply {
+	return Ask(t.ctx, t.emit, q)
+}
+
+// Turn appends the user's input to the conversation, streams a response and
+// runs the tools it calls until the model answers without calling any,
+// reporting what happens through emit. It is the TurnFunc behind Run, for
+// callers that handle the events themselves; emit must be safe to call from
+// several goroutines.
+func (e *Engine) Turn(ctx context.Context, input string, emit func(Event)) error {
+	if strings.TrimSpace(input) == "" {
+		return nil
+	}
+	t := &turn{Engine: e, ctx: ctx, emit: emit}
+
+	t.emit(TurnStarted{Input: input})
+
+	// Append user message to conversation
+	userMessage := openai.UserMessage(input)
+	if e.UserMessage != nil {
+		var err error
+		if userMessage, err = e.UserMessage(input); err != nil {
+			return err
+		}
+	}
+	e.Messages = append(e.Messages, userMessage)
+	started := time.Now()
+
+	// Tool call rounds with invalid arguments so far this turn
+	repairs := 0
+	maxRepairs := e.MaxToolRepairs
+	if maxRepairs == 0 {
+		maxRepairs = defaultMaxToolRepairs
+	}
+
+	// Per-turn limits on requests, tool calls, time and tokens
+	guard := newTurnGuard(e.Limits)
+
+	// Continue conversation loop until no more tool calls are needed
+	for {
+		// Decide how to go on once a limit is reached
+		wrapUp := false
+		if reason := guard.exceeded(); reason != "" {
+			action, instructions := t.atLimit(reason)
+			switch action {
+			case LimitStop:
+				t.endTurn(started)
+				return nil
+			case LimitRedirect:
+				e.Messages = append(e.Messages, openai.UserMessage(instructions))
+			case LimitWrapUp:
+				e.Messages = append(e.Messages, openai.UserMessage(instructions))
+				wrapUp = true
+			}
+			guard.reset()
+		}
+
+		// Stream the response, retrying and falling back as needed; a
+		// response that wraps up gets no tools
+		var tools []openai.ChatCompletionToolUnionParam
+		if !wrapUp {
+			tools = e.definitions()
+		}
+		message, tokens, err := t.streamResponse(tools)
+		guard.recordResponse(tokens)
+		if err != nil {
+			// Keep any partial answer so the history matches what was shown
+			if message.Content != "" {
+				e.Messages = append(e.Messages, openai.AssistantMessage(message.Content))
+			}
+			return fmt.Errorf("stream error: %w", err)
+		}
+
+		// No more tool calls; add final assistant message to conversation and finish
+		if len(message.ToolCalls) == 0 {
+			e.Messages = append(e.Messages, message.ToParam())
+			e.LastReply = message.Content
+			break
+		}
+
+		// Add the assistant message with tool calls to conversation
+		e.Messages = append(e.Messages, message.ToParam())
+
+		// Validate arguments and show each call before anything runs;
+		// invalid calls are answered with the problem so the model can fix them
+		var ordered, calls []*toolCall
+		invalid := false
+		for _, tc := range message.ToolCalls {
+			call := &toolCall{id: tc.ID, name: tc.Function.Name}
+			ordered = append(ordered, call)
+			args, err := e.parse(tc.Function.Name, tc.Function.Arguments)
+			if err != nil {
+				t.emit(ToolCallInvalid{ID: call.id, Name: call.name, Err: err})
+				call.err, call.invalid = err, true
+				invalid = true
+				continue
+			}
+			call.args = args
+
+			t.emit(ToolCallStarted{ID: call.id, Name: call.name, Args: args})
+
+			calls = append(calls, call)
+		}
+		if invalid {
+			repairs++
+		}
+
+		// Execute independent calls concurrently, as many as the turn allows
+		run := guard.limitCalls(calls)
+		t.runToolCalls(run)
+		for _, call := range run {
+			guard.recordCall(call.name, call.args)
+		}
+
+		// Report results and add tool messages in the order the model asked for them
+		for _, call := range ordered {
+			if call.invalid {
+				e.Messages = append(e.Messages, openai.ToolMessage(fmt.Sprintf("Error: %v", call.err), call.id))
+				continue
+			}
+
+			result := call.result
+			if call.err != nil {
+				result = fmt.Sprintf("Error: %v", call.err)
+			}
+
+			event := ToolCallResult{ID: call.id, Name: call.name, Args: call.args, Err: call.err, Duration: call.duration}
+			if call.err == nil {
+				event.Result = fmt.Sprintf("%v", call.result)
+			}
+			t.emit(event)
+
+			// Add tool message to conversation
+			e.Messages = append(e.Messages, openai.ToolMessage(fmt.Sprintf("%v", result), call.id))
+		}
+
+		// Pass on images returned by tools
+		if imageMessage, ok := toolImagesMessage(calls); ok {
+			e.Messages = append(e.Messages, imageMessage)
+		}
+
+		if e.AfterTools != nil {
+			e.AfterTools(t.emit)
+		}
+
+		// Stop once the model keeps sending calls that cannot be run
+		if repairs > maxRepairs {
+			t.endTurn(started)
+			return fmt.Errorf("tool arguments failed validation %d times in this turn", repairs)
+		}
+	}
+
+	t.endTurn(started)
+	return nil
+}
+
+// endTurn closes a turn that ran to completion or was stopped
+func (t *turn) endTurn(started time.Time) {
+	t.emit(TurnFinished{Elapsed: time.Since(started)})
+}
+
+// definitions returns the tools offered to the model
+func (e *Engine) definitions() []openai.ChatCompletionToolUnionParam {
+	if e.Tools == nil {
+		return nil
+	}
+	return e.Tools.Definitions()
+}
+
+// parse decodes and checks a tool call's arguments
+func (e *Engine) parse(name, arguments string) (map[string]any, error) {
+	if e.Tools == nil {
+		return nil, fmt.Errorf("unknown tool %q; no tools are available", name)
+	}
+	return e.Tools.Parse(name, arguments)
+}
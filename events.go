@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go/v2"
+
+	"open-coder/engine"
+)
+
+// Run starts a turn for the user's input and returns its events, making
+// SimpleAgent an engine.Agent. Turns must not overlap.
+func (a *SimpleAgent) Run(ctx context.Context, input string) <-chan engine.Event {
+	return engine.Stream(ctx, input, a.turn)
+}
+
+// turn runs the engine's turn with the turn's context, reporting to emit, and
+// saves the session once the conversation has grown
+func (a *SimpleAgent) turn(ctx context.Context, input string, emit func(engine.Event)) error {
+	base := a.ctx
+	a.ctx, a.emitter = ctx, emit
+	defer func() { a.ctx, a.emitter = base, nil }()
+
+	before := len(a.engine.Messages)
+	defer func() {
+		if len(a.engine.Messages) > before {
+			a.saveSession()
+		}
+	}()
+	return a.engine.Turn(ctx, input, emit)
+}
+
+// useEngine gives the agent a turn engine with config's providers and limits,
+// running the agent's tools, attaching what its @ mentions refer to and
+// reporting changes to its todo list
+func (a *SimpleAgent) useEngine(config engine.Config) {
+	config.Tools = agentTools{a}
+	config.UserMessage = func(input string) (message openai.ChatCompletionMessageParamUnion, err error) {
+		a.inWorkDir(func() { message, err = a.buildUserMessage(input) })
+		return message, err
+	}
+	config.AfterTools = a.reportTodos
+	a.engine = engine.New(config, a.systemPrompt)
+}
+
+// inWorkDir runs fn in the agent's working directory
+func (a *SimpleAgent) inWorkDir(fn func()) {
+	if a.inDir == nil {
+		fn()
+		return
+	}
+	a.inDir(fn)
+}
+
+// reportTodos shows the todo list when the model updated it
+func (a *SimpleAgent) reportTodos(emit func(engine.Event)) {
+	if a.todos != nil && a.todos.takeChanged() {
+		if items := a.todos.snapshot(); len(items) > 0 {
+			emit(engine.TodosChanged{Items: items})
+		}
+	}
+}
+
+// agentTools offers the agent's MCP and built-in tools to its engine
+type agentTools struct {
+	a *SimpleAgent
+}
+
+func (t agentTools) Definitions() []openai.ChatCompletionToolUnionParam { return t.a.tools }
+
+func (t agentTools) Parse(name, arguments string) (map[string]any, error) {
+	return t.a.parseToolArguments(name, arguments)
+}
+
+// Call runs a tool; the agent's context is already the turn's
+func (t agentTools) Call(_ context.Context, name string, args map[string]any) (any, error) {
+	return t.a.CallTool(name, args)
+}
+
+func (t agentTools) ReadOnly(name string) bool { return t.a.readOnlyTools[name] }
+
+func (t agentTools) Interactive(name string) bool {
+	tool, ok := t.a.builtinTool(name).(interactiveTool)
+	return ok && tool.Interactive()
+}
+
+// emit reports an event of the running turn
+func (a *SimpleAgent) emit(ev engine.Event) {
+	if a.emitter != nil {
+		a.emitter(ev)
+	}
+}
+
+// notify sends a notice
+func (a *SimpleAgent) notify(level engine.NoticeLevel, format string, args ...any) {
+	a.emit(engine.Notice{Level: level, Text: fmt.Sprintf(format, args...)})
+}
+
+// ask puts a question to the user and waits for the reply. Outside a turn
+// nobody is listening, so nobody can answer.
+func (a *SimpleAgent) ask(q engine.Question) engine.Reply {
+	if a.emitter == nil {
+		return engine.Reply{Choice: -1, Err: engine.ErrNoUser}
+	}
+	return engine.Ask(a.ctx, a.emit, q)
+}
@@ -3,15 +3,17 @@ module open-coder
 go 1.25.1
 
 require (
+	atomicgo.dev/cursor v0.2.0
+	atomicgo.dev/keyboard v0.2.9
+	github.com/coder/acp-go-sdk v0.6.3
 	github.com/mark3labs/mcp-go v0.40.0
+	github.com/mattn/go-runewidth v0.0.16
 	github.com/modelcontextprotocol/go-sdk v0.7.0
 	github.com/openai/openai-go/v2 v2.7.0
 	github.com/pterm/pterm v0.12.81
 )
 
 require (
-	atomicgo.dev/cursor v0.2.0 // indirect
-	atomicgo.dev/keyboard v0.2.9 // indirect
 	atomicgo.dev/schedule v0.1.0 // indirect
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
@@ -22,7 +24,6 @@ require (
 	github.com/invopop/jsonschema v0.13.0 // indirect
 	github.com/lithammer/fuzzysearch v1.1.8 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
-	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/spf13/cast v1.7.1 // indirect
 	github.com/tidwall/gjson v1.14.4 // indirect
@@ -52,7 +52,7 @@ echo
 echo "🔨 Building main application..."
 if [[ -f "$SCRIPT_DIR/main.go" ]]; then
     cd "$SCRIPT_DIR"
-    if go build -o open-coder main.go; then
+    if go build -o open-coder .; then
         print_status "Main application built successfully"
     else
         print_error "Failed to build main application"
@@ -68,7 +68,7 @@ echo
 echo "🔨 Building file operations MCP server..."
 if [[ -f "$SCRIPT_DIR/tools/file-access/main.go" ]]; then
     cd "$SCRIPT_DIR/tools/file-access"
-    if go build -o file-ops-cli main.go; then
+    if go build -o file-ops-cli .; then
         print_status "File operations server built successfully"
     else
         print_error "Failed to build file operations server"
@@ -95,7 +95,7 @@ while IFS= read -r -d '' tool_dir; do
         cd "$tool_dir"
         binary_name="${tool_name}-cli"
 
-        if go build -o "$binary_name" main.go; then
+        if go build -o "$binary_name" .; then
             print_status "$tool_name server built successfully"
             tools_found=$((tools_found + 1))
         else
@@ -0,0 +1,35 @@
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// binarySniffLen is how much of a file is inspected for NUL bytes, matching git.
+const binarySniffLen = 8000
+
+// LooksBinary reports whether data appears to be binary content.
+func LooksBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// IsBinaryFile reports whether the file at path appears to be binary. Files
+// that cannot be read are reported as binary so callers skip them.
+func IsBinaryFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return true
+	}
+	return LooksBinary(buf[:n])
+}
@@ -0,0 +1,206 @@
+// Package fsutil provides ignore-aware file system helpers shared by the agent
+// and its MCP tools.
+package fsutil
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"open-coder/internal/glob"
+)
+
+// IgnoreFiles lists the per-directory files whose patterns exclude paths.
+var IgnoreFiles = []string{".gitignore", ".ignore"}
+
+// DefaultIgnores are excluded even when no ignore file mentions them.
+var DefaultIgnores = []string{".git/", ".hg/", ".svn/", "node_modules/", ".DS_Store"}
+
+// ignoreRule is a single parsed line of an ignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreSet holds the rules of one directory's ignore files
+type ignoreSet struct {
+	base  string
+	rules []ignoreRule
+}
+
+// Matcher decides whether paths are excluded by .gitignore/.ignore files.
+// Rules are loaded lazily per directory, starting at the enclosing repository
+// root so that a search in a subdirectory honors the rules above it.
+type Matcher struct {
+	top      string
+	defaults *ignoreSet
+
+	mu   sync.Mutex
+	sets map[string]*ignoreSet
+}
+
+// NewMatcher creates a matcher for paths below root.
+func NewMatcher(root string) *Matcher {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		absRoot = root
+	}
+	if info, err := os.Stat(absRoot); err == nil && !info.IsDir() {
+		absRoot = filepath.Dir(absRoot)
+	}
+
+	return &Matcher{
+		top:      findRepoRoot(absRoot),
+		defaults: &ignoreSet{rules: parseIgnoreLines(DefaultIgnores)},
+		sets:     make(map[string]*ignoreSet),
+	}
+}
+
+// Ignored reports whether the absolute path is excluded. Only the path itself
+// is checked, not its parent directories; Walk never descends into an ignored
+// directory, so its children are never asked about.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	ignored := false
+	name := filepath.Base(path)
+
+	if matched, negate := m.defaults.match(name, name, isDir); matched {
+		ignored = !negate
+	}
+
+	for _, set := range m.setsFor(filepath.Dir(path)) {
+		rel, err := filepath.Rel(set.base, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if matched, negate := set.match(filepath.ToSlash(rel), name, isDir); matched {
+			ignored = !negate
+		}
+	}
+
+	return ignored
+}
+
+// setsFor returns the rule sets that apply inside dir, outermost first
+func (m *Matcher) setsFor(dir string) []*ignoreSet {
+	rel, err := filepath.Rel(m.top, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+
+	dirs := []string{m.top}
+	if rel != "." {
+		current := m.top
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			current = filepath.Join(current, part)
+			dirs = append(dirs, current)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sets []*ignoreSet
+	for _, d := range dirs {
+		set, ok := m.sets[d]
+		if !ok {
+			set = loadIgnoreSet(d)
+			m.sets[d] = set
+		}
+		if len(set.rules) > 0 {
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+// match evaluates the rules against a path relative to the set's base; the
+// last matching rule wins
+func (s *ignoreSet) match(rel, name string, isDir bool) (matched, negate bool) {
+	for _, rule := range s.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		var ok bool
+		if rule.anchored {
+			ok = glob.Match(rule.pattern, rel)
+		} else {
+			ok = glob.Match(rule.pattern, name)
+		}
+		if ok {
+			matched, negate = true, rule.negate
+		}
+	}
+	return matched, negate
+}
+
+// loadIgnoreSet reads the ignore files in dir
+func loadIgnoreSet(dir string) *ignoreSet {
+	set := &ignoreSet{base: dir}
+	for _, name := range IgnoreFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var lines []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		f.Close()
+		set.rules = append(set.rules, parseIgnoreLines(lines)...)
+	}
+	return set
+}
+
+// parseIgnoreLines parses gitignore-style pattern lines
+func parseIgnoreLines(lines []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// findRepoRoot returns the nearest ancestor of dir containing a .git entry,
+// or dir itself when it is not inside a repository
+func findRepoRoot(dir string) string {
+	current := dir
+	for {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
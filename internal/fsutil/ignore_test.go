@@ -0,0 +1,95 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseIgnoreLines(t *testing.T) {
+	got := parseIgnoreLines([]string{
+		"# comment",
+		"",
+		"*.log  ",
+		"!keep.log",
+		`\!bang.txt`,
+		"build/",
+		"/root.txt",
+		"docs/**/*.tmp",
+		"/",
+	})
+	want := []ignoreRule{
+		{pattern: "*.log"},
+		{pattern: "keep.log", negate: true},
+		{pattern: "!bang.txt"},
+		{pattern: "build", dirOnly: true},
+		{pattern: "root.txt", anchored: true},
+		{pattern: "docs/**/*.tmp", anchored: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIgnoreLines() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMatcherIgnored(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".git/HEAD", "ref: refs/heads/main\n")
+	write(".gitignore", "*.log\n!keep.log\nbuild/\n/root.txt\ndocs/**/*.tmp\n")
+	write("sub/.ignore", "!debug.log\nlocal/\n")
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{rel: "main.go", want: false},
+		{rel: "app.log", want: true},
+		{rel: "deep/down/app.log", want: true},
+
+		// A later negation re-includes a path
+		{rel: "keep.log", want: false},
+		{rel: "deep/keep.log", want: false},
+
+		// Directory-only rules skip files of the same name
+		{rel: "build", isDir: true, want: true},
+		{rel: "build", want: false},
+		{rel: "src/build", isDir: true, want: true},
+
+		// Rules with a slash are anchored to their ignore file's directory
+		{rel: "root.txt", want: true},
+		{rel: "sub/root.txt", want: false},
+		{rel: "docs/a.tmp", want: true},
+		{rel: "docs/x/y/a.tmp", want: true},
+		{rel: "notes/docs/a.tmp", want: false},
+
+		// A nested ignore file overrides the rules above it
+		{rel: "sub/debug.log", want: false},
+		{rel: "sub/other.log", want: true},
+		{rel: "debug.log", want: true},
+		{rel: "sub/local", isDir: true, want: true},
+		{rel: "local", isDir: true, want: false},
+
+		// Defaults apply without any ignore file
+		{rel: ".git", isDir: true, want: true},
+		{rel: "web/node_modules", isDir: true, want: true},
+		{rel: "photos/.DS_Store", want: true},
+	}
+
+	// Rooted in a subdirectory, the matcher still starts at the repository root
+	m := NewMatcher(filepath.Join(root, "sub"))
+	for _, tt := range tests {
+		if got := m.Ignored(filepath.Join(root, filepath.FromSlash(tt.rel)), tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
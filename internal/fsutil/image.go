@@ -0,0 +1,71 @@
+package fsutil
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxImageSize is the largest image that is sent to a model.
+const MaxImageSize = 10 * 1024 * 1024
+
+// imageExtensions maps the image formats vision models accept to their MIME types
+var imageExtensions = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// IsImagePath reports whether a file name has the extension of a supported image.
+func IsImagePath(name string) bool {
+	_, ok := imageExtensions[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// ImageMIMEType returns the MIME type of image data, sniffed from its content
+// and falling back to the file extension. ok is false for unsupported formats.
+func ImageMIMEType(name string, data []byte) (mimeType string, ok bool) {
+	sniffed := http.DetectContentType(data)
+	for _, t := range imageExtensions {
+		if sniffed == t {
+			return t, true
+		}
+	}
+	if t, known := imageExtensions[strings.ToLower(filepath.Ext(name))]; known && sniffed == "application/octet-stream" {
+		return t, true
+	}
+	return "", false
+}
+
+// ReadImage reads an image file, checking its size and format.
+func ReadImage(path string) (data []byte, mimeType string, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.IsDir() {
+		return nil, "", fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > MaxImageSize {
+		return nil, "", fmt.Errorf("%s is too large (%d bytes, limit %d)", path, info.Size(), MaxImageSize)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	mimeType, ok := ImageMIMEType(path, data)
+	if !ok {
+		return nil, "", fmt.Errorf("%s is not a PNG, JPEG, GIF or WebP image", path)
+	}
+	return data, mimeType, nil
+}
+
+// ImageDataURL encodes image data as a base64 data URL.
+func ImageDataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
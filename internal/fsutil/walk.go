@@ -0,0 +1,74 @@
+package fsutil
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// WalkOptions controls Walk.
+type WalkOptions struct {
+	// NoIgnore disables ignore files and DefaultIgnores.
+	NoIgnore bool
+	// MaxDepth limits how many directory levels below root are visited;
+	// zero means unlimited.
+	MaxDepth int
+}
+
+// Walk walks the tree rooted at root like filepath.WalkDir, skipping files and
+// directories excluded by ignore files. Unreadable entries are skipped rather
+// than aborting the walk.
+func Walk(root string, opts WalkOptions, fn fs.WalkDirFunc) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	var matcher *Matcher
+	if !opts.NoIgnore {
+		matcher = NewMatcher(absRoot)
+	}
+
+	return filepath.WalkDir(absRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == absRoot {
+				return err
+			}
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if path != absRoot {
+			if matcher != nil && matcher.Ignored(path, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if opts.MaxDepth > 0 && d.IsDir() && depth(absRoot, path) >= opts.MaxDepth {
+				if err := fn(path, d, nil); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+		}
+
+		return fn(path, d, nil)
+	})
+}
+
+// depth returns how many directory levels path is below root
+func depth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	n := 1
+	for _, c := range rel {
+		if c == filepath.Separator {
+			n++
+		}
+	}
+	return n
+}
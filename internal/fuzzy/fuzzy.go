@@ -0,0 +1,121 @@
+// Package fuzzy ranks strings, typically file paths, by how well they match a
+// pattern whose characters appear in order but not necessarily next to each
+// other, as in fuzzy finders.
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Score weights
+const (
+	matchScore       = 16
+	consecutiveBonus = 8
+	boundaryBonus    = 12
+	baseNameBonus    = 8
+)
+
+// Match is a ranked candidate.
+type Match struct {
+	// Str is the candidate as given.
+	Str string
+	// Score is higher for better matches.
+	Score int
+	// Positions are the byte offsets of the matched characters in Str.
+	Positions []int
+}
+
+// Score reports whether every character of pattern occurs in s in order,
+// ignoring case, and how well. Matches at word and path segment boundaries,
+// runs of consecutive characters and matches in the base name score higher;
+// gaps and long candidates score lower. An empty pattern matches everything.
+func Score(pattern, s string) (score int, positions []int, ok bool) {
+	p := []rune(strings.ToLower(pattern))
+	if len(p) == 0 {
+		return -len(s) / 8, nil, true
+	}
+	baseStart := strings.LastIndex(strings.TrimSuffix(s, "/"), "/") + 1
+
+	best := 0
+	// Try each occurrence of the first character as the start of the match
+	for start, r := range s {
+		if unicode.ToLower(r) != p[0] {
+			continue
+		}
+		sc, pos, matched := scoreFrom(p, s, start, baseStart)
+		if matched && (positions == nil || sc > best) {
+			best, positions = sc, pos
+		}
+	}
+	if positions == nil {
+		return 0, nil, false
+	}
+	return best - len(s)/8, positions, true
+}
+
+// scoreFrom greedily matches p in s starting at byte offset start
+func scoreFrom(p []rune, s string, start, baseStart int) (int, []int, bool) {
+	score := 0
+	positions := make([]int, 0, len(p))
+	next := -1 // offset right after the previous match
+	prev, _ := utf8.DecodeLastRuneInString(s[:start])
+	i := 0
+	for off, r := range s[start:] {
+		if i == len(p) {
+			break
+		}
+		at := start + off
+		if unicode.ToLower(r) == p[i] {
+			score += matchScore
+			if at == next {
+				score += consecutiveBonus
+			}
+			if at == 0 || isSeparator(prev) || (unicode.IsLower(prev) && unicode.IsUpper(r)) {
+				score += boundaryBonus
+			}
+			if at >= baseStart {
+				score += baseNameBonus
+			}
+			positions = append(positions, at)
+			next = at + len(string(r))
+			i++
+		}
+		prev = r
+	}
+	if i < len(p) {
+		return 0, nil, false
+	}
+	span := next - positions[0]
+	score -= span - len(p)
+	return score, positions, true
+}
+
+// isSeparator reports whether r separates words or path segments
+func isSeparator(r rune) bool {
+	switch r {
+	case '/', '\\', '_', '-', '.', ' ':
+		return true
+	}
+	return false
+}
+
+// Rank returns the candidates matching pattern, best first, keeping at most
+// limit of them when limit is positive. Ties keep the order of candidates.
+func Rank(pattern string, candidates []string, limit int) []Match {
+	var matches []Match
+	for _, c := range candidates {
+		if score, positions, ok := Score(pattern, c); ok {
+			matches = append(matches, Match{Str: c, Score: score, Positions: positions})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
@@ -0,0 +1,112 @@
+// Package glob matches slash-separated paths against glob patterns with support
+// for "**" path segments and "{a,b}" alternatives.
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the slash-separated name matches pattern.
+//
+// The pattern syntax is that of path.Match, extended with:
+//   - "**" as a whole path segment, matching zero or more segments
+//   - "{a,b,c}" alternatives, which may contain further wildcards
+func Match(pattern, name string) bool {
+	for _, p := range expandBraces(pattern) {
+		if matchSegments(strings.Split(p, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchFile matches a path relative to a search root. Like .gitignore entries,
+// patterns without a slash are matched against the base name at any depth;
+// patterns containing a slash are matched against the whole relative path.
+func MatchFile(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if !strings.Contains(pattern, "/") {
+		return Match(pattern, path.Base(rel))
+	}
+	return Match(strings.TrimPrefix(pattern, "/"), rel)
+}
+
+// Validate reports whether pattern is well formed.
+func Validate(pattern string) error {
+	for _, p := range expandBraces(pattern) {
+		for _, segment := range strings.Split(p, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchSegments matches pattern segments against name segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// expandBraces expands "{a,b}" alternatives into the full list of patterns
+func expandBraces(pattern string) []string {
+	start := strings.IndexByte(pattern, '{')
+	if start < 0 {
+		return []string{pattern}
+	}
+
+	depth := 0
+	var alternatives []string
+	last := start + 1
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case ',':
+			if depth == 1 {
+				alternatives = append(alternatives, pattern[last:i])
+				last = i + 1
+			}
+		case '}':
+			depth--
+			if depth == 0 {
+				alternatives = append(alternatives, pattern[last:i])
+				prefix, suffix := pattern[:start], pattern[i+1:]
+				var out []string
+				for _, alt := range alternatives {
+					out = append(out, expandBraces(prefix+alt+suffix)...)
+				}
+				return out
+			}
+		}
+	}
+
+	// Unbalanced braces are matched literally
+	return []string{pattern}
+}
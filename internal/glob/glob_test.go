@@ -0,0 +1,95 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/?ain.go", "cmd/main.go", true},
+
+		// ** matches zero or more whole segments
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c/main.go", true},
+		{"src/**", "src", true},
+		{"src/**", "src/a/b.txt", true},
+		{"src/**/test/*.go", "src/test/a.go", true},
+		{"src/**/test/*.go", "src/x/y/test/a.go", true},
+		{"src/**/test/*.go", "src/x/y/tests/a.go", false},
+		{"**/**/b", "a/b", true},
+		{"a/**b/c", "a/xb/c", true},
+		{"a/**b/c", "a/x/yb/c", false},
+
+		// {a,b} alternatives, which may hold wildcards and nest
+		{"*.{go,md}", "README.md", true},
+		{"*.{go,md}", "main.rs", false},
+		{"{cmd,internal}/**/*.go", "internal/glob/glob.go", true},
+		{"{cmd,internal}/**/*.go", "tools/main.go", false},
+		{"*.{t{s,sx},js}", "app.tsx", true},
+		{"*.{t{s,sx},js}", "app.jsx", false},
+		{"{a,*b}/c", "xb/c", true},
+
+		// Unbalanced braces are literal
+		{"{a,b", "{a,b", true},
+		{"{a,b", "a", false},
+
+		// Malformed patterns match nothing
+		{"[", "[", false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchFile(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		// Without a slash the base name is matched at any depth
+		{"*.go", "a/b/main.go", true},
+		{"main.go", "a/b/main.go", true},
+		{"*.{go,md}", "docs/README.md", true},
+
+		// With a slash the whole relative path is matched
+		{"a/*.go", "a/main.go", true},
+		{"a/*.go", "x/a/main.go", false},
+		{"**/b/*.go", "x/a/b/main.go", true},
+		{"/a/*.go", "a/main.go", true},
+		{"./a/*.go", "a/main.go", true},
+		{"./*.go", "main.go", true},
+	}
+
+	for _, tt := range tests {
+		if got := MatchFile(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("MatchFile(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"**/*.go", true},
+		{"*.{go,md}", true},
+		{"{a,b", true},
+		{"[a-z]*.go", true},
+		{"src/[", false},
+		{"*.{go,[}", false},
+	}
+
+	for _, tt := range tests {
+		if err := Validate(tt.pattern); (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package lines reads and edits text files by line number. It is shared by
+// the file-access MCP server, which works on disk, and the agent's editor
+// mode, where the editor holds the files.
+package lines
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Edit operations
+const (
+	Replace      = "replace"
+	InsertBefore = "insert_before"
+	InsertAfter  = "insert_after"
+)
+
+// Range returns lines start to end of text (1-based, inclusive), clipped to
+// the text; an end below 1 means the last line, and an end before start
+// selects nothing
+func Range(text string, start, end int) []string {
+	all := strings.Split(text, "\n")
+	if start < 1 {
+		start = 1
+	}
+	if start > len(all) {
+		return nil
+	}
+	if end < 1 || end > len(all) {
+		end = len(all)
+	}
+	if end < start {
+		return nil
+	}
+	return all[start-1 : end]
+}
+
+// Format joins lines for display, numbering them from first when numbered
+func Format(lines []string, first int, numbered bool) string {
+	if !numbered {
+		return strings.Join(lines, "\n")
+	}
+	formatted := make([]string, len(lines))
+	for i, line := range lines {
+		formatted[i] = fmt.Sprintf("%4d: %s", first+i, line)
+	}
+	return strings.Join(formatted, "\n")
+}
+
+// Edit replaces lines start to end of text (1-based, inclusive) with content,
+// or inserts content before start or after end, depending on operation
+func Edit(text string, start, end int, content, operation string) (string, error) {
+	lines := strings.Split(text, "\n")
+	newContentLines := strings.Split(content, "\n")
+
+	// Adjust to 0-based indexing
+	startIdx := start - 1
+	endIdx := end
+
+	// Handle bounds
+	if start < 1 {
+		return "", fmt.Errorf("start_line must be >= 1")
+	}
+	if end < start {
+		return "", fmt.Errorf("end_line must be >= start_line")
+	}
+	if startIdx > len(lines) {
+		return "", fmt.Errorf("start_line %d exceeds file length (%d lines)", start, len(lines))
+	}
+	if endIdx > len(lines) {
+		endIdx = len(lines)
+	}
+
+	var resultLines []string
+	switch operation {
+	case Replace:
+		// Replace the specified range with new content
+		resultLines = append(resultLines, lines[:startIdx]...)
+		resultLines = append(resultLines, newContentLines...)
+		resultLines = append(resultLines, lines[endIdx:]...)
+
+	case InsertBefore:
+		// Insert new content before the specified line
+		resultLines = append(resultLines, lines[:startIdx]...)
+		resultLines = append(resultLines, newContentLines...)
+		resultLines = append(resultLines, lines[startIdx:]...)
+
+	case InsertAfter:
+		// Insert new content after the specified line (or range)
+		resultLines = append(resultLines, lines[:endIdx]...)
+		resultLines = append(resultLines, newContentLines...)
+		resultLines = append(resultLines, lines[endIdx:]...)
+
+	default:
+		return "", fmt.Errorf("Invalid operation: %s. Must be 'replace', 'insert_before', or 'insert_after'", operation)
+	}
+
+	return strings.Join(resultLines, "\n"), nil
+}
@@ -0,0 +1,96 @@
+package lines
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	const text = "one\ntwo\nthree\nfour"
+	tests := []struct {
+		name       string
+		start, end int
+		want       []string
+	}{
+		{name: "middle", start: 2, end: 3, want: []string{"two", "three"}},
+		{name: "single line", start: 4, end: 4, want: []string{"four"}},
+		{name: "to the last line", start: 3, end: 0, want: []string{"three", "four"}},
+		{name: "end past the text", start: 3, end: 10, want: []string{"three", "four"}},
+		{name: "start below 1", start: -2, end: 2, want: []string{"one", "two"}},
+		{name: "start past the text", start: 5, end: 8, want: nil},
+		{name: "end before start", start: 3, end: 1, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Range(text, tt.start, tt.end)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Range(%d, %d) = %q, want %q", tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		first    int
+		numbered bool
+		want     string
+	}{
+		{name: "plain", lines: []string{"a", "b"}, first: 7, want: "a\nb"},
+		{name: "numbered", lines: []string{"a", "b"}, first: 9, numbered: true, want: "   9: a\n  10: b"},
+		{name: "empty", lines: nil, first: 1, numbered: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Format(tt.lines, tt.first, tt.numbered); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEdit(t *testing.T) {
+	const text = "one\ntwo\nthree"
+	tests := []struct {
+		name       string
+		start, end int
+		content    string
+		operation  string
+		want       string
+		wantErr    bool
+	}{
+		{name: "replace a line", start: 2, end: 2, content: "TWO", operation: Replace, want: "one\nTWO\nthree"},
+		{name: "replace a range", start: 1, end: 2, content: "x", operation: Replace, want: "x\nthree"},
+		{name: "replace past the end", start: 3, end: 9, content: "x\ny", operation: Replace, want: "one\ntwo\nx\ny"},
+		{name: "insert before", start: 1, end: 1, content: "zero", operation: InsertBefore, want: "zero\none\ntwo\nthree"},
+		{name: "insert after", start: 2, end: 2, content: "2.5", operation: InsertAfter, want: "one\ntwo\n2.5\nthree"},
+		{name: "insert after the last line", start: 3, end: 3, content: "four", operation: InsertAfter, want: "one\ntwo\nthree\nfour"},
+		{name: "append after the text", start: 4, end: 4, content: "four", operation: Replace, want: "one\ntwo\nthree\nfour"},
+		{name: "start past the text", start: 5, end: 5, content: "x", operation: Replace, wantErr: true},
+		{name: "start below 1", start: 0, end: 1, content: "x", operation: Replace, wantErr: true},
+		{name: "end before start", start: 3, end: 2, content: "x", operation: Replace, wantErr: true},
+		{name: "unknown operation", start: 1, end: 1, content: "x", operation: "delete", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Edit(text, tt.start, tt.end, tt.content, tt.operation)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Edit(%d, %d, %s) = %q, want an error", tt.start, tt.end, tt.operation, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Edit(%d, %d, %s): %v", tt.start, tt.end, tt.operation, err)
+			}
+			if got != tt.want {
+				t.Errorf("Edit(%d, %d, %s) = %q, want %q", tt.start, tt.end, tt.operation, got, tt.want)
+			}
+		})
+	}
+}
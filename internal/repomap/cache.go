@@ -0,0 +1,83 @@
+package repomap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion changes whenever the cached format or symbol extraction does,
+// so stale caches are rebuilt instead of misread
+const cacheVersion = 1
+
+// cacheFile is the on-disk form of a map
+type cacheFile struct {
+	Version int     `json:"version"`
+	Root    string  `json:"root"`
+	Files   []*File `json:"files"`
+}
+
+// CacheDir returns the directory holding repository map caches.
+func CacheDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = os.TempDir()
+	}
+	return filepath.Join(homeDir, ".open-coder", "cache", "repomap")
+}
+
+// cachePath returns the cache file for a repository root
+func cachePath(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(CacheDir(), hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadCache reads the cached files of root, keyed by relative path. A missing
+// or unreadable cache is treated as empty.
+func loadCache(root string) map[string]*File {
+	data, err := os.ReadFile(cachePath(root))
+	if err != nil {
+		return nil
+	}
+
+	var cache cacheFile
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Version != cacheVersion || cache.Root != root {
+		return nil
+	}
+
+	files := make(map[string]*File, len(cache.Files))
+	for _, f := range cache.Files {
+		files[f.Path] = f
+	}
+	return files
+}
+
+// saveCache writes the map of root to disk. Failures are ignored; the cache
+// only saves work.
+func saveCache(root string, files []*File) {
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Root: root, Files: files})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(CacheDir(), 0755); err != nil {
+		return
+	}
+
+	// Write atomically so concurrent builds never read a partial file
+	path := cachePath(root)
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".repomap-*")
+	if err != nil {
+		return
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,371 @@
+// Package repomap builds a compact, ranked overview of a repository: its
+// ignore-aware file tree with sizes and languages and the top-level symbols
+// of each file, trimmed to a token budget.
+package repomap
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"open-coder/internal/fsutil"
+)
+
+// DefaultTokenBudget is used when Render is given no budget.
+const DefaultTokenBudget = 2000
+
+// DefaultMaxFiles is used when Options.MaxFiles is zero.
+const DefaultMaxFiles = 20000
+
+// maxParseSize is the largest file whose symbols are extracted.
+const maxParseSize = 1024 * 1024
+
+// maxSymbolsPerFile bounds how many symbols a file shows in the map.
+const maxSymbolsPerFile = 12
+
+// Options controls Build.
+type Options struct {
+	// Root is the directory to map; it defaults to the working directory.
+	Root string
+	// MaxFiles stops the walk after this many files.
+	MaxFiles int
+	// NoCache disables reading and writing the on-disk cache.
+	NoCache bool
+}
+
+// Symbol is a top-level declaration in a file.
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+	Line      int    `json:"line"`
+}
+
+// File is one file of the map.
+type File struct {
+	Path     string   `json:"path"` // slash-separated, relative to the root
+	Size     int64    `json:"size"`
+	ModTime  int64    `json:"mod_time"` // Unix nanoseconds, for cache invalidation
+	Language string   `json:"language,omitempty"`
+	Symbols  []Symbol `json:"symbols,omitempty"`
+	Uses     []string `json:"uses,omitempty"` // distinct identifiers the file mentions
+	score    float64
+}
+
+// Map is a built repository map.
+type Map struct {
+	Root      string
+	Files     []*File // sorted by directory, then name
+	Truncated bool    // the walk stopped at MaxFiles
+	BuiltAt   time.Time
+}
+
+// Build walks the repository and extracts symbols, reusing cached entries
+// for files whose size and modification time are unchanged.
+func Build(opts Options) (*Map, error) {
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	maxFiles := opts.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+
+	var cached map[string]*File
+	if !opts.NoCache {
+		cached = loadCache(root)
+	}
+
+	m := &Map{Root: root, BuiltAt: time.Now()}
+	changed := false
+	err = fsutil.Walk(root, fsutil.WalkOptions{}, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if len(m.Files) >= maxFiles {
+			m.Truncated = true
+			return filepath.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if f, ok := cached[rel]; ok && f.Size == info.Size() && f.ModTime == info.ModTime().UnixNano() {
+			m.Files = append(m.Files, f)
+			return nil
+		}
+
+		f := &File{Path: rel, Size: info.Size(), ModTime: info.ModTime().UnixNano(), Language: languageOf(rel)}
+		if f.Language == "" && fsutil.IsBinaryFile(p) {
+			f.Language = "binary"
+		}
+		if f.Language != "" && f.Language != "binary" && f.Size <= maxParseSize {
+			if content, err := os.ReadFile(p); err == nil {
+				f.Symbols, f.Uses = extractSymbols(f.Language, rel, content)
+			}
+		}
+		m.Files = append(m.Files, f)
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Group files by directory so the rendered tree lists each directory once
+	sort.Slice(m.Files, func(i, j int) bool {
+		di, dj := path.Dir(m.Files[i].Path), path.Dir(m.Files[j].Path)
+		if di != dj {
+			return di < dj
+		}
+		return m.Files[i].Path < m.Files[j].Path
+	})
+	if !opts.NoCache && (changed || len(cached) != len(m.Files)) {
+		saveCache(root, m.Files)
+	}
+	return m, nil
+}
+
+// rank scores every file: files whose symbols are used by many other files,
+// entry points and shallow files rank highest; tests and generated or vendored
+// code rank lowest. It returns how many files mention each identifier.
+func (m *Map) rank() map[string]int {
+	// How many files mention each identifier
+	usedBy := make(map[string]int)
+	for _, f := range m.Files {
+		for _, u := range f.Uses {
+			usedBy[u]++
+		}
+	}
+
+	for _, f := range m.Files {
+		score := 1.0
+		for _, s := range f.Symbols {
+			// A file always mentions its own symbols
+			if n := usedBy[s.Name] - 1; n > 0 {
+				score += math.Log2(float64(n) + 1)
+			}
+		}
+		score += 0.25 * float64(len(f.Symbols))
+
+		base := path.Base(f.Path)
+		if importantFiles[strings.ToLower(base)] {
+			score += 20
+		}
+		if strings.HasPrefix(base, "main.") || strings.HasPrefix(base, "index.") {
+			score += 5
+		}
+		if isTestFile(f.Path) {
+			score *= 0.3
+		}
+		if f.Language == "" || f.Language == "binary" {
+			score *= 0.2
+		}
+		score /= 1 + 0.3*float64(strings.Count(f.Path, "/"))
+		f.score = score
+	}
+	return usedBy
+}
+
+// importantFiles are always worth showing near the top of the budget
+var importantFiles = map[string]bool{
+	"readme.md": true, "go.mod": true, "package.json": true, "cargo.toml": true,
+	"pyproject.toml": true, "setup.py": true, "makefile": true, "dockerfile": true,
+	"pom.xml": true, "build.gradle": true, "requirements.txt": true,
+}
+
+// isTestFile reports whether a path looks like test code
+func isTestFile(p string) bool {
+	base := path.Base(p)
+	return strings.HasSuffix(base, "_test.go") || strings.HasPrefix(base, "test_") ||
+		strings.Contains(base, ".test.") || strings.Contains(base, ".spec.") ||
+		strings.Contains(p, "/testdata/") || strings.HasPrefix(p, "testdata/")
+}
+
+// estimateTokens approximates how many tokens a string costs
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// selection is a file chosen for rendering and how much of it to show
+type selection struct {
+	file   *File
+	ranked []Symbol // candidate symbols, most used first
+	shown  int      // how many of ranked are shown
+}
+
+// fileShare is the part of the budget spent on file lines before any symbols,
+// so large repositories show breadth rather than a few files in depth
+const fileShare = 0.4
+
+// Render returns the map trimmed to roughly budget tokens. Files are picked
+// by rank, then their most used symbols are added round-robin while the budget
+// lasts, and everything is printed as a tree in path order.
+func (m *Map) Render(budget int) string {
+	if budget <= 0 {
+		budget = DefaultTokenBudget
+	}
+	usedBy := m.rank()
+
+	ranked := make([]*File, len(m.Files))
+	copy(ranked, m.Files)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+
+	header := fmt.Sprintf("Repository map of %s (%d files", filepath.Base(m.Root), len(m.Files))
+	if m.Truncated {
+		header += ", more not scanned"
+	}
+	header += "):\n"
+	remaining := budget - estimateTokens(header) - 20 // reserve room for the footer
+
+	// Files first, up to their share of the budget
+	fileBudget := int(float64(remaining) * fileShare)
+	var chosen []*selection
+	dirs := make(map[string]bool)
+	for _, f := range ranked {
+		cost := estimateTokens(fileLine(f, 1))
+		dir := path.Dir(f.Path)
+		if dir != "." && !dirs[dir] {
+			cost += estimateTokens(dir + "/\n")
+		}
+		if cost > fileBudget {
+			if fileBudget < 10 {
+				break
+			}
+			continue
+		}
+		fileBudget -= cost
+		remaining -= cost
+		dirs[dir] = true
+		chosen = append(chosen, &selection{file: f, ranked: rankSymbols(f.Symbols, usedBy)})
+	}
+
+	// Then symbols, one per file per round in file rank order
+	for round := 0; round < maxSymbolsPerFile; round++ {
+		added := false
+		for _, sel := range chosen {
+			if round >= len(sel.ranked) {
+				continue
+			}
+			cost := estimateTokens(symbolLine(sel.ranked[round], 2))
+			if round == 0 && len(sel.ranked) > 1 {
+				cost += 4 // the "… N more" line
+			}
+			if cost > remaining {
+				continue
+			}
+			remaining -= cost
+			sel.shown++
+			added = true
+		}
+		if !added {
+			break
+		}
+	}
+
+	byPath := make(map[string]*selection, len(chosen))
+	for _, sel := range chosen {
+		byPath[sel.file.Path] = sel
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	lastDir := ""
+	for _, f := range m.Files {
+		sel, ok := byPath[f.Path]
+		if !ok {
+			continue
+		}
+		depth := 0
+		if dir := path.Dir(f.Path); dir != "." {
+			if dir != lastDir {
+				b.WriteString(dir + "/\n")
+				lastDir = dir
+			}
+			depth = 1
+		} else {
+			lastDir = ""
+		}
+		b.WriteString(fileLine(f, depth))
+		for _, s := range sel.symbols() {
+			b.WriteString(symbolLine(s, depth+1))
+		}
+		if omitted := len(f.Symbols) - sel.shown; omitted > 0 && sel.shown > 0 {
+			fmt.Fprintf(&b, "%s… %d more\n", strings.Repeat("  ", depth+1), omitted)
+		}
+	}
+	if hidden := len(m.Files) - len(chosen); hidden > 0 {
+		fmt.Fprintf(&b, "(%d less relevant files not shown)\n", hidden)
+	}
+	return b.String()
+}
+
+// rankSymbols orders symbols by how many files use them, keeping source order
+// among equals
+func rankSymbols(symbols []Symbol, usedBy map[string]int) []Symbol {
+	out := make([]Symbol, len(symbols))
+	copy(out, symbols)
+	sort.SliceStable(out, func(a, b int) bool {
+		return usedBy[out[a].Name] > usedBy[out[b].Name]
+	})
+	return out
+}
+
+// symbols returns the shown symbols in source order
+func (s *selection) symbols() []Symbol {
+	out := make([]Symbol, s.shown)
+	copy(out, s.ranked[:s.shown])
+	sort.Slice(out, func(a, b int) bool { return out[a].Line < out[b].Line })
+	return out
+}
+
+// fileLine formats a file entry
+func fileLine(f *File, depth int) string {
+	line := strings.Repeat("  ", depth) + path.Base(f.Path) + " ("
+	if f.Language != "" {
+		line += f.Language + ", "
+	}
+	return line + formatSize(f.Size) + ")\n"
+}
+
+// symbolLine formats a symbol entry
+func symbolLine(s Symbol, depth int) string {
+	text := s.Signature
+	if text == "" {
+		text = s.Kind + " " + s.Name
+	}
+	return fmt.Sprintf("%s%s\n", strings.Repeat("  ", depth), text)
+}
+
+// formatSize formats a byte count for display
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
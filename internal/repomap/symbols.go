@@ -0,0 +1,237 @@
+package repomap
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxUses bounds the identifiers recorded per file
+const maxUses = 2000
+
+// languages maps file extensions to language names
+var languages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".jsx": "javascript",
+	".mjs": "javascript", ".cjs": "javascript", ".ts": "typescript", ".tsx": "typescript",
+	".rs": "rust", ".java": "java", ".kt": "kotlin", ".c": "c", ".h": "c",
+	".cpp": "cpp", ".cc": "cpp", ".hpp": "cpp", ".cs": "csharp", ".rb": "ruby",
+	".php": "php", ".swift": "swift", ".sh": "shell", ".bash": "shell",
+	".md": "markdown", ".json": "json", ".yaml": "yaml", ".yml": "yaml",
+	".toml": "toml", ".sql": "sql", ".html": "html", ".css": "css", ".proto": "proto",
+}
+
+// languageOf returns the language of a file from its name
+func languageOf(name string) string {
+	if lang, ok := languages[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+	switch strings.ToLower(path.Base(name)) {
+	case "makefile":
+		return "make"
+	case "dockerfile":
+		return "docker"
+	case "go.mod", "go.sum":
+		return "go"
+	}
+	return ""
+}
+
+// symbolPatterns extract top-level declarations from languages without a
+// native parser; each pattern's first group is the kind and the second the name
+var symbolPatterns = map[string][]*regexp.Regexp{
+	"python": {
+		regexp.MustCompile(`^(class|def|async def)\s+([A-Za-z_]\w*)`),
+	},
+	"javascript": {
+		regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?(?:async\s+)?(function\*?|class)\s+([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`^export\s+(const|let|var)\s+([A-Za-z_$][\w$]*)`),
+	},
+	"typescript": {
+		regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?(?:declare\s+)?(?:abstract\s+)?(?:async\s+)?(function\*?|class|interface|type|enum|namespace)\s+([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`^export\s+(const|let|var)\s+([A-Za-z_$][\w$]*)`),
+	},
+	"rust": {
+		regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:unsafe\s+)?(fn|struct|enum|trait|mod|type|const|static|macro_rules!)\s*([A-Za-z_]\w*)`),
+	},
+	"java": {
+		regexp.MustCompile(`^(?:public\s+|protected\s+)?(?:abstract\s+|final\s+|static\s+)*(class|interface|enum|record)\s+([A-Za-z_]\w*)`),
+	},
+	"kotlin": {
+		regexp.MustCompile(`^(?:(?:public|internal|private|data|sealed|abstract|open)\s+)*(class|interface|object|fun)\s+([A-Za-z_]\w*)`),
+	},
+	"ruby": {
+		regexp.MustCompile(`^(class|module|def)\s+([A-Za-z_][\w:.]*)`),
+	},
+	"shell": {
+		regexp.MustCompile(`^(function)\s+([A-Za-z_][\w-]*)`),
+		regexp.MustCompile(`^()([A-Za-z_][\w-]*)\s*\(\)\s*\{`),
+	},
+}
+
+// identPattern finds identifiers worth counting as references
+var identPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// extractSymbols returns a file's top-level symbols and the identifiers it uses
+func extractSymbols(language, name string, content []byte) ([]Symbol, []string) {
+	switch language {
+	case "go":
+		if strings.HasSuffix(name, ".go") {
+			if symbols, uses, ok := goSymbols(content); ok {
+				return symbols, uses
+			}
+		}
+		return nil, nil
+	case "markdown", "json", "yaml", "toml", "html", "css", "make", "docker", "sql", "proto":
+		return nil, nil
+	}
+
+	var symbols []Symbol
+	if patterns := symbolPatterns[language]; patterns != nil {
+		for i, line := range strings.Split(string(content), "\n") {
+			for _, re := range patterns {
+				if m := re.FindStringSubmatch(line); m != nil {
+					kind := m[1]
+					if kind == "" {
+						kind = "function"
+					}
+					symbols = append(symbols, Symbol{
+						Name:      m[2],
+						Kind:      kind,
+						Signature: signatureLine(line),
+						Line:      i + 1,
+					})
+					break
+				}
+			}
+		}
+	}
+	return symbols, distinctIdents(identPattern.FindAllString(string(content), -1))
+}
+
+// signatureLine trims a declaration line down to its signature
+func signatureLine(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimRight(line, "{:= ")
+	if len(line) > 100 {
+		line = line[:100] + "…"
+	}
+	return line
+}
+
+// goSymbols extracts the top-level declarations of a Go file with go/parser.
+// Unexported constants and variables are left out to keep the map short.
+func goSymbols(content []byte) ([]Symbol, []string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil && file == nil {
+		return nil, nil, false
+	}
+
+	var symbols []Symbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			fn := *d
+			fn.Body, fn.Doc = nil, nil
+			kind := "func"
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				kind = "method"
+			}
+			symbols = append(symbols, Symbol{
+				Name:      d.Name.Name,
+				Kind:      kind,
+				Signature: shorten(nodeString(fset, &fn)),
+				Line:      fset.Position(d.Pos()).Line,
+			})
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					kind := "type"
+					switch sp.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+					}
+					signature := "type " + sp.Name.Name + " " + kind
+					if kind == "type" {
+						signature = shorten("type " + sp.Name.Name + " " + nodeString(fset, sp.Type))
+					}
+					symbols = append(symbols, Symbol{
+						Name:      sp.Name.Name,
+						Kind:      kind,
+						Signature: signature,
+						Line:      fset.Position(sp.Pos()).Line,
+					})
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, n := range sp.Names {
+						if !n.IsExported() {
+							continue
+						}
+						symbols = append(symbols, Symbol{
+							Name:      n.Name,
+							Kind:      kind,
+							Signature: kind + " " + n.Name,
+							Line:      fset.Position(n.Pos()).Line,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	var idents []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && len(id.Name) > 2 {
+			idents = append(idents, id.Name)
+		}
+		return true
+	})
+	return symbols, distinctIdents(idents), true
+}
+
+// nodeString prints an AST node as Go source
+func nodeString(fset *token.FileSet, node any) string {
+	var b strings.Builder
+	if err := printer.Fprint(&b, fset, node); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// shorten collapses a snippet to one line of bounded length
+func shorten(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 120 {
+		s = s[:120] + "…"
+	}
+	return s
+}
+
+// distinctIdents deduplicates identifiers, keeping at most maxUses
+func distinctIdents(idents []string) []string {
+	seen := make(map[string]bool, len(idents))
+	out := make([]string, 0, len(idents))
+	for _, id := range idents {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	if len(out) > maxUses {
+		out = out[:maxUses]
+	}
+	return out
+}
@@ -4,18 +4,27 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/openai/openai-go/v2"
 	"github.com/openai/openai-go/v2/option"
 	"github.com/pterm/pterm"
 	"github.com/pterm/pterm/putils"
+
+	"open-coder/engine"
+	"open-coder/internal/repomap"
 )
 
 // Config represents the application configuration
@@ -23,6 +32,29 @@ type Config struct {
 	APIKey  string `json:"api_key"`
 	BaseURL string `json:"base_url"`
 	Model   string `json:"model"`
+	// RepoMapTokens sizes the repository map added to the system prompt;
+	// 0 uses the default budget and a negative value disables the map
+	RepoMapTokens int `json:"repo_map_tokens,omitempty"`
+	// MaxParallelTools bounds how many tool calls run at once (default 4)
+	MaxParallelTools int `json:"max_parallel_tools,omitempty"`
+	// SerialServers lists MCP servers whose tool calls must not overlap;
+	// when unset, the terminal server is serialized
+	SerialServers []string `json:"serial_servers,omitempty"`
+	// MaxRetries is how often a failed completion is retried on each
+	// provider (default 3); a negative value disables retries
+	MaxRetries int `json:"max_retries,omitempty"`
+	// Fallbacks are tried in order once the primary provider keeps failing
+	Fallbacks []FallbackProvider `json:"fallbacks,omitempty"`
+	// TurnLimits stop runaway tool loops within one user message
+	TurnLimits *engine.TurnLimits `json:"turn_limits,omitempty"`
+	// SubAgentModel is the default model of delegate_task sub-agents;
+	// empty uses the main model
+	SubAgentModel string `json:"subagent_model,omitempty"`
+	// AskUserFallback answers the model's questions when stdin is not a
+	// terminal; empty tells it to decide itself
+	AskUserFallback string `json:"ask_user_fallback,omitempty"`
+	// Preferences holds the settings menu choices; see Preferences
+	Preferences json.RawMessage `json:"preferences,omitempty"`
 }
 
 // getConfigPath returns the path to the configuration file
@@ -40,7 +72,7 @@ func loadConfig() (*Config, error) {
 
 	// Check if config file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("config file not found")
+		return nil, fmt.Errorf("config file not found: %w", err)
 	}
 
 	data, err := os.ReadFile(configPath)
@@ -78,24 +110,28 @@ func saveConfig(config *Config) error {
 	return nil
 }
 
-// getConfiguration gets configuration from environment variables, config file, or prompts user
-func getConfiguration() (*Config, error) {
+// getConfiguration gets configuration from environment variables, config
+// file, or, when interactive, prompts the user. Otherwise missing settings
+// are an error, since stdin may carry another program's messages.
+func getConfiguration(interactive bool) (*Config, error) {
 	// First priority: environment variables
 	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
 	baseURL := strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
 	model := strings.TrimSpace(os.Getenv("OPENAI_MODEL"))
 
-	// If all environment variables are set, use them
+	// Second priority: config file
+	config, err := loadConfig()
+
+	// If all environment variables are set, use them; other settings still
+	// come from the config file when there is one
 	if apiKey != "" && baseURL != "" && model != "" {
-		return &Config{
-			APIKey:  apiKey,
-			BaseURL: baseURL,
-			Model:   model,
-		}, nil
+		if err != nil {
+			config = &Config{}
+		}
+		config.APIKey, config.BaseURL, config.Model = apiKey, baseURL, model
+		return config, nil
 	}
 
-	// Second priority: config file
-	config, err := loadConfig()
 	if err == nil {
 		// Override with environment variables if they exist
 		if apiKey != "" {
@@ -107,20 +143,43 @@ func getConfiguration() (*Config, error) {
 		if model != "" {
 			config.Model = model
 		}
-		return config, nil
+		if config.APIKey != "" && config.BaseURL != "" && config.Model != "" {
+			return config, nil
+		}
+		// The file may hold only preferences; ask for what is missing
+		apiKey, baseURL, model = config.APIKey, config.BaseURL, config.Model
+	} else {
+		config = &Config{}
+	}
+
+	if !interactive {
+		var missing []string
+		for _, setting := range []struct{ value, env, field string }{
+			{apiKey, "OPENAI_API_KEY", "api_key"},
+			{baseURL, "OPENAI_BASE_URL", "base_url"},
+			{model, "OPENAI_MODEL", "model"},
+		} {
+			if setting.value == "" {
+				missing = append(missing, fmt.Sprintf("%s (or %q in %s)", setting.env, setting.field, getConfigPath()))
+			}
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("missing settings: %s (%w)", strings.Join(missing, ", "), err)
+		}
+		return nil, fmt.Errorf("missing settings: %s", strings.Join(missing, ", "))
 	}
 
 	// Third priority: prompt user (first time setup)
-	pterm.FgLightYellow.Println("🔧 First-time setup - Please provide your OpenAI configuration:")
-	pterm.FgLightWhite.Println("This will be saved to ~/.open-coder/config for future use.")
-	pterm.FgLightWhite.Println("You can also set these as environment variables to override the saved config.")
-	pterm.FgLightWhite.Println()
+	ui.warning.Println("🔧 First-time setup - Please provide your OpenAI configuration:")
+	ui.text.Println("This will be saved to ~/.open-coder/config for future use.")
+	ui.text.Println("You can also set these as environment variables to override the saved config.")
+	ui.text.Println()
 
 	reader := bufio.NewReader(os.Stdin)
 
 	// Prompt for API key if not set
 	if apiKey == "" {
-		pterm.FgLightWhite.Print("API Key: ")
+		ui.text.Print("API Key: ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, fmt.Errorf("failed to read API key: %w", err)
@@ -130,7 +189,7 @@ func getConfiguration() (*Config, error) {
 
 	// Prompt for base URL if not set
 	if baseURL == "" {
-		pterm.FgLightWhite.Print("Base URL: ")
+		ui.text.Print("Base URL: ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, fmt.Errorf("failed to read base URL: %w", err)
@@ -140,7 +199,7 @@ func getConfiguration() (*Config, error) {
 
 	// Prompt for model if not set
 	if model == "" {
-		pterm.FgLightWhite.Print("Model: ")
+		ui.text.Print("Model: ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, fmt.Errorf("failed to read model: %w", err)
@@ -148,18 +207,14 @@ func getConfiguration() (*Config, error) {
 		model = strings.TrimSpace(input)
 	}
 
-	config = &Config{
-		APIKey:  apiKey,
-		BaseURL: baseURL,
-		Model:   model,
-	}
+	config.APIKey, config.BaseURL, config.Model = apiKey, baseURL, model
 
 	// Save configuration for future use
 	if err := saveConfig(config); err != nil {
-		pterm.FgLightYellow.Printf("⚠️  Warning: Could not save configuration: %v\n", err)
-		pterm.FgLightYellow.Println("You'll need to provide configuration on each run or set environment variables.")
+		ui.warning.Printf("⚠️  Warning: Could not save configuration: %v\n", err)
+		ui.warning.Println("You'll need to provide configuration on each run or set environment variables.")
 	} else {
-		pterm.FgLightGreen.Println("✅ Configuration saved! You won't be prompted again.")
+		ui.success.Println("✅ Configuration saved! You won't be prompted again.")
 	}
 
 	return config, nil
@@ -180,18 +235,49 @@ type SimpleAgent struct {
 	baseURL        string // Store base URL for settings access
 	userID         string
 	systemPrompt   string
-	messages       []openai.ChatCompletionMessageParamUnion
 	tools          []openai.ChatCompletionToolUnionParam
-	assistantColor string // Color for assistant text output
-	userColor      string // Color for user input text
-	systemColor    string // Color for system messages
-	toolColor      string // Color for tool output
-	errorColor     string // Color for error messages
-	showTimestamps bool   // Show timestamps in messages
-	autoSaveChat   bool   // Auto-save conversations
-	compactMode    bool   // Compact display mode
-	currentDir     string // Current working directory for file browser
-	showHidden     bool   // Show hidden files in file browser
+	theme          string             // Name of the active theme
+	emitter        func(engine.Event) // Receives the events of the running turn
+	assistantColor string             // Color for assistant text output; empty uses the theme's
+	userColor      string             // Color for user input text; empty uses the theme's
+	systemColor    string             // Color for system messages; empty uses the theme's
+	toolColor      string             // Color for tool output; empty uses the theme's
+	errorColor     string             // Color for error messages; empty uses the theme's
+	showTimestamps bool               // Show timestamps in messages
+	autoSaveChat   bool               // Auto-save conversations
+	compactMode    bool               // Compact display mode
+	currentDir     string             // Current working directory for file browser
+	showHidden     bool               // Show hidden files in file browser
+	fuzzyMentions  bool               // Offer to complete @ mentions of paths that do not exist
+
+	// Tool execution
+	toolServers   map[string]*MCPServerConfig // Tool name -> server providing it
+	toolSchemas   map[string]map[string]any   // Tool name -> parameter schema
+	serialServers map[string]bool             // Servers whose calls run one at a time
+
+	// Turns: the conversation, providers, retries and limits
+	engine *engine.Engine
+
+	// Plan mode
+	planMode      bool            // Only read-only tools are offered
+	readOnlyTools map[string]bool // Tool name -> classified as read-only
+
+	subAgentModel string // Default model for delegate_task sub-agents
+
+	builtins        []BuiltinTool // Tools provided by the agent itself
+	askUserFallback string        // ask_user answer when stdin is not a terminal
+
+	// inDir runs work that resolves paths against the working directory,
+	// with the process in the agent's directory. It is set when one process
+	// serves several directories; nil runs the work where the process is.
+	inDir func(fn func())
+
+	// Session state
+	todos          *todoList  // The model's todo list
+	sessionID      string     // Name of the saved session file
+	sessionStarted time.Time  // When the session began
+	sessionSaved   bool       // The session file exists
+	sessionMu      sync.Mutex // Serializes session saves
 }
 
 type MCPServerConfig struct {
@@ -199,15 +285,18 @@ type MCPServerConfig struct {
 	Command string
 	Args    []string
 	Session *mcp.ClientSession
+	Serial  bool       // Run one tool call at a time on this server
+	mu      sync.Mutex // Held during calls when Serial is set
 }
 
 func NewSimpleAgent(ctx context.Context, model string, apiKey string, baseURL string) *SimpleAgent {
 	openaiClient := openai.NewClient(
 		option.WithAPIKey(apiKey),
 		option.WithBaseURL(baseURL),
+		option.WithMaxRetries(0), // The engine retries with its own backoff
 	)
 
-	return &SimpleAgent{
+	agent := &SimpleAgent{
 		ctx:            ctx,
 		mcpClient:      mcp.NewClient(&mcp.Implementation{Name: "simple-agent", Version: "v1.0.0"}, nil),
 		servers:        make([]*MCPServerConfig, 0),
@@ -216,109 +305,113 @@ func NewSimpleAgent(ctx context.Context, model string, apiKey string, baseURL st
 		apiKey:         apiKey,    // Store API key for settings access
 		baseURL:        baseURL,   // Store base URL for settings access
 		userID:         "user123", // Simple user ID for demo
-		messages:       make([]openai.ChatCompletionMessageParamUnion, 0),
 		tools:          make([]openai.ChatCompletionToolUnionParam, 0),
-		assistantColor: "FgLightCyan",  // Default color for assistant text
-		userColor:      "FgLightWhite", // Default color for user text
-		systemColor:    "FgLightBlue",  // Default color for system messages
-		toolColor:      "FgLightGreen", // Default color for tool output
-		errorColor:     "FgLightRed",   // Default color for errors
-		showTimestamps: false,          // Don't show timestamps by default
-		autoSaveChat:   false,          // Don't auto-save by default
-		compactMode:    false,          // Normal display mode by default
-		currentDir:     "",             // Will be set to current working directory
-		showHidden:     false,          // Don't show hidden files by default
+		toolServers:    make(map[string]*MCPServerConfig),
+		toolSchemas:    make(map[string]map[string]any),
+		serialServers:  make(map[string]bool),
+		theme:          defaultThemeName, // Colors come from the theme unless overridden
+		showTimestamps: false,            // Don't show timestamps by default
+		autoSaveChat:   false,            // Don't auto-save by default
+		compactMode:    false,            // Normal display mode by default
+		currentDir:     "",               // Will be set to current working directory
+		showHidden:     false,            // Don't show hidden files by default
+		builtins:       defaultBuiltinTools(),
+		todos:          &todoList{},
+		sessionID:      newSessionID(),
+		sessionStarted: time.Now(),
 	}
+
+	agent.useEngine(engine.Config{Providers: agent.providers(nil)})
+
+	// Apply the settings saved from the settings menu
+	agent.loadPreferences()
+	return agent
 }
 
 // InitConversation initializes a new conversation with a system prompt.
 func (a *SimpleAgent) InitConversation(system string) {
 	a.systemPrompt = system
-	a.messages = []openai.ChatCompletionMessageParamUnion{openai.SystemMessage(system)}
+	a.engine.Reset(system)
+
+	// Carry an unfinished todo list into the new conversation
+	if reminder := a.todoReminder(); reminder != "" {
+		a.engine.Messages = append(a.engine.Messages, openai.SystemMessage(reminder))
+	}
 }
 
-// getColorStyle returns the pterm color style for any stored color preference
-func (a *SimpleAgent) getColorStyle(colorName string) pterm.Color {
-	switch colorName {
-	case "FgLightCyan":
-		return pterm.FgLightCyan
-	case "FgCyan":
-		return pterm.FgCyan
-	case "FgLightBlue":
-		return pterm.FgLightBlue
-	case "FgBlue":
-		return pterm.FgBlue
-	case "FgLightGreen":
-		return pterm.FgLightGreen
-	case "FgGreen":
-		return pterm.FgGreen
-	case "FgLightYellow":
-		return pterm.FgLightYellow
-	case "FgYellow":
-		return pterm.FgYellow
-	case "FgLightRed":
-		return pterm.FgLightRed
-	case "FgRed":
-		return pterm.FgRed
-	case "FgLightMagenta":
-		return pterm.FgLightMagenta
-	case "FgMagenta":
-		return pterm.FgMagenta
-	case "FgLightWhite":
-		return pterm.FgLightWhite
-	case "FgWhite":
-		return pterm.FgWhite
-	case "FgBlack":
-		return pterm.FgBlack
-	case "FgGray":
-		return pterm.FgGray
-	default:
-		return pterm.FgLightCyan // Default fallback
+// AttachRepoMap adds a map of the repository in the working directory to the
+// system prompt so the model starts with an overview of the project. The map
+// is skipped in the home and root directories, which are rarely projects.
+func (a *SimpleAgent) AttachRepoMap(budget int) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if homeDir, _ := os.UserHomeDir(); wd == homeDir || wd == filepath.Dir(wd) {
+		return nil
+	}
+
+	m, err := repomap.Build(repomap.Options{Root: wd})
+	if err != nil {
+		return fmt.Errorf("failed to build repository map: %w", err)
 	}
+	if len(m.Files) == 0 {
+		return nil
+	}
+
+	a.InitConversation(a.systemPrompt + "\n\nHere is a map of the repository in the current directory (" + wd + "). " +
+		"Use it to decide which files to read; call the repo_map tool for a larger or refreshed map.\n\n" + m.Render(budget))
+	return nil
 }
 
-// getAssistantColorStyle returns the pterm color style for assistant text
-func (a *SimpleAgent) getAssistantColorStyle() pterm.Color {
-	return a.getColorStyle(a.assistantColor)
+// getAssistantColorStyle returns the style for assistant text
+func (a *SimpleAgent) getAssistantColorStyle() Style {
+	return roleStyle(a.assistantColor, ui.assistant)
 }
 
-// getUserColorStyle returns the pterm color style for user input text
-func (a *SimpleAgent) getUserColorStyle() pterm.Color {
-	return a.getColorStyle(a.userColor)
+// getUserColorStyle returns the style for user input text
+func (a *SimpleAgent) getUserColorStyle() Style {
+	return roleStyle(a.userColor, ui.user)
 }
 
-// getSystemColorStyle returns the pterm color style for system messages
-func (a *SimpleAgent) getSystemColorStyle() pterm.Color {
-	return a.getColorStyle(a.systemColor)
+// getSystemColorStyle returns the style for system messages
+func (a *SimpleAgent) getSystemColorStyle() Style {
+	return roleStyle(a.systemColor, ui.system)
 }
 
-// getToolColorStyle returns the pterm color style for tool output
-func (a *SimpleAgent) getToolColorStyle() pterm.Color {
-	return a.getColorStyle(a.toolColor)
+// getToolColorStyle returns the style for tool output
+func (a *SimpleAgent) getToolColorStyle() Style {
+	return roleStyle(a.toolColor, ui.tool)
 }
 
-// getErrorColorStyle returns the pterm color style for error messages
-func (a *SimpleAgent) getErrorColorStyle() pterm.Color {
-	return a.getColorStyle(a.errorColor)
+// getErrorColorStyle returns the style for error messages
+func (a *SimpleAgent) getErrorColorStyle() Style {
+	return roleStyle(a.errorColor, ui.errorText)
+}
+
+// getToolBorderStyle returns the style for the borders of tool boxes, which
+// follow the tool color when one is chosen
+func (a *SimpleAgent) getToolBorderStyle() Style {
+	return roleStyle(a.toolColor, ui.toolBorder)
 }
 
 // showSettingsMenu displays an interactive settings menu for the user
 func (a *SimpleAgent) showSettingsMenu() error {
 	for {
-		pterm.FgLightWhite.Println("\n" + strings.Repeat("═", 50))
-		pterm.FgLightCyan.Println("⚙️  SETTINGS")
-		pterm.FgLightWhite.Println(strings.Repeat("─", 50))
+		ui.text.Println("\n" + strings.Repeat("═", 50))
+		ui.title.Println("⚙️  SETTINGS")
+		ui.text.Println(strings.Repeat("─", 50))
 
-		pterm.FgLightWhite.Println("Choose a category:")
-		pterm.FgLightWhite.Println("1. 🎨 Appearance (Colors)")
-		pterm.FgLightWhite.Println("2. 🖥️  Display Options")
-		pterm.FgLightWhite.Println("3. 💾 Chat Behavior")
-		pterm.FgLightWhite.Println("4. 🔌 MCP Server Settings")
-		pterm.FgLightWhite.Println("5. ⚙️  Configuration (API, URL, Model)")
-		pterm.FgLightWhite.Println("\n0. Back to Chat")
-		pterm.FgLightWhite.Println(strings.Repeat("─", 50))
+		ui.text.Println("Choose a category:")
+		ui.text.Println("1. 🎨 Appearance (Colors)")
+		ui.text.Println("2. 🖥️  Display Options")
+		ui.text.Println("3. 💾 Chat Behavior")
+		ui.text.Println("4. 🔌 MCP Server Settings")
+		ui.text.Println("5. ⚙️  Configuration (API, URL, Model)")
+		ui.text.Println("\n0. Back to Chat")
+		ui.text.Println(strings.Repeat("─", 50))
 
-		pterm.FgLightWhite.Print("Enter your choice (0-5): ")
+		ui.text.Print("Enter your choice (0-5): ")
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -328,37 +421,37 @@ func (a *SimpleAgent) showSettingsMenu() error {
 
 		input = strings.TrimSpace(input)
 		if input == "0" {
-			pterm.FgLightWhite.Println("Returning to chat...")
+			ui.text.Println("Returning to chat...")
 			return nil
 		}
 
 		var choice int
 		_, err = fmt.Sscanf(input, "%d", &choice)
 		if err != nil || choice < 0 || choice > 5 {
-			pterm.FgRed.Println("Invalid choice. Please try again.")
+			ui.errorText.Println("Invalid choice. Please try again.")
 			continue
 		}
 
 		switch choice {
 		case 1:
 			if err := a.showAppearanceSettings(); err != nil {
-				pterm.FgRed.Printf("Error in appearance settings: %v\n", err)
+				ui.errorText.Printf("Error in appearance settings: %v\n", err)
 			}
 		case 2:
 			if err := a.showDisplaySettings(); err != nil {
-				pterm.FgRed.Printf("Error in display settings: %v\n", err)
+				ui.errorText.Printf("Error in display settings: %v\n", err)
 			}
 		case 3:
 			if err := a.showChatSettings(); err != nil {
-				pterm.FgRed.Printf("Error in chat settings: %v\n", err)
+				ui.errorText.Printf("Error in chat settings: %v\n", err)
 			}
 		case 4:
 			if err := a.showMCPServerSettings(); err != nil {
-				pterm.FgRed.Printf("Error in MCP settings: %v\n", err)
+				ui.errorText.Printf("Error in MCP settings: %v\n", err)
 			}
 		case 5:
 			if err := a.showConfigurationSettings(); err != nil {
-				pterm.FgRed.Printf("Error in configuration settings: %v\n", err)
+				ui.errorText.Printf("Error in configuration settings: %v\n", err)
 			}
 		}
 	}
@@ -377,19 +470,19 @@ func (a *SimpleAgent) showConfigurationSettings() error {
 		}
 	}
 
-	pterm.FgLightWhite.Println("\n" + strings.Repeat("═", 50))
-	pterm.FgLightCyan.Println("⚙️  CONFIGURATION SETTINGS")
-	pterm.FgLightWhite.Println(strings.Repeat("─", 50))
+	ui.text.Println("\n" + strings.Repeat("═", 50))
+	ui.title.Println("⚙️  CONFIGURATION SETTINGS")
+	ui.text.Println(strings.Repeat("─", 50))
 
 	for {
-		pterm.FgLightWhite.Println("\nCurrent configuration:")
-		pterm.FgLightWhite.Printf("1. API Key: %s\n", maskAPIKey(config.APIKey))
-		pterm.FgLightWhite.Printf("2. Base URL: %s\n", config.BaseURL)
-		pterm.FgLightWhite.Printf("3. Model: %s\n", config.Model)
-		pterm.FgLightWhite.Println("\n4. Reset all configuration")
-		pterm.FgLightWhite.Println("\n0. Back to Settings")
+		ui.text.Println("\nCurrent configuration:")
+		ui.text.Printf("1. API Key: %s\n", maskAPIKey(config.APIKey))
+		ui.text.Printf("2. Base URL: %s\n", config.BaseURL)
+		ui.text.Printf("3. Model: %s\n", config.Model)
+		ui.text.Println("\n4. Reset all configuration")
+		ui.text.Println("\n0. Back to Settings")
 
-		pterm.FgLightWhite.Print("Enter choice (0-4): ")
+		ui.text.Print("Enter choice (0-4): ")
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -405,14 +498,14 @@ func (a *SimpleAgent) showConfigurationSettings() error {
 		var choice int
 		_, err = fmt.Sscanf(input, "%d", &choice)
 		if err != nil || choice < 1 || choice > 4 {
-			pterm.FgRed.Println("Invalid choice. Please try again.")
+			ui.errorText.Println("Invalid choice. Please try again.")
 			continue
 		}
 
 		switch choice {
 		case 1:
 			// Change API Key
-			pterm.FgLightWhite.Print("Enter new API Key: ")
+			ui.text.Print("Enter new API Key: ")
 			newAPIKey, err := reader.ReadString('\n')
 			if err != nil {
 				return err
@@ -420,11 +513,11 @@ func (a *SimpleAgent) showConfigurationSettings() error {
 			newAPIKey = strings.TrimSpace(newAPIKey)
 			if newAPIKey != "" {
 				config.APIKey = newAPIKey
-				pterm.FgLightGreen.Printf("✅ API Key updated to: %s\n", maskAPIKey(config.APIKey))
+				ui.success.Printf("✅ API Key updated to: %s\n", maskAPIKey(config.APIKey))
 			}
 		case 2:
 			// Change Base URL
-			pterm.FgLightWhite.Print("Enter new Base URL: ")
+			ui.text.Print("Enter new Base URL: ")
 			newBaseURL, err := reader.ReadString('\n')
 			if err != nil {
 				return err
@@ -432,11 +525,11 @@ func (a *SimpleAgent) showConfigurationSettings() error {
 			newBaseURL = strings.TrimSpace(newBaseURL)
 			if newBaseURL != "" {
 				config.BaseURL = newBaseURL
-				pterm.FgLightGreen.Printf("✅ Base URL updated to: %s\n", config.BaseURL)
+				ui.success.Printf("✅ Base URL updated to: %s\n", config.BaseURL)
 			}
 		case 3:
 			// Change Model
-			pterm.FgLightWhite.Print("Enter new Model: ")
+			ui.text.Print("Enter new Model: ")
 			newModel, err := reader.ReadString('\n')
 			if err != nil {
 				return err
@@ -444,12 +537,12 @@ func (a *SimpleAgent) showConfigurationSettings() error {
 			newModel = strings.TrimSpace(newModel)
 			if newModel != "" {
 				config.Model = newModel
-				pterm.FgLightGreen.Printf("✅ Model updated to: %s\n", config.Model)
+				ui.success.Printf("✅ Model updated to: %s\n", config.Model)
 			}
 		case 4:
 			// Reset all configuration
-			pterm.FgLightYellow.Println("This will delete your saved configuration and require re-entry on next startup.")
-			pterm.FgLightWhite.Print("Are you sure? (y/N): ")
+			ui.warning.Println("This will delete your saved configuration and require re-entry on next startup.")
+			ui.text.Print("Are you sure? (y/N): ")
 			confirmInput, err := reader.ReadString('\n')
 			if err != nil {
 				return err
@@ -458,23 +551,23 @@ func (a *SimpleAgent) showConfigurationSettings() error {
 			if strings.ToLower(strings.TrimSpace(confirmInput)) == "y" {
 				configPath := getConfigPath()
 				if err := os.Remove(configPath); err != nil && !os.IsNotExist(err) {
-					pterm.FgRed.Printf("Failed to delete config file: %v\n", err)
+					ui.errorText.Printf("Failed to delete config file: %v\n", err)
 				} else {
-					pterm.FgLightGreen.Println("✅ Configuration reset. You'll be prompted for new values on next startup.")
+					ui.success.Println("✅ Configuration reset. You'll be prompted for new values on next startup.")
 				}
 			} else {
-				pterm.FgLightCyan.Println("Reset cancelled.")
+				ui.title.Println("Reset cancelled.")
 			}
 		}
 
 		// Save the updated configuration
 		if err := saveConfig(config); err != nil {
-			pterm.FgLightYellow.Printf("⚠️  Warning: Could not save configuration: %v\n", err)
+			ui.warning.Printf("⚠️  Warning: Could not save configuration: %v\n", err)
 		} else {
-			pterm.FgLightCyan.Println("Configuration saved successfully.")
+			ui.title.Println("Configuration saved successfully.")
 		}
 
-		pterm.FgLightWhite.Println("Press Enter to continue...")
+		ui.text.Println("Press Enter to continue...")
 		reader.ReadString('\n')
 	}
 }
@@ -487,49 +580,44 @@ func maskAPIKey(apiKey string) string {
 	return apiKey[:8] + "****" + apiKey[len(apiKey)-4:]
 }
 
-// showAppearanceSettings handles color customization
+// showAppearanceSettings handles the theme and color customization
 func (a *SimpleAgent) showAppearanceSettings() error {
-	pterm.FgLightWhite.Println("\n" + strings.Repeat("═", 50))
-	pterm.FgLightCyan.Println("🎨 APPEARANCE SETTINGS")
-	pterm.FgLightWhite.Println(strings.Repeat("─", 50))
+	ui.text.Println("\n" + strings.Repeat("═", 50))
+	ui.title.Println("🎨 APPEARANCE SETTINGS")
+	ui.text.Println(strings.Repeat("─", 50))
 
-	colors := []struct {
-		name  string
-		color pterm.Color
+	roles := []struct {
+		label string
+		field *string
 	}{
-		{"Light Cyan", pterm.FgLightCyan},
-		{"Cyan", pterm.FgCyan},
-		{"Light Blue", pterm.FgLightBlue},
-		{"Blue", pterm.FgBlue},
-		{"Light Green", pterm.FgLightGreen},
-		{"Green", pterm.FgGreen},
-		{"Light Yellow", pterm.FgLightYellow},
-		{"Yellow", pterm.FgYellow},
-		{"Light Red", pterm.FgLightRed},
-		{"Red", pterm.FgRed},
-		{"Light Magenta", pterm.FgLightMagenta},
-		{"Magenta", pterm.FgMagenta},
-		{"Light White", pterm.FgLightWhite},
-		{"White", pterm.FgWhite},
-		{"Gray", pterm.FgGray},
-		{"Black", pterm.FgBlack},
+		{"Assistant", &a.assistantColor},
+		{"User Input", &a.userColor},
+		{"System", &a.systemColor},
+		{"Tools", &a.toolColor},
+		{"Errors", &a.errorColor},
+	}
+	styles := []func() Style{
+		a.getAssistantColorStyle,
+		a.getUserColorStyle,
+		a.getSystemColorStyle,
+		a.getToolColorStyle,
+		a.getErrorColorStyle,
 	}
 
 	for {
-		pterm.FgLightWhite.Println("\nChoose text color to customize:")
-		pterm.FgLightWhite.Printf("1. Assistant (%s): ", a.assistantColor)
-		a.getAssistantColorStyle().Println("█████")
-		pterm.FgLightWhite.Printf("2. User Input (%s): ", a.userColor)
-		a.getUserColorStyle().Println("█████")
-		pterm.FgLightWhite.Printf("3. System (%s): ", a.systemColor)
-		a.getSystemColorStyle().Println("█████")
-		pterm.FgLightWhite.Printf("4. Tools (%s): ", a.toolColor)
-		a.getToolColorStyle().Println("█████")
-		pterm.FgLightWhite.Printf("5. Errors (%s): ", a.errorColor)
-		a.getErrorColorStyle().Println("█████")
-		pterm.FgLightWhite.Println("\n0. Back to Settings")
-
-		pterm.FgLightWhite.Print("Enter choice (0-5): ")
+		ui.text.Printf("\n1. 🎭 Theme: %s\n", a.theme)
+		ui.text.Println("\nChoose text color to customize:")
+		for i, role := range roles {
+			color := *role.field
+			if color == "" {
+				color = "theme"
+			}
+			ui.text.Printf("%d. %s (%s): ", i+2, role.label, color)
+			styles[i]().Println("█████")
+		}
+		ui.text.Println("\n0. Back to Settings")
+
+		ui.text.Print("Enter choice (0-6): ")
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -544,19 +632,28 @@ func (a *SimpleAgent) showAppearanceSettings() error {
 
 		var choice int
 		_, err = fmt.Sscanf(input, "%d", &choice)
-		if err != nil || choice < 1 || choice > 5 {
-			pterm.FgRed.Println("Invalid choice. Please try again.")
+		if err != nil || choice < 1 || choice > 6 {
+			ui.errorText.Println("Invalid choice. Please try again.")
+			continue
+		}
+
+		if choice == 1 {
+			if err := a.chooseTheme(reader); err != nil {
+				return err
+			}
 			continue
 		}
 
-		pterm.FgLightWhite.Println("\nAvailable Colors:")
-		for i, color := range colors {
-			pterm.FgLightWhite.Printf("%2d. ", i+1)
-			color.color.Printf("%s", color.name)
-			pterm.FgLightWhite.Println()
+		ui.text.Println("\nAvailable Colors:")
+		for i, name := range colorNames {
+			style, _ := parseStyle(name)
+			ui.text.Printf("%2d. ", i+1)
+			style.Println(name)
 		}
+		ui.text.Printf("%2d. Theme default\n", len(colorNames)+1)
+		ui.text.Printf("%2d. Custom (#rrggbb or 0-255)\n", len(colorNames)+2)
 
-		pterm.FgLightWhite.Print("Choose a color (1-16): ")
+		ui.text.Printf("Choose a color (1-%d): ", len(colorNames)+2)
 		colorInput, err := reader.ReadString('\n')
 		if err != nil {
 			return err
@@ -569,60 +666,108 @@ func (a *SimpleAgent) showAppearanceSettings() error {
 
 		var colorChoice int
 		_, err = fmt.Sscanf(colorInput, "%d", &colorChoice)
-		if err != nil || colorChoice < 1 || colorChoice > len(colors) {
-			pterm.FgRed.Println("Invalid color choice. Please try again.")
+		if err != nil || colorChoice < 1 || colorChoice > len(colorNames)+2 {
+			ui.errorText.Println("Invalid color choice. Please try again.")
 			continue
 		}
 
-		selectedColor := colors[colorChoice-1]
+		var color string
+		switch {
+		case colorChoice <= len(colorNames):
+			color = colorNames[colorChoice-1]
+		case colorChoice == len(colorNames)+2:
+			ui.text.Print("Enter a hex color (#ff8800) or 256-color number (0-255): ")
+			custom, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			color = strings.TrimSpace(custom)
+			if _, err := parseColor(color, false); err != nil {
+				ui.errorText.Printf("Invalid color: %v\n", err)
+				continue
+			}
+		}
 
-		// Map display name to the actual color constant name and update the appropriate field
-		switch choice {
-		case 1:
-			a.assistantColor = a.mapColorName(selectedColor.name)
-			pterm.FgLightGreen.Printf("✅ Assistant text color updated to: ")
-			selectedColor.color.Println(selectedColor.name)
-		case 2:
-			a.userColor = a.mapColorName(selectedColor.name)
-			pterm.FgLightGreen.Printf("✅ User input color updated to: ")
-			selectedColor.color.Println(selectedColor.name)
-		case 3:
-			a.systemColor = a.mapColorName(selectedColor.name)
-			pterm.FgLightGreen.Printf("✅ System message color updated to: ")
-			selectedColor.color.Println(selectedColor.name)
-		case 4:
-			a.toolColor = a.mapColorName(selectedColor.name)
-			pterm.FgLightGreen.Printf("✅ Tool output color updated to: ")
-			selectedColor.color.Println(selectedColor.name)
-		case 5:
-			a.errorColor = a.mapColorName(selectedColor.name)
-			pterm.FgLightGreen.Printf("✅ Error message color updated to: ")
-			selectedColor.color.Println(selectedColor.name)
+		role := roles[choice-2]
+		*role.field = color
+		ui.success.Printf("✅ %s color updated to: ", role.label)
+		if color == "" {
+			color = "theme default"
 		}
+		styles[choice-2]().Println(color)
+		a.persistPreferences()
 
-		pterm.FgLightWhite.Println("Press Enter to continue...")
+		ui.text.Println("Press Enter to continue...")
 		reader.ReadString('\n')
 	}
 }
 
+// chooseTheme lets the user pick one of the built-in or user themes
+func (a *SimpleAgent) chooseTheme(reader *bufio.Reader) error {
+	names := themeNames()
+	user, errs := loadUserThemes()
+	for _, err := range errs {
+		ui.warning.Printf("⚠️  Warning: Skipping theme file %v\n", err)
+	}
+
+	ui.text.Println("\nAvailable Themes:")
+	for i, name := range names {
+		tf, _ := findTheme(name, user)
+		marker := "  "
+		if name == a.theme {
+			marker = "▸ "
+		}
+		ui.text.Printf("%2d. %s%s", i+1, marker, name)
+		if tf.Description != "" {
+			ui.muted.Printf("  %s", tf.Description)
+		}
+		ui.text.Println()
+	}
+	ui.muted.Printf("Add your own as JSON files in %s\n", getThemesDir())
+
+	ui.text.Printf("Choose a theme (1-%d): ", len(names))
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" || input == "0" {
+		return nil
+	}
+
+	var choice int
+	_, err = fmt.Sscanf(input, "%d", &choice)
+	if err != nil || choice < 1 || choice > len(names) {
+		ui.errorText.Println("Invalid theme choice. Please try again.")
+		return nil
+	}
+	if err := a.applyTheme(names[choice-1]); err != nil {
+		ui.errorText.Printf("Could not load theme: %v\n", err)
+		return nil
+	}
+	a.persistPreferences()
+	ui.success.Printf("✅ Theme changed to %s\n", a.theme)
+	return nil
+}
+
 // showDisplaySettings handles display-related options
 func (a *SimpleAgent) showDisplaySettings() error {
-	pterm.FgLightWhite.Println("\n" + strings.Repeat("═", 50))
-	pterm.FgLightCyan.Println("🖥️  DISPLAY SETTINGS")
-	pterm.FgLightWhite.Println(strings.Repeat("─", 50))
+	ui.text.Println("\n" + strings.Repeat("═", 50))
+	ui.title.Println("🖥️  DISPLAY SETTINGS")
+	ui.text.Println(strings.Repeat("─", 50))
 
 	for {
-		pterm.FgLightWhite.Println("\nCurrent settings:")
+		ui.text.Println("\nCurrent settings:")
 		modeStr := "Normal"
 		if a.compactMode {
 			modeStr = "Compact"
 		}
-		pterm.FgLightWhite.Printf("1. Display Mode: %s\n", modeStr)
-		pterm.FgLightWhite.Printf("2. Show Timestamps: %t\n", a.showTimestamps)
-		pterm.FgLightWhite.Printf("3. Show Hidden Files: %t\n", a.showHidden)
-		pterm.FgLightWhite.Println("\n0. Back to Settings")
+		ui.text.Printf("1. Display Mode: %s\n", modeStr)
+		ui.text.Printf("2. Show Timestamps: %t\n", a.showTimestamps)
+		ui.text.Printf("3. Show Hidden Files: %t\n", a.showHidden)
+		ui.text.Println("\n0. Back to Settings")
 
-		pterm.FgLightWhite.Print("Enter choice (0-3): ")
+		ui.text.Print("Enter choice (0-3): ")
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -638,7 +783,7 @@ func (a *SimpleAgent) showDisplaySettings() error {
 		var choice int
 		_, err = fmt.Sscanf(input, "%d", &choice)
 		if err != nil || choice < 1 || choice > 3 {
-			pterm.FgRed.Println("Invalid choice. Please try again.")
+			ui.errorText.Println("Invalid choice. Please try again.")
 			continue
 		}
 
@@ -649,40 +794,41 @@ func (a *SimpleAgent) showDisplaySettings() error {
 			if a.compactMode {
 				newMode = "Compact"
 			}
-			pterm.FgLightGreen.Printf("✅ Display mode changed to: %s\n", newMode)
+			ui.success.Printf("✅ Display mode changed to: %s\n", newMode)
 		case 2:
 			a.showTimestamps = !a.showTimestamps
 			status := "disabled"
 			if a.showTimestamps {
 				status = "enabled"
 			}
-			pterm.FgLightGreen.Printf("✅ Timestamps %s\n", status)
+			ui.success.Printf("✅ Timestamps %s\n", status)
 		case 3:
 			a.showHidden = !a.showHidden
 			status := "disabled"
 			if a.showHidden {
 				status = "enabled"
 			}
-			pterm.FgLightGreen.Printf("✅ Hidden files %s\n", status)
+			ui.success.Printf("✅ Hidden files %s\n", status)
 		}
+		a.persistPreferences()
 
-		pterm.FgLightWhite.Println("Press Enter to continue...")
+		ui.text.Println("Press Enter to continue...")
 		reader.ReadString('\n')
 	}
 }
 
 // showChatSettings handles chat behavior options
 func (a *SimpleAgent) showChatSettings() error {
-	pterm.FgLightWhite.Println("\n" + strings.Repeat("═", 50))
-	pterm.FgLightCyan.Println("💾 CHAT SETTINGS")
-	pterm.FgLightWhite.Println(strings.Repeat("─", 50))
+	ui.text.Println("\n" + strings.Repeat("═", 50))
+	ui.title.Println("💾 CHAT SETTINGS")
+	ui.text.Println(strings.Repeat("─", 50))
 
 	for {
-		pterm.FgLightWhite.Println("\nCurrent settings:")
-		pterm.FgLightWhite.Printf("1. Auto-save Chat: %t\n", a.autoSaveChat)
-		pterm.FgLightWhite.Println("\n0. Back to Settings")
+		ui.text.Println("\nCurrent settings:")
+		ui.text.Printf("1. Auto-save Chat: %t\n", a.autoSaveChat)
+		ui.text.Println("\n0. Back to Settings")
 
-		pterm.FgLightWhite.Print("Enter choice (0-1): ")
+		ui.text.Print("Enter choice (0-1): ")
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -698,7 +844,7 @@ func (a *SimpleAgent) showChatSettings() error {
 		var choice int
 		_, err = fmt.Sscanf(input, "%d", &choice)
 		if err != nil || choice != 1 {
-			pterm.FgRed.Println("Invalid choice. Please try again.")
+			ui.errorText.Println("Invalid choice. Please try again.")
 			continue
 		}
 
@@ -707,27 +853,28 @@ func (a *SimpleAgent) showChatSettings() error {
 		if a.autoSaveChat {
 			status = "enabled"
 		}
-		pterm.FgLightGreen.Printf("✅ Auto-save chat %s\n", status)
+		ui.success.Printf("✅ Auto-save chat %s\n", status)
+		a.persistPreferences()
 
-		pterm.FgLightWhite.Println("Press Enter to continue...")
+		ui.text.Println("Press Enter to continue...")
 		reader.ReadString('\n')
 	}
 }
 
 // showMCPServerSettings handles MCP server configuration
 func (a *SimpleAgent) showMCPServerSettings() error {
-	pterm.FgLightWhite.Println("\n" + strings.Repeat("═", 50))
-	pterm.FgLightCyan.Println("🔌 MCP SERVER SETTINGS")
-	pterm.FgLightWhite.Println(strings.Repeat("─", 50))
+	ui.text.Println("\n" + strings.Repeat("═", 50))
+	ui.title.Println("🔌 MCP SERVER SETTINGS")
+	ui.text.Println(strings.Repeat("─", 50))
 
 	for {
-		pterm.FgLightWhite.Println("\nConnected MCP Servers:")
+		ui.text.Println("\nConnected MCP Servers:")
 		for i, server := range a.servers {
-			pterm.FgLightWhite.Printf("%d. %s - %s\n", i+1, server.Name, server.Command)
+			ui.text.Printf("%d. %s - %s\n", i+1, server.Name, server.Command)
 		}
-		pterm.FgLightWhite.Println("\n0. Back to Settings")
+		ui.text.Println("\n0. Back to Settings")
 
-		pterm.FgLightWhite.Printf("Enter choice (0-%d): ", len(a.servers))
+		ui.text.Printf("Enter choice (0-%d): ", len(a.servers))
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -743,17 +890,17 @@ func (a *SimpleAgent) showMCPServerSettings() error {
 		var choice int
 		_, err = fmt.Sscanf(input, "%d", &choice)
 		if err != nil || choice < 1 || choice > len(a.servers) {
-			pterm.FgRed.Println("Invalid choice. Please try again.")
+			ui.errorText.Println("Invalid choice. Please try again.")
 			continue
 		}
 
 		server := a.servers[choice-1]
-		pterm.FgLightWhite.Printf("Managing server: %s\n", server.Name)
-		pterm.FgLightWhite.Println("1. View server info")
-		pterm.FgLightWhite.Println("2. Refresh tools")
-		pterm.FgLightWhite.Println("0. Back")
+		ui.text.Printf("Managing server: %s\n", server.Name)
+		ui.text.Println("1. View server info")
+		ui.text.Println("2. Refresh tools")
+		ui.text.Println("0. Back")
 
-		pterm.FgLightWhite.Print("Enter choice: ")
+		ui.text.Print("Enter choice: ")
 		actionInput, err := reader.ReadString('\n')
 		if err != nil {
 			return err
@@ -764,64 +911,24 @@ func (a *SimpleAgent) showMCPServerSettings() error {
 		case "0":
 			continue
 		case "1":
-			pterm.FgLightWhite.Printf("Server: %s\n", server.Name)
-			pterm.FgLightWhite.Printf("Command: %s\n", server.Command)
+			ui.text.Printf("Server: %s\n", server.Name)
+			ui.text.Printf("Command: %s\n", server.Command)
 			if len(server.Args) > 0 {
-				pterm.FgLightWhite.Printf("Args: %v\n", server.Args)
+				ui.text.Printf("Args: %v\n", server.Args)
 			}
 		case "2":
 			if err := a.RefreshTools(); err != nil {
-				pterm.FgRed.Printf("Failed to refresh tools: %v\n", err)
+				ui.errorText.Printf("Failed to refresh tools: %v\n", err)
 			} else {
-				pterm.FgLightGreen.Println("✅ Tools refreshed successfully")
+				ui.success.Println("✅ Tools refreshed successfully")
 			}
 		}
 
-		pterm.FgLightWhite.Println("Press Enter to continue...")
+		ui.text.Println("Press Enter to continue...")
 		reader.ReadString('\n')
 	}
 }
 
-// mapColorName converts display name to color constant name
-func (a *SimpleAgent) mapColorName(displayName string) string {
-	switch displayName {
-	case "Light Cyan":
-		return "FgLightCyan"
-	case "Cyan":
-		return "FgCyan"
-	case "Light Blue":
-		return "FgLightBlue"
-	case "Blue":
-		return "FgBlue"
-	case "Light Green":
-		return "FgLightGreen"
-	case "Green":
-		return "FgGreen"
-	case "Light Yellow":
-		return "FgLightYellow"
-	case "Yellow":
-		return "FgYellow"
-	case "Light Red":
-		return "FgLightRed"
-	case "Red":
-		return "FgRed"
-	case "Light Magenta":
-		return "FgLightMagenta"
-	case "Magenta":
-		return "FgMagenta"
-	case "Light White":
-		return "FgLightWhite"
-	case "White":
-		return "FgWhite"
-	case "Gray":
-		return "FgGray"
-	case "Black":
-		return "FgBlack"
-	default:
-		return "FgLightCyan"
-	}
-}
-
 // showFileBrowser displays an interactive file browser for selecting files
 func (a *SimpleAgent) showFileBrowser() (string, error) {
 	if a.currentDir == "" {
@@ -951,27 +1058,48 @@ func (a *SimpleAgent) showFileBrowser() (string, error) {
 	}
 }
 
-// handleFileBrowserCommand processes the @ command for file selection
-func (a *SimpleAgent) handleFileBrowserCommand() (string, error) {
-	a.getSystemColorStyle().Println("🔍 File Browser - Select a file to reference:")
-	selectedPath, err := a.showFileBrowser()
-	if err != nil {
-		return "", err
+// handleFileBrowserCommand processes the @ command for file selection. It
+// opens the fuzzy finder on a terminal and the numbered browser otherwise,
+// and returns the selected paths relative to the working directory when
+// they are inside it.
+func (a *SimpleAgent) handleFileBrowserCommand() ([]string, error) {
+	var selected []string
+	if stdinIsTerminal() {
+		picked, err := a.showFilePicker()
+		if err != nil {
+			return nil, err
+		}
+		selected = picked
+	} else {
+		a.getSystemColorStyle().Println("🔍 File Browser - Select a file to reference:")
+		selectedPath, err := a.showFileBrowser()
+		if err != nil {
+			return nil, err
+		}
+		if selectedPath != "" {
+			selected = []string{selectedPath}
+		}
 	}
 
-	if selectedPath == "" {
+	if len(selected) == 0 {
 		a.getSystemColorStyle().Println("File selection cancelled.")
-		return "", nil
+		return nil, nil
 	}
 
-	// Convert to absolute path for consistency
-	absPath, err := filepath.Abs(selectedPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	wd, _ := os.Getwd()
+	for i, path := range selected {
+		// Convert to absolute path for consistency
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		selected[i] = absPath
+		if rel, err := filepath.Rel(wd, absPath); err == nil && !strings.HasPrefix(rel, "..") {
+			selected[i] = filepath.ToSlash(rel)
+		}
+		a.getSystemColorStyle().Printf("✅ Selected file: %s\n", selected[i])
 	}
-
-	a.getSystemColorStyle().Printf("✅ Selected file: %s\n", absPath)
-	return absPath, nil
+	return selected, nil
 }
 
 func (a *SimpleAgent) AddMCPServer(name, command string, args []string) error {
@@ -979,6 +1107,7 @@ func (a *SimpleAgent) AddMCPServer(name, command string, args []string) error {
 		Name:    name,
 		Command: command,
 		Args:    args,
+		Serial:  a.serialServers[name],
 	}
 
 	transport := &mcp.CommandTransport{Command: exec.Command(command, args...)}
@@ -993,11 +1122,14 @@ func (a *SimpleAgent) AddMCPServer(name, command string, args []string) error {
 	return nil
 }
 
-func (a *SimpleAgent) buildOpenAIToolsFromMCP(ctx context.Context, session *mcp.ClientSession) ([]openai.ChatCompletionToolUnionParam, error) {
+// buildOpenAIToolsFromMCP converts a server's tools to OpenAI function tools
+// and reports which of them are read-only
+func (a *SimpleAgent) buildOpenAIToolsFromMCP(ctx context.Context, session *mcp.ClientSession) ([]openai.ChatCompletionToolUnionParam, map[string]bool, error) {
 	res, err := session.ListTools(ctx, &mcp.ListToolsParams{})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	readOnly := make(map[string]bool)
 
 	out := make([]openai.ChatCompletionToolUnionParam, 0, len(res.Tools))
 	for _, t := range res.Tools {
@@ -1005,10 +1137,10 @@ func (a *SimpleAgent) buildOpenAIToolsFromMCP(ctx context.Context, session *mcp.
 		if t.InputSchema != nil {
 			raw, err := json.Marshal(t.InputSchema)
 			if err != nil {
-				return nil, fmt.Errorf("marshal input schema for %s: %w", t.Name, err)
+				return nil, nil, fmt.Errorf("marshal input schema for %s: %w", t.Name, err)
 			}
 			if err := json.Unmarshal(raw, &paramsObj); err != nil {
-				return nil, fmt.Errorf("unmarshal input schema for %s: %w", t.Name, err)
+				return nil, nil, fmt.Errorf("unmarshal input schema for %s: %w", t.Name, err)
 			}
 		} else {
 			paramsObj = map[string]any{"type": "object", "properties": map[string]any{}}
@@ -1050,58 +1182,114 @@ func (a *SimpleAgent) buildOpenAIToolsFromMCP(ctx context.Context, session *mcp.
 			Parameters:  openai.FunctionParameters(paramsObj),
 		})
 		out = append(out, tool)
+		if toolIsReadOnly(t) {
+			readOnly[t.Name] = true
+		}
 	}
-	return out, nil
+	return out, readOnly, nil
 }
 
 func (a *SimpleAgent) GetAllTools() ([]openai.ChatCompletionToolUnionParam, error) {
+	allTools, _, _ := a.listTools()
+	return allTools, nil
+}
+
+// listTools queries every connected server for its tools and records which
+// server provides each one and which tools are read-only
+func (a *SimpleAgent) listTools() ([]openai.ChatCompletionToolUnionParam, map[string]*MCPServerConfig, map[string]bool) {
 	var allTools []openai.ChatCompletionToolUnionParam
+	toolServers := make(map[string]*MCPServerConfig)
+	readOnly := make(map[string]bool)
 
 	for _, server := range a.servers {
-		tools, err := a.buildOpenAIToolsFromMCP(a.ctx, server.Session)
+		tools, serverReadOnly, err := a.buildOpenAIToolsFromMCP(a.ctx, server.Session)
 		if err != nil {
 			log.Printf("Warning: failed to get tools from server %s: %v", server.Name, err)
 			continue
 		}
+		for _, tool := range tools {
+			if fn := tool.OfFunction; fn != nil {
+				if _, taken := toolServers[fn.Function.Name]; !taken {
+					toolServers[fn.Function.Name] = server
+					readOnly[fn.Function.Name] = serverReadOnly[fn.Function.Name]
+				}
+			}
+		}
 		allTools = append(allTools, tools...)
 	}
 
-	return allTools, nil
+	return allTools, toolServers, readOnly
 }
 
-// RefreshTools queries all connected MCP servers and caches the available tools.
+// RefreshTools queries all connected MCP servers and caches the available
+// tools. In plan mode only read-only tools are offered.
 func (a *SimpleAgent) RefreshTools() error {
-	tools, err := a.GetAllTools()
-	if err != nil {
-		return err
+	tools, toolServers, readOnly := a.listTools()
+
+	// Built-in tools hide MCP tools of the same name
+	if len(a.builtins) > 0 {
+		mcpTools := tools
+		tools = make([]openai.ChatCompletionToolUnionParam, 0, len(mcpTools)+len(a.builtins))
+		for _, tool := range mcpTools {
+			if fn := tool.OfFunction; fn == nil || a.builtinTool(fn.Function.Name) == nil {
+				tools = append(tools, tool)
+			}
+		}
+		for _, builtin := range a.builtins {
+			tools = append(tools, builtinToolParam(builtin))
+			delete(toolServers, builtin.Name())
+			readOnly[builtin.Name()] = builtin.ReadOnly()
+		}
 	}
-	a.tools = tools
+
+	if a.planMode {
+		tools = filterTools(tools, readOnly)
+	}
+	a.tools, a.toolServers, a.readOnlyTools = tools, toolServers, readOnly
+	a.toolSchemas = toolSchemaIndex(a.tools)
 	return nil
 }
 
 func (a *SimpleAgent) CallTool(toolName string, arguments map[string]any) (interface{}, error) {
-	// Inject uid if this function originally had it (simplified for demo)
+	// Built-in tools run in-process
+	if builtin := a.builtinTool(toolName); builtin != nil {
+		return builtin.Call(a, arguments)
+	}
+
+	// Inject uid if this function originally had it (simplified for demo).
+	// The arguments are shared with the turn's events, so it goes into a copy.
 	if a.userID != "" {
-		if arguments == nil {
-			arguments = make(map[string]any)
-		}
-		arguments["uid"] = a.userID
+		withUID := make(map[string]any, len(arguments)+1)
+		maps.Copy(withUID, arguments)
+		withUID["uid"] = a.userID
+		arguments = withUID
 	}
 
-	// Try each server until we find one that has the tool
-	for _, server := range a.servers {
+	// Use the server known to provide the tool, otherwise try each server
+	servers := a.servers
+	if server, ok := a.toolServers[toolName]; ok {
+		servers = []*MCPServerConfig{server}
+	}
+
+	for _, server := range servers {
 		params := &mcp.CallToolParams{
 			Name:      toolName,
 			Arguments: arguments,
 		}
 
+		if server.Serial {
+			server.mu.Lock()
+		}
 		res, err := server.Session.CallTool(a.ctx, params)
+		if server.Serial {
+			server.mu.Unlock()
+		}
 		if err == nil {
-			// Tool found and executed successfully
-			if len(res.Content) > 0 {
-				return res.Content[0], nil
+			// Tool found and executed
+			if res.IsError {
+				return nil, fmt.Errorf("%s", toolResultText(res))
 			}
-			return "Tool executed successfully", nil
+			return mcpToolResult(toolName, res), nil
 		}
 		// If tool not found on this server, try the next one
 	}
@@ -1109,121 +1297,53 @@ func (a *SimpleAgent) CallTool(toolName string, arguments map[string]any) (inter
 	return nil, fmt.Errorf("tool %s not found in any connected server", toolName)
 }
 
-// ProcessUserInput appends user input, streams a response, executes tools until completion, and updates conversation state.
-func (a *SimpleAgent) ProcessUserInput(userInput string) error {
-	if strings.TrimSpace(userInput) == "" {
-		return nil
-	}
-
-	// Append user message to conversation
-	a.messages = append(a.messages, openai.UserMessage(userInput))
-
-	// Continue conversation loop until no more tool calls are needed
-	for {
-		// Show loading spinner
-		spinner, _ := pterm.DefaultSpinner.
-			WithRemoveWhenDone(true).
-			WithShowTimer(false).
-			Start("")
-
-		// Create streaming request
-		stream := a.openaiClient.Chat.Completions.NewStreaming(a.ctx, openai.ChatCompletionNewParams{
-			Messages:          a.messages,
-			Model:             openai.ChatModel(a.model),
-			Tools:             a.tools,
-			ParallelToolCalls: openai.Bool(false),
-		})
-
-		// Use ChatCompletionAccumulator to properly handle tool calls
-		acc := openai.ChatCompletionAccumulator{}
-
-		for stream.Next() {
-			current := stream.Current()
-			acc.AddChunk(current)
-
-			// Stop spinner on first content
-			spinner.Stop()
-
-			// Stream content to terminal
-			if len(current.Choices) > 0 {
-				choice := current.Choices[0]
-				if choice.Delta.Content != "" {
-					a.getAssistantColorStyle().Print(choice.Delta.Content)
-				}
-			}
+// toolResultText joins the text content blocks of a tool result
+func toolResultText(res *mcp.CallToolResult) string {
+	var parts []string
+	for _, content := range res.Content {
+		if text, ok := content.(*mcp.TextContent); ok {
+			parts = append(parts, text.Text)
 		}
+	}
+	return strings.Join(parts, "\n")
+}
 
-		if err := stream.Err(); err != nil {
-			spinner.Fail("Error occurred")
-			return fmt.Errorf("stream error: %w", err)
-		}
-
-		// Check if we have tool calls to process
-		if len(acc.Choices) > 0 && len(acc.Choices[0].Message.ToolCalls) > 0 {
-			// Add the assistant message with tool calls to conversation
-			a.messages = append(a.messages, acc.Choices[0].Message.ToParam())
-
-			// Execute tools and add tool messages
-			for _, toolCall := range acc.Choices[0].Message.ToolCalls {
-				if toolCall.Function.Name != "" && toolCall.ID != "" {
-					spinner, _ := pterm.DefaultSpinner.
-						WithRemoveWhenDone(true).
-						WithShowTimer(false).
-						Start(a.getToolColorStyle().Sprint(fmt.Sprintf("Running %s", toolCall.Function.Name)))
-
-					// Parse arguments
-					var args map[string]any
-					if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-						spinner.Fail("Failed")
-						continue
-					}
-
-					// Display tool call details in a dotted box before execution
-					a.displayToolCallDetails(toolCall.Function.Name, args)
-
-					// Execute the tool
-					result, err := a.CallTool(toolCall.Function.Name, args)
-					if err != nil {
-						spinner.Fail("Failed")
-						a.getErrorColorStyle().Printf("Tool Error: %v\n", err)
-						result = fmt.Sprintf("Error: %v", err)
-					} else {
-						spinner.Success("Done")
-					}
-
-					// Display tool result in a dotted box after execution
-					a.displayToolResult(toolCall.Function.Name, result, err)
-
-					// Add tool message to conversation
-					toolMessage := openai.ToolMessage(fmt.Sprintf("%v", result), toolCall.ID)
-					a.messages = append(a.messages, toolMessage)
-				}
-			}
+// timestamp returns the time shown before messages when timestamps are on
+func (a *SimpleAgent) timestamp() string {
+	if !a.showTimestamps {
+		return ""
+	}
+	return ui.muted.Sprint(time.Now().Format("15:04:05")) + " "
+}
 
-			continue // Continue the conversation loop
-		}
+// printAssistantHeader introduces the assistant's reply
+func (a *SimpleAgent) printAssistantHeader() {
+	pterm.Println("\n" + a.timestamp() + a.getAssistantColorStyle().Sprint("Assistant ▸"))
+}
 
-		// No more tool calls; add final assistant message to conversation and finish
-		if len(acc.Choices) > 0 {
-			a.messages = append(a.messages, acc.Choices[0].Message.ToParam())
-		}
-		break
+// formatElapsed formats a duration for display: milliseconds below a second,
+// tenths of a second below a minute
+func formatElapsed(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond).String()
+	default:
+		return d.Round(time.Second).String()
 	}
-
-	pterm.FgLightWhite.Println("\n" + strings.Repeat("─", 50))
-	return nil
 }
 
 // ChatLoop starts an interactive REPL for chatting with the agent.
 func (a *SimpleAgent) ChatLoop() error {
 	reader := bufio.NewReader(os.Stdin)
 
-	_ = pterm.DefaultHeader.WithFullWidth().WithBackgroundStyle(pterm.NewStyle(pterm.BgBlack)).WithMargin(1).Println("OPEN CODER")
-	a.getSystemColorStyle().Println("Type 'exit', 'quit' to end conversation, '/settings' to customize appearance, or '@' to browse files")
+	printHeader("OPEN CODER")
+	a.getSystemColorStyle().Println("Type 'exit', 'quit' to end conversation, '/settings' to customize appearance, '/plan <task>' to plan before changing anything, or '@' to browse files")
 	pterm.Println(strings.Repeat("─", 50))
 
 	for {
-		pterm.Print("\n" + a.getUserColorStyle().Sprint("You ▸ "))
+		pterm.Print("\n" + a.timestamp() + a.getUserColorStyle().Sprint("You ▸ "))
 		text, err := reader.ReadString('\n')
 		if err != nil {
 			return err
@@ -1237,6 +1357,12 @@ func (a *SimpleAgent) ChatLoop() error {
 			a.getSystemColorStyle().Println("\nGoodbye! 👋")
 			return nil
 		}
+		if lower == "/plan" || strings.HasPrefix(lower, "/plan ") {
+			if err := a.handlePlanCommand(strings.TrimSpace(text[len("/plan"):])); err != nil {
+				a.getErrorColorStyle().Printf("Plan error: %v\n", err)
+			}
+			continue
+		}
 		if lower == "/settings" {
 			if err := a.showSettingsMenu(); err != nil {
 				a.getErrorColorStyle().Printf("Settings error: %v\n", err)
@@ -1244,24 +1370,30 @@ func (a *SimpleAgent) ChatLoop() error {
 			continue
 		}
 
-		// Handle @ command for file browser
-		if strings.HasPrefix(text, "@") {
-			selectedPath, err := a.handleFileBrowserCommand()
+		// A lone @ opens the file browser; @path mentions are attached when the turn builds the user message
+		if loc := bareMention.FindStringIndex(text); loc != nil {
+			selected, err := a.handleFileBrowserCommand()
 			if err != nil {
 				a.getErrorColorStyle().Printf("File browser error: %v\n", err)
 				continue
 			}
-			if selectedPath != "" {
-				// Replace @ with the selected file path
-				text = strings.Replace(text, "@", fmt.Sprintf("`%s`", selectedPath), 1)
-				a.getSystemColorStyle().Printf("📎 File path inserted: %s\n", selectedPath)
-			} else {
+			if len(selected) == 0 {
 				continue // File selection was cancelled
 			}
+			refs := make([]string, len(selected))
+			for i, path := range selected {
+				refs[i] = "@" + path
+				if strings.ContainsAny(path, " \t") {
+					// Mentions end at whitespace, so only the path can be inserted
+					refs[i] = fmt.Sprintf("`%s`", path)
+					a.getSystemColorStyle().Printf("📎 File path inserted: %s\n", path)
+				}
+			}
+			at := loc[0] + strings.Index(text[loc[0]:loc[1]], "@")
+			text = text[:at] + strings.Join(refs, " ") + text[at+1:]
 		}
 
-		pterm.Println("\n" + a.getAssistantColorStyle().Sprint("Assistant ▸"))
-		if err := a.ProcessUserInput(text); err != nil {
+		if err := a.runTurn(text); err != nil {
 			a.getErrorColorStyle().Printf("Error: %v\n", err)
 		}
 	}
@@ -1279,9 +1411,10 @@ func (a *SimpleAgent) Close() {
 
 // displayToolCallDetails displays tool call arguments in a dotted border box
 func (a *SimpleAgent) displayToolCallDetails(toolName string, args map[string]any) {
-	a.getToolColorStyle().Println("\n" + strings.Repeat("┌", 60))
-	a.getToolColorStyle().Printf("│ 🔧 Tool Call: %s\n", toolName)
-	a.getToolColorStyle().Println(strings.Repeat("├", 60))
+	border := a.getToolBorderStyle()
+	border.Println("\n" + strings.Repeat("┌", 60))
+	pterm.Println(a.getToolColorStyle().Sprint("│ ") + a.timestamp() + a.getToolColorStyle().Sprintf("🔧 Tool Call: %s", toolName))
+	border.Println(strings.Repeat("├", 60))
 
 	if len(args) == 0 {
 		a.getSystemColorStyle().Println("│ 📝 Arguments: None")
@@ -1301,14 +1434,15 @@ func (a *SimpleAgent) displayToolCallDetails(toolName string, args map[string]an
 		}
 	}
 
-	a.getToolColorStyle().Println(strings.Repeat("└", 60))
+	border.Println(strings.Repeat("└", 60))
 }
 
 // displayToolResult displays the result of a tool call in a formatted box
 func (a *SimpleAgent) displayToolResult(toolName string, result interface{}, err error) {
-	a.getToolColorStyle().Println("\n" + strings.Repeat("┌", 60))
-	a.getToolColorStyle().Printf("│ ✅ Tool Result: %s\n", toolName)
-	a.getToolColorStyle().Println(strings.Repeat("├", 60))
+	border := a.getToolBorderStyle()
+	border.Println("\n" + strings.Repeat("┌", 60))
+	pterm.Println(a.getToolColorStyle().Sprint("│ ") + a.timestamp() + a.getToolColorStyle().Sprintf("✅ Tool Result: %s", toolName))
+	border.Println(strings.Repeat("├", 60))
 
 	if err != nil {
 		a.getErrorColorStyle().Printf("│ ❌ Error: %v\n", err)
@@ -1317,13 +1451,17 @@ func (a *SimpleAgent) displayToolResult(toolName string, result interface{}, err
 
 		// Convert result to string and format it nicely
 		resultStr := fmt.Sprintf("%v", result)
+		style := func(line string) string { return a.getSystemColorStyle().Sprint(line) }
+		if isUnifiedDiff(resultStr) {
+			style = diffLine
+		}
 
 		// If it's a long result, split it into lines
 		if len(resultStr) > 50 {
 			lines := strings.Split(resultStr, "\n")
 			for i, line := range lines {
 				if i < 10 { // Limit to first 10 lines to avoid overwhelming output
-					a.getSystemColorStyle().Println("│   " + line)
+					pterm.Println("│   " + style(line))
 				} else if i == 10 {
 					a.getSystemColorStyle().Println("│   ... (truncated)")
 					break
@@ -1332,49 +1470,86 @@ func (a *SimpleAgent) displayToolResult(toolName string, result interface{}, err
 		} else {
 			lines := strings.Split(resultStr, "\n")
 			for _, line := range lines {
-				a.getSystemColorStyle().Println("│   " + line)
+				pterm.Println("│   " + style(line))
 			}
 		}
 	}
 
-	a.getToolColorStyle().Println(strings.Repeat("└", 60))
+	border.Println(strings.Repeat("└", 60))
 }
 
-func main() {
-	ctx := context.Background()
-
-	// Banner
-	letters := putils.LettersFromString("OPEN CODER")
-	_ = pterm.DefaultBigText.WithLetters(letters).Render()
-	_ = pterm.DefaultHeader.WithFullWidth().WithBackgroundStyle(pterm.NewStyle(pterm.BgBlack)).WithMargin(1).Println("Open-Coder: A open source CLI coding Agent")
+// displayToolSummary shows a finished tool call as a single line, used in
+// compact mode instead of the boxes
+func (a *SimpleAgent) displayToolSummary(call engine.ToolCallResult) {
+	label := engine.ToolCallLabel(call.Name, call.Args)
+	elapsed := formatElapsed(call.Duration)
+	if call.Err != nil {
+		msg := strings.SplitN(call.Err.Error(), "\n", 2)[0]
+		if len(msg) > 60 {
+			msg = msg[:57] + "..."
+		}
+		pterm.Println(a.timestamp() + a.getErrorColorStyle().Sprintf("✗ %s (%s, %s)", label, msg, elapsed))
+		return
+	}
 
-	// Get configuration (environment variables, config file, or prompt user)
-	config, err := getConfiguration()
-	if err != nil {
-		log.Fatalf("Failed to get configuration: %v", err)
+	text := strings.TrimRight(call.Result, "\n")
+	size := "no output"
+	if text != "" {
+		lines := strings.Count(text, "\n") + 1
+		size = fmt.Sprintf("%d lines", lines)
+		if lines == 1 {
+			size = "1 line"
+		}
 	}
+	pterm.Println(a.timestamp() + a.getToolColorStyle().Sprintf("✓ %s (%s, %s)", label, size, elapsed))
+}
+
+// defaultSystemPrompt starts every conversation
+const defaultSystemPrompt = "You are a helpful assistant with access to multiple powerful tools. You can use file operations tools to read, write, search, and manage files, as well as terminal command tools to execute any system commands. Always use the appropriate tools when they would help provide accurate information, and think step by step when using tools. Users can type '/settings' to customize the assistant's appearance."
 
+// defaultSerialServers run one tool call at a time unless the config says
+// otherwise; terminal commands often depend on each other's side effects
+var defaultSerialServers = []string{"terminal"}
+
+// newConfiguredAgent creates an agent with the settings from the configuration
+func newConfiguredAgent(ctx context.Context, config *Config) *SimpleAgent {
 	agent := NewSimpleAgent(ctx, config.Model, config.APIKey, config.BaseURL)
 
 	// Store configuration values in agent for settings access
 	agent.apiKey = config.APIKey
 	agent.baseURL = config.BaseURL
 
-	// Initialize conversation with a helpful default system prompt
-	agent.InitConversation("You are a helpful assistant with access to multiple powerful tools. You can use file operations tools to read, write, search, and manage files, as well as terminal command tools to execute any system commands. Always use the appropriate tools when they would help provide accurate information, and think step by step when using tools. Users can type '/settings' to customize the assistant's appearance.")
-
-	// Display welcome message with system color
-	agent.getSystemColorStyle().Println("🤖 Assistant initialized successfully!")
-	agent.getSystemColorStyle().Printf("💡 Type '/settings' to customize appearance or '@' to browse and reference files\n")
+	// Tool execution limits
+	serialServers := config.SerialServers
+	if serialServers == nil {
+		serialServers = defaultSerialServers
+	}
+	for _, name := range serialServers {
+		agent.serialServers[name] = true
+	}
 
-	// Initialize MCP servers quietly (without showing connection details)
-	spinner, _ := pterm.DefaultSpinner.Start("Initializing...")
+	// Completion retries, fallback providers and turn limits
+	turns := engine.Config{
+		Providers:     agent.providers(config.Fallbacks),
+		MaxRetries:    config.MaxRetries,
+		ParallelTools: config.MaxParallelTools,
+	}
+	if config.TurnLimits != nil {
+		turns.Limits = *config.TurnLimits
+	}
+	agent.useEngine(turns)
+	agent.subAgentModel = config.SubAgentModel
+	agent.askUserFallback = config.AskUserFallback
+	return agent
+}
 
-	// Auto-discover and connect to all MCP servers in installation directory
+// connectInstalledServers connects to every executable *-cli MCP server in
+// the installation directory and returns how many connected. A server that
+// fails to start is reported and skipped.
+func (a *SimpleAgent) connectInstalledServers() (int, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		spinner.Fail(fmt.Sprintf("Failed to get home directory: %v", err))
-		log.Fatalf("Failed to get home directory: %v", err)
+		return 0, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
 	installDir := filepath.Join(homeDir, ".open-coder")
@@ -1383,8 +1558,7 @@ func main() {
 	// Scan for all *-cli executables in the installation directory
 	entries, err := os.ReadDir(installDir)
 	if err != nil {
-		spinner.Fail(fmt.Sprintf("Failed to scan installation directory: %v", err))
-		log.Fatalf("Failed to scan installation directory: %v", err)
+		return 0, fmt.Errorf("failed to scan installation directory: %w", err)
 	}
 
 	for _, entry := range entries {
@@ -1403,13 +1577,127 @@ func main() {
 		}
 
 		// Try to connect to the MCP server
-		if err := agent.AddMCPServer(serverName, serverPath, []string{}); err != nil {
-			agent.getErrorColorStyle().Printf("Failed to connect to %s server: %v\n", serverName, err)
+		if err := a.AddMCPServer(serverName, serverPath, []string{}); err != nil {
+			a.getErrorColorStyle().Printf("Failed to connect to %s server: %v\n", serverName, err)
 			// Don't exit on individual server failures - continue with others
 		} else {
 			connectedServers++
 		}
 	}
+	return connectedServers, nil
+}
+
+// attachConfiguredRepoMap gives the model an overview of the repository it
+// is working in, within the configured token budget
+func (a *SimpleAgent) attachConfiguredRepoMap(config *Config) {
+	repoMapTokens := config.RepoMapTokens
+	if v := strings.TrimSpace(os.Getenv("OPEN_CODER_REPO_MAP_TOKENS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			repoMapTokens = n
+		}
+	}
+	if repoMapTokens >= 0 {
+		if err := a.AttachRepoMap(repoMapTokens); err != nil {
+			a.getErrorColorStyle().Printf("Repository map unavailable: %v\n", err)
+		}
+	}
+}
+
+// startHeadlessAgent prepares an agent for the modes that serve other
+// programs rather than a person at the terminal: configuration, MCP servers,
+// tools and the repository map, without the interactive start-up screen
+func startHeadlessAgent(ctx context.Context) (*SimpleAgent, *Config, error) {
+	config, err := getConfiguration(false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get configuration: %w", err)
+	}
+
+	agent := newConfiguredAgent(ctx, config)
+	agent.InitConversation(defaultSystemPrompt)
+
+	connected, err := agent.connectInstalledServers()
+	if err != nil {
+		return nil, nil, err
+	}
+	if connected == 0 {
+		return nil, nil, fmt.Errorf("no MCP servers were found in the installation directory")
+	}
+	if err := agent.RefreshTools(); err != nil {
+		agent.Close()
+		return nil, nil, fmt.Errorf("failed to load tools: %w", err)
+	}
+	agent.attachConfiguredRepoMap(config)
+	return agent, config, nil
+}
+
+func main() {
+	useTUI := flag.Bool("tui", false, "use the full-screen terminal interface instead of the plain REPL")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	// Modes that serve other programs instead of a person at the terminal
+	switch flag.Arg(0) {
+	case "serve":
+		if err := runServe(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("Serve error: %v", err)
+		}
+		return
+	case "mcp":
+		if err := runMCPServer(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("MCP server error: %v", err)
+		}
+		return
+	case "acp":
+		if err := runACP(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("ACP error: %v", err)
+		}
+		return
+	}
+
+	// Honor NO_COLOR and apply the saved theme before anything is drawn
+	if colorsDisabled {
+		pterm.DisableColor()
+	}
+	loadSavedTheme()
+
+	// Banner
+	letters := putils.LettersFromString("OPEN CODER")
+	if banner, err := pterm.DefaultBigText.WithLetters(letters).Srender(); err == nil {
+		pterm.Println(ui.banner.Sprint(strings.TrimRight(pterm.RemoveColorFromString(banner), "\n")))
+	}
+	printHeader("Open-Coder: A open source CLI coding Agent")
+
+	// Get configuration (environment variables, config file, or prompt user)
+	config, err := getConfiguration(true)
+	if err != nil {
+		log.Fatalf("Failed to get configuration: %v", err)
+	}
+
+	agent := newConfiguredAgent(ctx, config)
+	agent.fuzzyMentions = true
+
+	// Pick up an unfinished todo list from the last session in this directory
+	if n := agent.restoreTodos(); n > 0 {
+		agent.getSystemColorStyle().Printf("📋 Restored a todo list with %d items from the last session\n", n)
+	}
+
+	// Initialize conversation with a helpful default system prompt
+	agent.InitConversation(defaultSystemPrompt)
+
+	// Display welcome message with system color
+	agent.getSystemColorStyle().Println("🤖 Assistant initialized successfully!")
+	agent.getSystemColorStyle().Printf("💡 Type '/settings' to customize appearance or '@' to browse and reference files\n")
+
+	// Initialize MCP servers quietly (without showing connection details)
+	spinner, _ := themedSpinner().Start("Initializing...")
+
+	// Auto-discover and connect to all MCP servers in installation directory
+	connectedServers, err := agent.connectInstalledServers()
+	if err != nil {
+		spinner.Fail(err.Error())
+		log.Fatalf("Failed to start MCP servers: %v", err)
+	}
 
 	if connectedServers == 0 {
 		spinner.Fail("No MCP servers found")
@@ -1425,10 +1713,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Give the model an overview of the repository it is working in
+	agent.attachConfiguredRepoMap(config)
+
 	spinner.Success(fmt.Sprintf("Ready · %d servers", connectedServers))
 
 	// Start interactive chat loop
-	if err := agent.ChatLoop(); err != nil {
+	if *useTUI {
+		err = agent.RunTUI()
+	} else {
+		err = agent.ChatLoop()
+	}
+	if err != nil {
 		log.Fatalf("Chat error: %v", err)
 	}
 
@@ -0,0 +1,752 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pterm/pterm"
+)
+
+// lineKind describes how the markdown renderer treats the line being streamed
+type lineKind int
+
+const (
+	lineUndecided lineKind = iota // too few characters seen to classify the line
+	lineInline                    // paragraph, list item or quote text written as it arrives
+	lineBuffered                  // header, rule, table row or code line rendered once complete
+)
+
+// markdownRenderer renders streamed assistant output as markdown. Paragraph text
+// is written token by token; block constructs (headers, tables, code fences) are
+// buffered only until the end of their line so they can be recognized.
+type markdownRenderer struct {
+	enabled bool  // false when stdout is not a terminal
+	compact bool  // compact display mode drops borders and padding
+	text    Style // base color for assistant text
+
+	line strings.Builder // raw characters of the current line
+	kind lineKind
+
+	inFence   bool
+	fenceMark string
+	highlight *codeHighlighter
+
+	table [][]string // pending table rows, rendered when the table ends
+
+	bold, italic, code bool
+	pendingStar        bool // a '*' whose meaning depends on the next character
+
+	out      strings.Builder // rendered output for the current Write call
+	seg      strings.Builder // characters sharing the current inline style
+	segStyle *Style
+}
+
+// newMarkdownRenderer creates a renderer using the agent's colors and display mode
+func (a *SimpleAgent) newMarkdownRenderer() *markdownRenderer {
+	return &markdownRenderer{
+		enabled: stdoutIsTerminal(),
+		compact: a.compactMode,
+		text:    a.getAssistantColorStyle(),
+	}
+}
+
+// stdoutIsTerminal reports whether standard output is attached to a terminal
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Write renders the next chunk of streamed content
+func (r *markdownRenderer) Write(delta string) {
+	if !r.enabled {
+		r.text.Print(delta)
+		return
+	}
+
+	for _, ch := range delta {
+		if ch == '\n' {
+			r.endLine()
+			continue
+		}
+
+		switch r.kind {
+		case lineInline:
+			r.writeInline(string(ch))
+		default:
+			r.line.WriteRune(ch)
+			if r.kind == lineUndecided {
+				r.classify()
+			}
+		}
+	}
+
+	r.flushOutput()
+}
+
+// Flush renders any partially received line and closes open blocks
+func (r *markdownRenderer) Flush() {
+	if !r.enabled {
+		return
+	}
+
+	if r.kind != lineInline && r.line.Len() > 0 {
+		r.renderBufferedLine(r.line.String())
+	} else if r.kind == lineInline {
+		r.closeInline()
+	}
+	r.line.Reset()
+	r.kind = lineUndecided
+
+	r.flushTable()
+	if r.inFence {
+		r.closeFence()
+	}
+	r.flushOutput()
+}
+
+// classify inspects the start of the current line and decides how to render it
+func (r *markdownRenderer) classify() {
+	if r.inFence {
+		r.kind = lineBuffered
+		return
+	}
+
+	raw := r.line.String()
+	trimmed := strings.TrimLeft(raw, " \t")
+	if trimmed == "" {
+		return
+	}
+	indent := raw[:len(raw)-len(trimmed)]
+
+	first := trimmed[0]
+	switch {
+	case first == '|':
+		r.kind = lineBuffered
+		return
+	case first == '#':
+		rest := strings.TrimLeft(trimmed, "#")
+		if rest == "" {
+			return
+		}
+		if rest[0] == ' ' {
+			r.kind = lineBuffered
+			r.flushTable()
+			return
+		}
+	case first == '`' || first == '~':
+		if len(trimmed) < 3 && strings.Count(trimmed, string(first)) == len(trimmed) {
+			return
+		}
+		if strings.HasPrefix(trimmed, strings.Repeat(string(first), 3)) {
+			r.kind = lineBuffered
+			r.flushTable()
+			return
+		}
+	case first == '>':
+		if len(trimmed) == 1 {
+			return
+		}
+		prefix := 1
+		if trimmed[1] == ' ' {
+			prefix = 2
+		}
+		r.startInline(indent, ui.markdownBorder.Sprint("│ "), trimmed[prefix:])
+		return
+	case first == '-' || first == '*' || first == '+':
+		if len(trimmed) == 1 {
+			return
+		}
+		if trimmed[1] == ' ' {
+			r.startInline(indent, r.text.Sprint("• "), trimmed[2:])
+			return
+		}
+		if first == '-' && trimmed[1] == '-' {
+			// Possibly a horizontal rule; decide once the line is complete
+			r.kind = lineBuffered
+			r.flushTable()
+			return
+		}
+	case first >= '0' && first <= '9':
+		digits := len(trimmed) - len(strings.TrimLeft(trimmed, "0123456789"))
+		if digits == len(trimmed) {
+			return
+		}
+		if trimmed[digits] == '.' || trimmed[digits] == ')' {
+			if digits+1 == len(trimmed) {
+				return
+			}
+			if trimmed[digits+1] == ' ' {
+				r.startInline(indent, r.text.Sprint(trimmed[:digits+1]+" "), trimmed[digits+2:])
+				return
+			}
+		}
+	}
+
+	r.startInline("", "", raw)
+}
+
+// startInline switches the current line to streaming mode, emitting its prefix
+// and whatever content has been buffered so far
+func (r *markdownRenderer) startInline(indent, prefix, rest string) {
+	r.flushTable()
+	r.kind = lineInline
+	r.line.Reset()
+	r.emitRaw(indent + prefix)
+	r.writeInline(rest)
+}
+
+// endLine finishes the current line
+func (r *markdownRenderer) endLine() {
+	switch r.kind {
+	case lineInline:
+		r.closeInline()
+		r.emitRaw("\n")
+	default:
+		r.renderBufferedLine(r.line.String())
+	}
+	r.line.Reset()
+	r.kind = lineUndecided
+}
+
+// renderBufferedLine renders a complete line that was not streamed inline
+func (r *markdownRenderer) renderBufferedLine(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	if r.inFence {
+		if strings.HasPrefix(trimmed, r.fenceMark) && strings.Trim(trimmed, r.fenceMark[:1]) == "" {
+			r.closeFence()
+			return
+		}
+		r.emitCodeLine(line)
+		return
+	}
+
+	if strings.HasPrefix(trimmed, "|") {
+		r.table = append(r.table, splitTableRow(trimmed))
+		return
+	}
+	r.flushTable()
+
+	switch {
+	case trimmed == "":
+		r.emitRaw("\n")
+	case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+		r.openFence(trimmed)
+	case strings.HasPrefix(trimmed, "#"):
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		title := strings.TrimSpace(trimmed[level:])
+		if title == "" || trimmed[level] != ' ' {
+			r.renderPlainLine(line)
+			return
+		}
+		r.emitHeader(level, title)
+	case isHorizontalRule(trimmed):
+		width := 50
+		if r.compact {
+			width = 20
+		}
+		r.emitRaw(ui.markdownBorder.Sprint(strings.Repeat("─", width)) + "\n")
+	default:
+		r.renderPlainLine(line)
+	}
+}
+
+// renderPlainLine renders a complete line as ordinary paragraph text
+func (r *markdownRenderer) renderPlainLine(line string) {
+	r.writeInline(line)
+	r.closeInline()
+	r.emitRaw("\n")
+}
+
+// emitHeader renders a markdown header
+func (r *markdownRenderer) emitHeader(level int, title string) {
+	style := ui.markdownHeading.inherit(r.text)
+	if level == 1 {
+		style = style.Underline()
+	}
+	r.emitRaw(style.Sprint(title) + "\n")
+	if !r.compact && level <= 2 {
+		underline := "─"
+		if level == 1 {
+			underline = "═"
+		}
+		r.emitRaw(ui.markdownBorder.Sprint(strings.Repeat(underline, utf8.RuneCountInString(title))) + "\n")
+	}
+}
+
+// openFence starts a fenced code block
+func (r *markdownRenderer) openFence(trimmed string) {
+	r.inFence = true
+	r.fenceMark = trimmed[:3]
+	lang := strings.TrimSpace(strings.TrimLeft(trimmed, trimmed[:1]))
+	r.highlight = newCodeHighlighter(lang)
+
+	if !r.compact {
+		label := "┌─"
+		if lang != "" {
+			label += " " + lang
+		}
+		r.emitRaw(ui.markdownBorder.Sprint(label) + "\n")
+	}
+}
+
+// closeFence ends the current fenced code block
+func (r *markdownRenderer) closeFence() {
+	r.inFence = false
+	r.fenceMark = ""
+	r.highlight = nil
+	if !r.compact {
+		r.emitRaw(ui.markdownBorder.Sprint("└─") + "\n")
+	}
+}
+
+// emitCodeLine renders one line of a fenced code block with syntax highlighting
+func (r *markdownRenderer) emitCodeLine(line string) {
+	prefix := "  "
+	if !r.compact {
+		prefix = ui.markdownBorder.Sprint("│ ")
+	}
+	r.emitRaw(prefix + r.highlight.Line(line) + "\n")
+}
+
+// flushTable renders any buffered table rows with aligned columns
+func (r *markdownRenderer) flushTable() {
+	if len(r.table) == 0 {
+		return
+	}
+	rows := r.table
+	r.table = nil
+
+	// Drop the header separator row (|---|:---:|) but remember that a header exists
+	hasHeader := false
+	var body [][]string
+	for i, row := range rows {
+		if i == 1 && isTableSeparator(row) {
+			hasHeader = true
+			continue
+		}
+		body = append(body, row)
+	}
+
+	columns := 0
+	for _, row := range body {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	widths := make([]int, columns)
+	for _, row := range body {
+		for i, cell := range row {
+			if w := utf8.RuneCountInString(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	sep := ui.markdownBorder.Sprint(" │ ")
+	if r.compact {
+		sep = "  "
+	}
+
+	for i, row := range body {
+		var b strings.Builder
+		for c := 0; c < columns; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = row[c]
+			}
+			if c > 0 {
+				b.WriteString(sep)
+			}
+			padded := cell + strings.Repeat(" ", widths[c]-utf8.RuneCountInString(cell))
+			if hasHeader && i == 0 {
+				b.WriteString(ui.markdownHeading.inherit(r.text).Bold().Sprint(padded))
+			} else {
+				b.WriteString(r.text.Sprint(padded))
+			}
+		}
+		r.emitRaw(b.String() + "\n")
+
+		if hasHeader && i == 0 && !r.compact {
+			parts := make([]string, columns)
+			for c := range parts {
+				parts[c] = strings.Repeat("─", widths[c])
+			}
+			r.emitRaw(ui.markdownBorder.Sprint(strings.Join(parts, "─┼─")) + "\n")
+		}
+	}
+}
+
+// splitTableRow splits a markdown table row into trimmed cells
+func splitTableRow(row string) []string {
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	cells := strings.Split(row, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// isTableSeparator reports whether a row is a header separator like |---|:--:|
+func isTableSeparator(row []string) bool {
+	for _, cell := range row {
+		if strings.Trim(cell, "-: ") != "" || !strings.Contains(cell, "-") {
+			return false
+		}
+	}
+	return len(row) > 0
+}
+
+// isHorizontalRule reports whether a trimmed line is a markdown thematic break
+func isHorizontalRule(trimmed string) bool {
+	compacted := strings.ReplaceAll(trimmed, " ", "")
+	if len(compacted) < 3 {
+		return false
+	}
+	return strings.Count(compacted, compacted[:1]) == len(compacted) && strings.ContainsAny(compacted[:1], "-*_")
+}
+
+// writeInline renders paragraph text, handling `code`, **bold** and *italic* spans
+func (r *markdownRenderer) writeInline(s string) {
+	for _, ch := range s {
+		if r.code {
+			if ch == '`' {
+				r.code = false
+				continue
+			}
+			r.emitRune(ch)
+			continue
+		}
+
+		if r.pendingStar {
+			r.pendingStar = false
+			if ch == '*' {
+				r.bold = !r.bold
+				continue
+			}
+			switch {
+			case r.italic:
+				r.italic = false
+			case !unicode.IsSpace(ch):
+				r.italic = true
+			default:
+				r.emitRune('*')
+			}
+		}
+
+		switch ch {
+		case '`':
+			r.code = true
+		case '*':
+			r.pendingStar = true
+		default:
+			r.emitRune(ch)
+		}
+	}
+}
+
+// closeInline resolves a dangling '*' and resets inline styles at the end of a line
+func (r *markdownRenderer) closeInline() {
+	if r.pendingStar && !r.italic {
+		r.emitRune('*')
+	}
+	r.pendingStar = false
+	r.bold, r.italic, r.code = false, false, false
+	r.flushSegment()
+}
+
+// inlineStyle returns the style for the current combination of inline markers
+func (r *markdownRenderer) inlineStyle() Style {
+	if r.code {
+		return ui.markdownCode
+	}
+	style := r.text
+	if r.bold {
+		style = style.Bold()
+	}
+	if r.italic {
+		style = style.Italic()
+	}
+	return style
+}
+
+// emitRune appends a character in the current inline style
+func (r *markdownRenderer) emitRune(ch rune) {
+	style := r.inlineStyle()
+	if r.segStyle == nil || *r.segStyle != style {
+		r.flushSegment()
+		r.segStyle = &style
+	}
+	r.seg.WriteRune(ch)
+}
+
+// emitRaw appends already-rendered text
+func (r *markdownRenderer) emitRaw(s string) {
+	r.flushSegment()
+	r.out.WriteString(s)
+}
+
+// flushSegment renders the pending run of equally styled characters
+func (r *markdownRenderer) flushSegment() {
+	if r.seg.Len() > 0 && r.segStyle != nil {
+		r.out.WriteString(r.segStyle.Sprint(r.seg.String()))
+	}
+	r.seg.Reset()
+	r.segStyle = nil
+}
+
+// flushOutput writes everything rendered so far to the terminal
+func (r *markdownRenderer) flushOutput() {
+	r.flushSegment()
+	if r.out.Len() > 0 {
+		pterm.Print(r.out.String())
+		r.out.Reset()
+	}
+}
+
+// codeLanguage describes the lexical rules used to highlight a language
+type codeLanguage struct {
+	keywords     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+}
+
+// codeLanguages maps fence language names to highlighting rules
+var codeLanguages = func() map[string]*codeLanguage {
+	words := func(s string) map[string]bool {
+		m := make(map[string]bool)
+		for _, w := range strings.Fields(s) {
+			m[w] = true
+		}
+		return m
+	}
+
+	cLike := [2]string{"/*", "*/"}
+	goLang := &codeLanguage{
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var nil true false iota
+			string int int64 int32 uint uint64 byte rune bool error float64 any`),
+		lineComments: []string{"//"},
+		blockComment: cLike,
+		quotes:       "\"'`",
+	}
+	python := &codeLanguage{
+		keywords: words(`and as assert async await break class continue def del elif else except finally for
+			from global if import in is lambda nonlocal not or pass raise return try while with yield
+			None True False self`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	javascript := &codeLanguage{
+		keywords: words(`async await break case catch class const continue default delete do else export
+			extends finally for from function if import in instanceof interface let new of return static
+			super switch this throw try type typeof var void while yield null undefined true false`),
+		lineComments: []string{"//"},
+		blockComment: cLike,
+		quotes:       "\"'`",
+	}
+	rust := &codeLanguage{
+		keywords: words(`as async await break const continue crate else enum extern fn for if impl in let
+			loop match mod move mut pub ref return self Self static struct super trait type unsafe use
+			where while true false Some None Ok Err`),
+		lineComments: []string{"//"},
+		blockComment: cLike,
+		quotes:       "\"",
+	}
+	java := &codeLanguage{
+		keywords: words(`abstract boolean break byte case catch char class const continue default do double
+			else enum extends final finally float for if implements import instanceof int interface long
+			new package private protected public return short static super switch this throw throws try
+			void volatile while null true false`),
+		lineComments: []string{"//"},
+		blockComment: cLike,
+		quotes:       "\"'",
+	}
+	c := &codeLanguage{
+		keywords: words(`auto break case char const continue default do double else enum extern float for
+			goto if inline int long register return short signed sizeof static struct switch typedef union
+			unsigned void volatile while class namespace template typename public private protected new
+			delete nullptr true false bool`),
+		lineComments: []string{"//"},
+		blockComment: cLike,
+		quotes:       "\"'",
+	}
+	shell := &codeLanguage{
+		keywords: words(`if then else elif fi for while until do done case esac in function return export
+			local echo cd exit set unset source`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	json := &codeLanguage{
+		keywords: words(`true false null`),
+		quotes:   "\"",
+	}
+	yaml := &codeLanguage{
+		keywords:     words(`true false null yes no`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	sql := &codeLanguage{
+		keywords: words(`select from where insert into values update set delete create table drop alter
+			join left right inner outer on group by order having limit and or not null as distinct index
+			primary key SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER
+			JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT AND OR NOT NULL AS DISTINCT INDEX
+			PRIMARY KEY`),
+		lineComments: []string{"--"},
+		blockComment: cLike,
+		quotes:       "'\"",
+	}
+
+	return map[string]*codeLanguage{
+		"go": goLang, "golang": goLang,
+		"python": python, "py": python,
+		"javascript": javascript, "js": javascript, "jsx": javascript,
+		"typescript": javascript, "ts": javascript, "tsx": javascript,
+		"rust": rust, "rs": rust,
+		"java": java, "kotlin": java,
+		"c": c, "h": c, "cpp": c, "c++": c, "cc": c, "hpp": c,
+		"bash": shell, "sh": shell, "shell": shell, "zsh": shell, "console": shell,
+		"json": json,
+		"yaml": yaml, "yml": yaml, "toml": yaml,
+		"sql": sql,
+	}
+}()
+
+// codeHighlighter highlights the lines of one fenced code block
+type codeHighlighter struct {
+	lang           *codeLanguage
+	diff           bool // lines are a unified diff
+	inBlockComment bool
+}
+
+// newCodeHighlighter returns a highlighter for the given fence language
+func newCodeHighlighter(lang string) *codeHighlighter {
+	lang = strings.ToLower(lang)
+	return &codeHighlighter{lang: codeLanguages[lang], diff: lang == "diff" || lang == "patch"}
+}
+
+// diffLine colors a line of a unified diff by its kind
+func diffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return ui.diffHunk.Bold().Sprint(line)
+	case strings.HasPrefix(line, "@@"):
+		return ui.diffHunk.Sprint(line)
+	case strings.HasPrefix(line, "+"):
+		return ui.diffAdded.Sprint(line)
+	case strings.HasPrefix(line, "-"):
+		return ui.diffRemoved.Sprint(line)
+	}
+	return ui.codeText.Sprint(line)
+}
+
+// Line returns a single line of code with highlighting escape sequences applied
+func (h *codeHighlighter) Line(line string) string {
+	plain := ui.codeText
+	if h != nil && h.diff {
+		return diffLine(line)
+	}
+	if h == nil || h.lang == nil {
+		return plain.Sprint(line)
+	}
+
+	var b strings.Builder
+	lang := h.lang
+	i := 0
+	for i < len(line) {
+		if h.inBlockComment {
+			end := strings.Index(line[i:], lang.blockComment[1])
+			if end < 0 {
+				b.WriteString(ui.codeComment.Sprint(line[i:]))
+				return b.String()
+			}
+			end += i + len(lang.blockComment[1])
+			b.WriteString(ui.codeComment.Sprint(line[i:end]))
+			h.inBlockComment = false
+			i = end
+			continue
+		}
+
+		rest := line[i:]
+		if lang.blockComment[0] != "" && strings.HasPrefix(rest, lang.blockComment[0]) {
+			h.inBlockComment = true
+			b.WriteString(ui.codeComment.Sprint(lang.blockComment[0]))
+			i += len(lang.blockComment[0])
+			continue
+		}
+		if hasAnyPrefix(rest, lang.lineComments) {
+			b.WriteString(ui.codeComment.Sprint(rest))
+			return b.String()
+		}
+
+		ch := line[i]
+		switch {
+		case strings.IndexByte(lang.quotes, ch) >= 0:
+			end := i + 1
+			for end < len(line) && line[end] != ch {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(line) {
+				end++
+			} else {
+				end = len(line)
+			}
+			b.WriteString(ui.codeString.Sprint(line[i:end]))
+			i = end
+		case ch >= '0' && ch <= '9':
+			end := i + 1
+			for end < len(line) && strings.IndexByte("0123456789abcdefABCDEFxXoO._", line[end]) >= 0 {
+				end++
+			}
+			b.WriteString(ui.codeNumber.Sprint(line[i:end]))
+			i = end
+		case isIdentByte(ch) && !(ch >= '0' && ch <= '9'):
+			end := i + 1
+			for end < len(line) && isIdentByte(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			if lang.keywords[word] {
+				b.WriteString(ui.codeKeyword.Sprint(word))
+			} else {
+				b.WriteString(plain.Sprint(word))
+			}
+			i = end
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			b.WriteString(plain.Sprint(rest[:size]))
+			i += size
+		}
+	}
+	return b.String()
+}
+
+// isIdentByte reports whether an ASCII byte can be part of an identifier
+func isIdentByte(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// hasAnyPrefix reports whether s starts with any of the given prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnifiedDiff reports whether text looks like a unified diff
+func isUnifiedDiff(text string) bool {
+	return (strings.HasPrefix(text, "--- ") || strings.HasPrefix(text, "diff ")) && strings.Contains(text, "\n@@ ")
+}
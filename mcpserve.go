@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/pterm/pterm"
+
+	"open-coder/engine"
+)
+
+// mcpServer lets other MCP clients delegate coding tasks to the agent
+type mcpServer struct {
+	pool *agentPool
+}
+
+// agentTaskResult is what run_agent_task returns
+type agentTaskResult struct {
+	Answer       string   `json:"answer"`
+	FilesChanged []string `json:"files_changed"` // git status lines of files the task changed
+	Actions      []string `json:"actions"`       // Tool calls that may have changed something
+	Error        string   `json:"error,omitempty"`
+}
+
+// runMCPServer runs `open-coder mcp`, serving MCP over stdio
+func runMCPServer(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("mcp", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Standard output carries the protocol, so everything else that would be
+	// printed goes to standard error
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	pterm.SetDefaultOutput(os.Stderr)
+
+	pool, err := newAgentPool(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.close()
+	m := &mcpServer{pool: pool}
+
+	s := mcpserver.NewMCPServer(
+		"open-coder",
+		"1.0.0",
+		mcpserver.WithToolCapabilities(false),
+		mcpserver.WithInstructions("Delegate coding tasks to open-coder with run_agent_task. It works in the given directory with its own tools and returns its answer and the changes it made."),
+	)
+	s.AddTool(createRunAgentTaskTool(), m.runAgentTask)
+
+	return mcpserver.NewStdioServer(s).Listen(ctx, os.Stdin, out)
+}
+
+func createRunAgentTaskTool() mcp.Tool {
+	return mcp.NewTool("run_agent_task",
+		mcp.WithDescription("Have the open-coder agent carry out a coding task: it reads, edits and runs code with its tools until the task is done, "+
+			"then returns its final answer and a summary of what it changed. Questions it would ask a user are answered with a default, so describe the task fully"),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("The task, as you would describe it to a developer"),
+		),
+		mcp.WithString("cwd",
+			mcp.Description("Absolute path of the directory to work in (default: the directory open-coder was started in)"),
+		),
+		mcp.WithArray("tools_allowed",
+			mcp.Description("Names of the only tools the agent may use (default: all of them)"),
+			mcp.WithStringItems(),
+		),
+	)
+}
+
+func (m *mcpServer) runAgentTask(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	prompt := request.GetString("prompt", "")
+	if strings.TrimSpace(prompt) == "" {
+		return mcp.NewToolResultError("prompt parameter is required"), nil
+	}
+
+	// Tasks run one at a time because each changes the working directory
+	agent, err := m.pool.enter(request.GetString("cwd", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer m.pool.leave()
+	dir, _ := os.Getwd()
+
+	task := agent.newSession()
+	task.autoSaveChat = false
+	if allowed := request.GetStringSlice("tools_allowed", nil); len(allowed) > 0 {
+		if err := task.allowOnlyTools(allowed); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	var progressToken mcp.ProgressToken
+	if request.Params.Meta != nil {
+		progressToken = request.Params.Meta.ProgressToken
+	}
+
+	before := gitFileStates(dir)
+	result := agentTaskResult{FilesChanged: []string{}, Actions: []string{}}
+	steps := 0
+	for ev := range task.Run(ctx, prompt) {
+		switch ev := ev.(type) {
+		case engine.Question:
+			// Nobody is there to answer; the agent falls back as without a terminal
+			ev.Answer(engine.Reply{Choice: -1, Err: engine.ErrNoUser})
+		case engine.ToolCallStarted:
+			steps++
+			notifyProgress(ctx, progressToken, steps, engine.ToolCallLabel(ev.Name, ev.Args))
+		case engine.ToolCallResult:
+			if ev.Err == nil && !task.readOnlyTools[ev.Name] {
+				result.Actions = append(result.Actions, engine.ToolCallLabel(ev.Name, ev.Args))
+			}
+		case engine.Error:
+			result.Error = ev.Err.Error()
+		}
+	}
+	result.Answer = strings.TrimSpace(task.engine.LastReply)
+	if before != nil {
+		result.FilesChanged = changedFiles(before, gitFileStates(dir))
+	}
+
+	toolResult := mcp.NewToolResultStructured(result, formatAgentTaskResult(result, before != nil))
+	toolResult.IsError = result.Error != ""
+	return toolResult, nil
+}
+
+// allowOnlyTools limits the tools offered to the model to names
+func (a *SimpleAgent) allowOnlyTools(names []string) error {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, offered := a.toolSchemas[name]; !offered {
+			return fmt.Errorf("tool %q is not available", name)
+		}
+		allowed[name] = true
+	}
+	a.tools = filterTools(a.tools, allowed)
+	a.toolSchemas = toolSchemaIndex(a.tools)
+	return nil
+}
+
+// notifyProgress reports a step of a long task to a client that asked for
+// progress notifications
+func notifyProgress(ctx context.Context, token mcp.ProgressToken, step int, message string) {
+	s := mcpserver.ServerFromContext(ctx)
+	if token == nil || s == nil {
+		return
+	}
+	_ = s.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+		"progressToken": token,
+		"progress":      step,
+		"message":       message,
+	})
+}
+
+// gitFileStates returns the git status of the files that differ from HEAD
+// in dir, with a hash of their contents so further edits to an already
+// modified file show up. It returns nil outside a git repository.
+func gitFileStates(dir string) map[string]string {
+	cmd := exec.Command("git", "status", "--porcelain", "--untracked-files=all")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	states := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		status, path := line[:2], line[3:]
+		if _, renamed, ok := strings.Cut(path, " -> "); ok {
+			path = renamed
+		}
+		sum := ""
+		if data, err := os.ReadFile(filepath.Join(dir, path)); err == nil {
+			digest := sha256.Sum256(data)
+			sum = hex.EncodeToString(digest[:8])
+		}
+		states[path] = status + " " + sum
+	}
+	return states
+}
+
+// changedFiles lists the files whose state differs between two
+// gitFileStates, as "<status> <path>"
+func changedFiles(before, after map[string]string) []string {
+	changed := []string{}
+	for path, state := range after {
+		if before[path] != state {
+			status, _, _ := strings.Cut(state, " ")
+			changed = append(changed, status+" "+path)
+		}
+	}
+	// Files changed before the task that it restored
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, "   "+path+" (restored)")
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i][3:] < changed[j][3:] })
+	return changed
+}
+
+// formatAgentTaskResult renders the result for clients that read text
+func formatAgentTaskResult(result agentTaskResult, tracked bool) string {
+	var b strings.Builder
+	if result.Error != "" {
+		fmt.Fprintf(&b, "The task stopped with an error: %s\n\n", result.Error)
+	}
+	if result.Answer != "" {
+		b.WriteString(result.Answer + "\n\n")
+	}
+
+	switch {
+	case len(result.FilesChanged) > 0:
+		b.WriteString("Files changed:\n")
+		for _, line := range result.FilesChanged {
+			b.WriteString("  " + line + "\n")
+		}
+	case tracked:
+		b.WriteString("No files were changed.\n")
+	default:
+		b.WriteString("The directory is not a git repository, so changed files are not listed.\n")
+	}
+	if len(result.Actions) > 0 {
+		b.WriteString("Actions:\n")
+		for _, action := range result.Actions {
+			b.WriteString("  - " + action + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"open-coder/engine"
+	"open-coder/internal/fsutil"
+	"open-coder/internal/fuzzy"
+)
+
+// Limits on the file contents attached by @ mentions
+const (
+	// maxMentionFileBytes caps the contents attached for one file
+	maxMentionFileBytes = 50 * 1024
+	// maxMentionTotalBytes caps the contents attached to one message
+	maxMentionTotalBytes = 200 * 1024
+	// maxMentionDirFiles caps the files whose contents a directory mention attaches
+	maxMentionDirFiles = 50
+	// maxMentionDirListing caps the entries listed for a directory mention
+	maxMentionDirListing = 200
+	// maxMentionCandidates is how many completions are offered for an unknown path
+	maxMentionCandidates = 8
+	// maxProjectFiles bounds the walk that collects completion candidates
+	maxProjectFiles = 20000
+)
+
+// mentionLineRange matches the :10 or :10-40 suffix of a line range mention
+var mentionLineRange = regexp.MustCompile(`^(.+):(\d+)(?:-(\d+))?$`)
+
+// bareMention matches an @ on its own, which opens the file browser
+var bareMention = regexp.MustCompile(`(^|\s)@(\s|$)`)
+
+// mention is a file, directory or line range referenced with @ in a message
+type mention struct {
+	path       string // relative to the working directory, slash-separated
+	start, end int    // 1-based line range; zero for the whole file
+}
+
+// label is the mention as written in the message, without the @
+func (m mention) label() string {
+	switch {
+	case m.start == 0:
+		return m.path
+	case m.end == m.start:
+		return fmt.Sprintf("%s:%d", m.path, m.start)
+	default:
+		return fmt.Sprintf("%s:%d-%d", m.path, m.start, m.end)
+	}
+}
+
+// parseMention splits a mention into its path and line range
+func parseMention(raw string) mention {
+	if _, err := os.Stat(raw); err == nil {
+		return mention{path: raw}
+	}
+	parts := mentionLineRange.FindStringSubmatch(raw)
+	if parts == nil {
+		return mention{path: raw}
+	}
+	start, _ := strconv.Atoi(parts[2])
+	end := start
+	if parts[3] != "" {
+		end, _ = strconv.Atoi(parts[3])
+	}
+	if start < 1 || end < start {
+		return mention{path: raw}
+	}
+	return mention{path: parts[1], start: start, end: end}
+}
+
+// mentionContext collects the context blocks attached for the mentions of one message
+type mentionContext struct {
+	blocks []string
+	seen   map[string]bool
+	size   int
+	files  []string // completion candidates, loaded on first use
+}
+
+// String joins the context blocks
+func (c *mentionContext) String() string {
+	return strings.Join(c.blocks, "\n\n")
+}
+
+// candidates lists the files and directories below the working directory
+func (c *mentionContext) candidates() []string {
+	if c.files == nil {
+		c.files = []string{}
+		if root, err := os.Getwd(); err == nil {
+			c.files = listProjectFiles(root)
+		}
+	}
+	return c.files
+}
+
+// listProjectFiles lists the files and directories below root relative to
+// it, skipping ignored paths; directories end in a slash
+func listProjectFiles(root string) []string {
+	files := []string{}
+	_ = fsutil.Walk(root, fsutil.WalkOptions{}, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if len(files) >= maxProjectFiles {
+			return filepath.SkipAll
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			rel += "/"
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files
+}
+
+// resolveMention turns the text after an @ into a mention of an existing
+// path. Unknown paths are only completed when the user picks one of the
+// project's files that fuzzy match it, so at the terminal; elsewhere they are
+// left as typed, as @Override or @alice usually name no file at all.
+// ok is false when the text is left as typed.
+func (a *SimpleAgent) resolveMention(c *mentionContext, raw string) (mention, bool) {
+	m := parseMention(raw)
+	if _, err := os.Stat(m.path); err == nil {
+		return m, true
+	}
+	if !a.fuzzyMentions || len(m.path) < 2 {
+		return m, false
+	}
+
+	candidates := c.candidates()
+	if strings.HasSuffix(m.path, "/") {
+		var dirs []string
+		for _, f := range candidates {
+			if strings.HasSuffix(f, "/") {
+				dirs = append(dirs, f)
+			}
+		}
+		candidates = dirs
+	}
+	matches := fuzzy.Rank(m.path, candidates, maxMentionCandidates)
+	if len(matches) == 0 {
+		return m, false
+	}
+
+	keep := fmt.Sprintf("Leave @%s as typed", raw)
+	options := make([]string, 0, len(matches)+1)
+	for _, match := range matches {
+		options = append(options, match.Str)
+	}
+	reply := a.ask(engine.Question{
+		Prompt:  fmt.Sprintf("📎 No file named %s; did you mean", m.path),
+		Options: append(options, keep),
+	})
+	if reply.Err != nil || reply.Choice < 0 || reply.Choice >= len(matches) {
+		return m, false // kept as typed
+	}
+	choice := matches[reply.Choice].Str
+
+	a.notify(engine.NoticeInfo, "🔎 @%s → %s", m.path, choice)
+	m.path = choice
+	return m, true
+}
+
+// attach adds the contents of a mentioned file, line range or directory and
+// returns a short summary of what was attached
+func (c *mentionContext) attach(m mention) (string, error) {
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	if c.seen[m.label()] {
+		return "", nil
+	}
+	if c.size >= maxMentionTotalBytes {
+		return "", fmt.Errorf("attachment limit of %d KB per message reached", maxMentionTotalBytes/1024)
+	}
+
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return "", err
+	}
+	var block, summary string
+	if info.IsDir() {
+		block, summary, err = c.directoryBlock(m.path)
+	} else {
+		block, summary, err = c.fileBlock(m, min(maxMentionFileBytes, maxMentionTotalBytes-c.size))
+	}
+	if err != nil {
+		return "", err
+	}
+	c.seen[m.label()] = true
+	c.blocks = append(c.blocks, block)
+	c.size += len(block)
+	return summary, nil
+}
+
+// fileBlock renders a file or line range as a labeled context block
+func (c *mentionContext) fileBlock(m mention, limit int) (string, string, error) {
+	if fsutil.IsBinaryFile(m.path) {
+		return "", "", fmt.Errorf("%s is a binary file", m.path)
+	}
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return "", "", err
+	}
+	content := string(data)
+
+	attrs := fmt.Sprintf("path=%q", m.path)
+	if m.start > 0 {
+		lines := strings.SplitAfter(content, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if m.start > len(lines) {
+			return "", "", fmt.Errorf("%s has only %d lines", m.path, len(lines))
+		}
+		end := min(m.end, len(lines))
+		content = strings.Join(lines[m.start-1:end], "")
+		attrs += fmt.Sprintf(" lines=\"%d-%d\"", m.start, end)
+	}
+
+	note := ""
+	total := len(content)
+	if len(content) > limit {
+		cut := strings.LastIndex(content[:limit], "\n")
+		if cut <= 0 {
+			cut = limit
+		}
+		content = content[:cut]
+		note = fmt.Sprintf("\n[truncated: %d of %d bytes shown; mention @%s:<from>-<to> for other lines]", len(content), total, m.path)
+	}
+	content = strings.TrimSuffix(content, "\n")
+
+	lineCount := strings.Count(content, "\n") + 1
+	block := fmt.Sprintf("<file %s>\n%s%s\n</file>", attrs, content, note)
+	summary := fmt.Sprintf("%s (%d lines, %s)", m.label(), lineCount, formatBytes(len(content)))
+	if note != "" {
+		summary += ", truncated"
+	}
+	return block, summary, nil
+}
+
+// directoryBlock renders a directory as a listing followed by the contents of
+// its text files, skipping ignored paths and stopping at the size limits
+func (c *mentionContext) directoryBlock(dir string) (string, string, error) {
+	label := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(dir)), "/") + "/"
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var listing, files []string
+	err = fsutil.Walk(root, fsutil.WalkOptions{}, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			rel += "/"
+		} else {
+			files = append(files, label+rel)
+		}
+		if len(listing) < maxMentionDirListing {
+			listing = append(listing, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<directory path=%q>\n", label)
+	b.WriteString(strings.Join(listing, "\n"))
+	if len(listing) == maxMentionDirListing {
+		b.WriteString("\n...")
+	}
+	b.WriteString("\n</directory>")
+
+	size := b.Len()
+	attached, skipped := 0, 0
+	for _, f := range files {
+		budget := min(maxMentionFileBytes, maxMentionTotalBytes-c.size-size)
+		if attached >= maxMentionDirFiles || budget <= 0 || fsutil.IsImagePath(f) || fsutil.IsBinaryFile(f) {
+			skipped++
+			continue
+		}
+		block, _, err := c.fileBlock(mention{path: f}, budget)
+		if err != nil {
+			skipped++
+			continue
+		}
+		b.WriteString("\n\n" + block)
+		size += len(block) + 2
+		attached++
+	}
+	if skipped > 0 {
+		fmt.Fprintf(&b, "\n\n[%d of %d files in %s not included; mention them individually if needed]", skipped, len(files), label)
+	}
+
+	summary := fmt.Sprintf("%s (%d of %d files, %s)", label, attached, len(files), formatBytes(b.Len()))
+	return b.String(), summary, nil
+}
+
+// formatBytes formats a size for display
+func formatBytes(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%d KB", (n+1023)/1024)
+}
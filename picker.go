@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"atomicgo.dev/cursor"
+	"atomicgo.dev/keyboard"
+	"atomicgo.dev/keyboard/keys"
+	"github.com/pterm/pterm"
+
+	"open-coder/internal/fsutil"
+	"open-coder/internal/fuzzy"
+)
+
+// File picker layout and limits
+const (
+	// pickerRows is how many matches are shown at once
+	pickerRows = 10
+	// pickerPreviewLines is how many lines of the highlighted file are previewed
+	pickerPreviewLines = 10
+	// maxRecentFiles is how many recently picked files are remembered per directory
+	maxRecentFiles = 20
+)
+
+// filePicker is the state of the fuzzy finder
+type filePicker struct {
+	agent    *SimpleAgent
+	files    []string // candidates relative to the working directory
+	recent   map[string]bool
+	query    string
+	matches  []fuzzy.Match
+	cursor   int
+	offset   int // first match shown
+	selected map[string]bool
+	order    []string // selected files in the order they were picked
+	previews map[string][]string
+}
+
+// showFilePicker lets the user fuzzy-find files below the working directory.
+// It returns the picked paths relative to the working directory, or none
+// when cancelled.
+func (a *SimpleAgent) showFilePicker() ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	recent := loadRecentFiles(wd)
+	p := &filePicker{
+		agent:    a,
+		recent:   make(map[string]bool),
+		selected: make(map[string]bool),
+		previews: make(map[string][]string),
+	}
+	// Recent files come first so they are at hand before anything is typed
+	for _, f := range recent {
+		if info, err := os.Stat(f); err == nil && !info.IsDir() {
+			p.files = append(p.files, f)
+			p.recent[f] = true
+		}
+	}
+	for _, f := range listProjectFiles(wd) {
+		if strings.HasSuffix(f, "/") || p.recent[f] || (!a.showHidden && isHiddenPath(f)) {
+			continue
+		}
+		p.files = append(p.files, f)
+	}
+	if len(p.files) == 0 {
+		a.getSystemColorStyle().Println("No files found.")
+		return nil, nil
+	}
+	p.filter()
+
+	area, err := pterm.DefaultArea.Start(p.render())
+	if err != nil {
+		return nil, fmt.Errorf("could not start file picker: %w", err)
+	}
+	cursor.Hide()
+	defer cursor.Show()
+
+	var picked []string
+	err = keyboard.Listen(func(key keys.Key) (bool, error) {
+		switch key.Code {
+		case keys.RuneKey:
+			p.setQuery(p.query + key.String())
+		case keys.Space:
+			p.setQuery(p.query + " ")
+		case keys.Backspace, keys.CtrlH:
+			if r := []rune(p.query); len(r) > 0 {
+				p.setQuery(string(r[:len(r)-1]))
+			}
+		case keys.CtrlU:
+			p.setQuery("")
+		case keys.Up, keys.CtrlP:
+			p.move(-1)
+		case keys.Down, keys.CtrlN:
+			p.move(1)
+		case keys.PgUp:
+			p.move(-pickerRows)
+		case keys.PgDown:
+			p.move(pickerRows)
+		case keys.Tab:
+			p.toggle()
+			p.move(1)
+		case keys.Enter:
+			picked = p.result()
+			return true, nil
+		case keys.Esc, keys.CtrlC:
+			return true, nil
+		}
+		area.Update(p.render())
+		return false, nil
+	})
+	area.Update("")
+	_ = area.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+
+	if len(picked) > 0 {
+		saveRecentFiles(wd, append(picked, recent...))
+	}
+	return picked, nil
+}
+
+// setQuery changes the filter and moves back to the best match
+func (p *filePicker) setQuery(query string) {
+	p.query = query
+	p.cursor, p.offset = 0, 0
+	p.filter()
+}
+
+// filter ranks the files against the query; without a query they keep
+// their order, recent files first
+func (p *filePicker) filter() {
+	if strings.TrimSpace(p.query) == "" {
+		p.matches = make([]fuzzy.Match, len(p.files))
+		for i, f := range p.files {
+			p.matches[i] = fuzzy.Match{Str: f}
+		}
+		return
+	}
+	p.matches = fuzzy.Rank(strings.ReplaceAll(p.query, " ", ""), p.files, 0)
+}
+
+// move moves the highlight by delta matches, scrolling the list as needed
+func (p *filePicker) move(delta int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.cursor = max(0, min(len(p.matches)-1, p.cursor+delta))
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+pickerRows {
+		p.offset = p.cursor - pickerRows + 1
+	}
+}
+
+// toggle adds or removes the highlighted file from the selection
+func (p *filePicker) toggle() {
+	if len(p.matches) == 0 {
+		return
+	}
+	f := p.matches[p.cursor].Str
+	if p.selected[f] {
+		delete(p.selected, f)
+		for i, s := range p.order {
+			if s == f {
+				p.order = append(p.order[:i], p.order[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	p.selected[f] = true
+	p.order = append(p.order, f)
+}
+
+// result is the selection, or the highlighted file when nothing is selected
+func (p *filePicker) result() []string {
+	if len(p.order) > 0 {
+		return p.order
+	}
+	if len(p.matches) == 0 {
+		return nil
+	}
+	return []string{p.matches[p.cursor].Str}
+}
+
+// render draws the query, the visible matches and a preview of the highlighted file
+func (p *filePicker) render() string {
+	a := p.agent
+	width := max(pterm.GetTerminalWidth()-4, 20)
+	var b strings.Builder
+
+	b.WriteString(a.getSystemColorStyle().Sprint("🔍 Find files ") +
+		ui.muted.Sprint("(type to filter · ↑/↓ move · Tab select · Enter confirm · Esc cancel)") + "\n")
+	b.WriteString(a.getUserColorStyle().Sprint("> ") + p.query + ui.muted.Sprint("▏") + "\n")
+
+	status := fmt.Sprintf("  %d/%d files", len(p.matches), len(p.files))
+	if len(p.order) > 0 {
+		status += fmt.Sprintf(" · %d selected", len(p.order))
+	}
+	b.WriteString(ui.muted.Sprint(status) + "\n")
+
+	end := min(p.offset+pickerRows, len(p.matches))
+	for i := p.offset; i < end; i++ {
+		m := p.matches[i]
+		pointer := "  "
+		if i == p.cursor {
+			pointer = a.getUserColorStyle().Sprint("▸ ")
+		}
+		mark := ui.muted.Sprint("○ ")
+		if p.selected[m.Str] {
+			mark = ui.success.Sprint("● ")
+		}
+		line := highlightMatch(m, i == p.cursor)
+		if p.recent[m.Str] {
+			line += ui.muted.Sprint("  (recent)")
+		}
+		b.WriteString(pointer + mark + line + "\n")
+	}
+	for i := end - p.offset; i < pickerRows; i++ {
+		b.WriteString("\n")
+	}
+
+	if len(p.matches) == 0 {
+		b.WriteString(ui.muted.Sprint("── no matches ──"))
+		return b.String()
+	}
+	current := p.matches[p.cursor].Str
+	b.WriteString(ui.muted.Sprint("── "+current+" "+strings.Repeat("─", max(0, width-len(current)-4))) + "\n")
+	for _, line := range p.preview(current) {
+		if len([]rune(line)) > width {
+			line = string([]rune(line)[:width-1]) + "…"
+		}
+		b.WriteString(ui.muted.Sprint(line) + "\n")
+	}
+	return b.String()
+}
+
+// preview returns the first lines of a file, cached per file
+func (p *filePicker) preview(path string) []string {
+	if lines, ok := p.previews[path]; ok {
+		return lines
+	}
+	var lines []string
+	switch info, err := os.Stat(path); {
+	case err != nil:
+		lines = []string{"(cannot read: " + err.Error() + ")"}
+	case fsutil.IsImagePath(path):
+		lines = []string{fmt.Sprintf("(image, %s; attached as an image when picked)", formatBytes(int(info.Size())))}
+	case fsutil.IsBinaryFile(path):
+		lines = []string{fmt.Sprintf("(binary file, %s)", formatBytes(int(info.Size())))}
+	default:
+		data := make([]byte, 4096)
+		f, err := os.Open(path)
+		if err != nil {
+			lines = []string{"(cannot read: " + err.Error() + ")"}
+			break
+		}
+		n, _ := f.Read(data)
+		f.Close()
+		text := strings.ReplaceAll(string(data[:n]), "\t", "    ")
+		// Drop control characters, such as escape sequences, that would garble the picker
+		text = strings.Map(func(r rune) rune {
+			if r != '\n' && unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, text)
+		lines = strings.Split(text, "\n")
+		if len(lines) > pickerPreviewLines {
+			lines = lines[:pickerPreviewLines]
+		}
+	}
+	for len(lines) < pickerPreviewLines {
+		lines = append(lines, "")
+	}
+	p.previews[path] = lines
+	return lines
+}
+
+// highlightMatch renders a match with the characters matching the query emphasized
+func highlightMatch(m fuzzy.Match, current bool) string {
+	matched := make(map[int]bool, len(m.Positions))
+	for _, pos := range m.Positions {
+		matched[pos] = true
+	}
+	plain := ui.text
+	if current {
+		plain = plain.Bold()
+	}
+	var b strings.Builder
+	for i, r := range m.Str {
+		if matched[i] {
+			b.WriteString(ui.accent.Sprint(string(r)))
+		} else {
+			b.WriteString(plain.Sprint(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// isHiddenPath reports whether any segment of a relative path starts with a dot
+func isHiddenPath(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// getRecentFilesPath returns the file that remembers picked files per directory
+func getRecentFilesPath() string {
+	return filepath.Join(filepath.Dir(getConfigPath()), "recent_files.json")
+}
+
+// loadRecentFiles returns the files recently picked in dir, newest first
+func loadRecentFiles(dir string) []string {
+	data, err := os.ReadFile(getRecentFilesPath())
+	if err != nil {
+		return nil
+	}
+	var recent map[string][]string
+	if err := json.Unmarshal(data, &recent); err != nil {
+		return nil
+	}
+	return recent[dir]
+}
+
+// saveRecentFiles remembers the files picked in dir, newest first
+func saveRecentFiles(dir string, files []string) {
+	path := getRecentFilesPath()
+	recent := make(map[string][]string)
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &recent)
+	}
+
+	seen := make(map[string]bool)
+	var list []string
+	for _, f := range files {
+		if !seen[f] && len(list) < maxRecentFiles {
+			seen[f] = true
+			list = append(list, f)
+		}
+	}
+	recent[dir] = list
+
+	data, err := json.MarshalIndent(recent, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openai/openai-go/v2"
+)
+
+// knownReadOnlyTools classifies the bundled tools for servers that do not
+// send a read-only annotation, such as binaries built before they had one
+var knownReadOnlyTools = map[string]bool{
+	"read_file":       true,
+	"read_line_range": true,
+	"list_directory":  true,
+	"repo_map":        true,
+	"search_files":    true,
+	"search_content":  true,
+	"list_symbols":    true,
+	"find_definition": true,
+	"find_references": true,
+	"hover":           true,
+	"diagnostics":     true,
+}
+
+// toolIsReadOnly reports whether a tool only reads, going by its MCP
+// annotations and then the local table
+func toolIsReadOnly(t *mcp.Tool) bool {
+	if t.Annotations != nil && t.Annotations.ReadOnlyHint {
+		return true
+	}
+	return knownReadOnlyTools[t.Name]
+}
+
+// filterTools keeps the tools whose names are marked in keep
+func filterTools(tools []openai.ChatCompletionToolUnionParam, keep map[string]bool) []openai.ChatCompletionToolUnionParam {
+	out := make([]openai.ChatCompletionToolUnionParam, 0, len(tools))
+	for _, tool := range tools {
+		if fn := tool.OfFunction; fn != nil && keep[fn.Function.Name] {
+			out = append(out, tool)
+		}
+	}
+	return out
+}
+
+// planStep is one numbered step of a plan and how far it got
+type planStep struct {
+	text   string
+	status string // "pending", "done" or "failed"
+}
+
+// planPrompt asks the model for a plan while only read-only tools are offered
+const planPrompt = `PLAN MODE. Do not change anything yet; only read-only tools are available.
+Investigate as much as you need, then reply with a numbered plan for the task below: one line per step, formatted "1. ...", "2. ...", each step small enough to carry out and check on its own. Put nothing but the plan in your final reply.
+
+Task: %s`
+
+// planStepLine matches a numbered plan line such as "1. Do this" or "2) That"
+var planStepLine = regexp.MustCompile(`^\s*(?:[-*]\s*)?\*{0,2}(\d+)[.)]\*{0,2}\s+(.+)$`)
+
+// parsePlan extracts the numbered steps from a plan
+func parsePlan(text string) []*planStep {
+	var steps []*planStep
+	for _, line := range strings.Split(text, "\n") {
+		if m := planStepLine.FindStringSubmatch(line); m != nil {
+			steps = append(steps, &planStep{text: strings.TrimSpace(m[2]), status: "pending"})
+		}
+	}
+	return steps
+}
+
+// formatPlan renders steps as a numbered list with their status
+func formatPlan(steps []*planStep, withStatus bool) string {
+	var b strings.Builder
+	for i, step := range steps {
+		mark := ""
+		if withStatus {
+			switch step.status {
+			case "done":
+				mark = "[x] "
+			case "failed":
+				mark = "[!] "
+			default:
+				mark = "[ ] "
+			}
+		}
+		fmt.Fprintf(&b, "%s%d. %s\n", mark, i+1, step.text)
+	}
+	return b.String()
+}
+
+// setPlanMode switches plan mode and refreshes the tools offered to the model
+func (a *SimpleAgent) setPlanMode(on bool) error {
+	a.planMode = on
+	return a.RefreshTools()
+}
+
+// handlePlanCommand runs "/plan <task>": the model investigates with read-only
+// tools and proposes a numbered plan, the user can edit it in $EDITOR, and once
+// approved the steps are carried out one at a time with all tools.
+func (a *SimpleAgent) handlePlanCommand(task string) error {
+	reader := bufio.NewReader(os.Stdin)
+	if task == "" {
+		ui.text.Print("What should the plan accomplish? ")
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		task = strings.TrimSpace(input)
+		if task == "" {
+			return nil
+		}
+	}
+
+	if err := a.setPlanMode(true); err != nil {
+		return err
+	}
+	a.getSystemColorStyle().Printf("📝 Plan mode: %d read-only tools available\n", len(a.tools))
+
+	a.engine.LastReply = ""
+	err := a.runTurn(fmt.Sprintf(planPrompt, task))
+	if modeErr := a.setPlanMode(false); err == nil {
+		err = modeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	steps := parsePlan(a.engine.LastReply)
+	if len(steps) == 0 {
+		return fmt.Errorf("the reply did not contain a numbered plan")
+	}
+
+	for {
+		ui.title.Println("\n📋 PLAN")
+		ui.text.Print(formatPlan(steps, false))
+		ui.text.Println("\n1. Approve and run")
+		ui.text.Println("2. Edit in $EDITOR")
+		ui.text.Println("0. Discard")
+		ui.text.Print("Enter choice (0-2): ")
+
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		switch strings.TrimSpace(input) {
+		case "1":
+			return a.executePlan(task, steps)
+		case "2":
+			edited, err := editPlan(steps)
+			if err != nil {
+				a.getErrorColorStyle().Printf("Edit failed: %v\n", err)
+				continue
+			}
+			if len(edited) == 0 {
+				a.getErrorColorStyle().Println("The edited plan has no numbered steps; keeping the previous one.")
+				continue
+			}
+			steps = edited
+		case "0":
+			a.getSystemColorStyle().Println("Plan discarded.")
+			return nil
+		default:
+			ui.errorText.Println("Invalid choice. Please enter 0, 1 or 2.")
+		}
+	}
+}
+
+// editPlan opens the plan in $VISUAL or $EDITOR and parses the result
+func editPlan(steps []*planStep) ([]*planStep, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "open-coder-plan-*.md")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	content := "# Edit the plan. Numbered lines are the steps; everything else is ignored.\n\n" + formatPlan(steps, false)
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return nil, err
+	}
+	file.Close()
+
+	// Run through the shell so EDITOR may carry arguments, e.g. "code --wait"
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", file.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w", editor, err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return nil, err
+	}
+	return parsePlan(string(data)), nil
+}
+
+// executePlan carries out an approved plan one step at a time with all tools
+// enabled, showing progress after each step. It stops at the first step that
+// fails.
+func (a *SimpleAgent) executePlan(task string, steps []*planStep) error {
+	a.engine.Messages = append(a.engine.Messages, openai.UserMessage(
+		fmt.Sprintf("The plan for %q is approved:\n%s\nI will ask you to carry it out one step at a time.", task, formatPlan(steps, false))))
+
+	for i, step := range steps {
+		ui.title.Printf("\n▶️  Step %d/%d: %s\n", i+1, len(steps), step.text)
+
+		prompt := fmt.Sprintf("Carry out step %d of the plan: %s\nOnly do this step, then briefly say what you did.\n\nProgress so far:\n%s",
+			i+1, step.text, formatPlan(steps, true))
+		a.engine.LastReply = ""
+		err := a.runTurn(prompt)
+		if err == nil && a.engine.LastReply == "" {
+			err = fmt.Errorf("the turn was stopped before the step finished")
+		}
+		if err != nil {
+			step.status = "failed"
+			a.showPlanProgress(steps)
+			return fmt.Errorf("step %d failed: %w", i+1, err)
+		}
+		step.status = "done"
+		a.showPlanProgress(steps)
+	}
+
+	a.getSystemColorStyle().Printf("✅ Plan complete (%d steps)\n", len(steps))
+	return nil
+}
+
+// showPlanProgress prints the plan with the status of each step
+func (a *SimpleAgent) showPlanProgress(steps []*planStep) {
+	for i, step := range steps {
+		switch step.status {
+		case "done":
+			ui.success.Printf("  ✓ %d. %s\n", i+1, step.text)
+		case "failed":
+			ui.errorText.Printf("  ✗ %d. %s\n", i+1, step.text)
+		default:
+			ui.muted.Printf("  ○ %d. %s\n", i+1, step.text)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// preferencesVersion is the schema version of the preferences section of
+// the config file. Bump it and add a migration to preferenceMigrations when
+// a preference is renamed or changes meaning.
+const preferencesVersion = 2
+
+// Preferences are the settings menu choices kept in the config file
+type Preferences struct {
+	Version        int    `json:"version"`
+	Theme          string `json:"theme,omitempty"`
+	AssistantColor string `json:"assistant_color,omitempty"`
+	UserColor      string `json:"user_color,omitempty"`
+	SystemColor    string `json:"system_color,omitempty"`
+	ToolColor      string `json:"tool_color,omitempty"`
+	ErrorColor     string `json:"error_color,omitempty"`
+	ShowTimestamps bool   `json:"show_timestamps"`
+	CompactMode    bool   `json:"compact_mode"`
+	ShowHidden     bool   `json:"show_hidden"`
+	AutoSaveChat   bool   `json:"auto_save_chat"`
+}
+
+// preferenceMigrations upgrade the raw preferences section one version at a
+// time; the migration at index i turns version i+1 into version i+2
+var preferenceMigrations = []func(raw map[string]any){
+	// Version 1 always stored the five text colors, defaults included. Colors
+	// now come from the theme, so drop those equal to the old defaults and keep
+	// only real choices as overrides.
+	func(raw map[string]any) {
+		defaults := map[string]string{
+			"assistant_color": "FgLightCyan",
+			"user_color":      "FgLightWhite",
+			"system_color":    "FgLightBlue",
+			"tool_color":      "FgLightGreen",
+			"error_color":     "FgLightRed",
+		}
+		for key, color := range defaults {
+			if raw[key] == color {
+				delete(raw, key)
+			}
+		}
+	},
+}
+
+// migratePreferences brings a raw preferences section up to the current
+// version. Sections from a newer version are left as they are; fields this
+// version does not know are ignored when decoding but kept when saving.
+func migratePreferences(raw map[string]any) (map[string]any, error) {
+	version := 1
+	if v, ok := raw["version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f < 1 {
+			return nil, fmt.Errorf("invalid preferences version %v", v)
+		}
+		version = int(f)
+	}
+	for ; version < preferencesVersion; version++ {
+		preferenceMigrations[version-1](raw)
+	}
+	if version == preferencesVersion {
+		raw["version"] = preferencesVersion
+	}
+	return raw, nil
+}
+
+// decodePreferences reads the preferences section of a config, migrating
+// older versions
+func decodePreferences(section json.RawMessage) (*Preferences, map[string]any, error) {
+	raw := make(map[string]any)
+	if len(section) > 0 {
+		if err := json.Unmarshal(section, &raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse preferences: %w", err)
+		}
+	}
+	raw, err := migratePreferences(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	var prefs Preferences
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse preferences: %w", err)
+	}
+	return &prefs, raw, nil
+}
+
+// loadPreferences applies the preferences saved in the config file. A
+// missing or unreadable section leaves the defaults in place.
+func (a *SimpleAgent) loadPreferences() {
+	config, err := loadConfig()
+	if err != nil || len(config.Preferences) == 0 {
+		return
+	}
+	prefs, _, err := decodePreferences(config.Preferences)
+	if err != nil {
+		ui.warning.Printf("⚠️  Warning: Ignoring saved preferences: %v\n", err)
+		return
+	}
+	if prefs.Version > preferencesVersion {
+		ui.warning.Printf("⚠️  Warning: Preferences were saved by a newer version (%d); settings it added are kept but not used\n", prefs.Version)
+	}
+
+	if prefs.Theme != "" {
+		if err := a.applyTheme(prefs.Theme); err != nil {
+			ui.warning.Printf("⚠️  Warning: Using the %s theme: %v\n", a.theme, err)
+		}
+	}
+	for _, c := range []struct {
+		field *string
+		value string
+	}{
+		{&a.assistantColor, prefs.AssistantColor},
+		{&a.userColor, prefs.UserColor},
+		{&a.systemColor, prefs.SystemColor},
+		{&a.toolColor, prefs.ToolColor},
+		{&a.errorColor, prefs.ErrorColor},
+	} {
+		if c.value != "" {
+			*c.field = c.value
+		}
+	}
+	a.showTimestamps = prefs.ShowTimestamps
+	a.compactMode = prefs.CompactMode
+	a.showHidden = prefs.ShowHidden
+	a.autoSaveChat = prefs.AutoSaveChat
+}
+
+// loadSavedTheme applies the theme saved in the preferences, so output
+// shown before the agent is set up already uses it. Problems are reported
+// once the preferences are loaded.
+func loadSavedTheme() {
+	config, err := loadConfig()
+	if err != nil || len(config.Preferences) == 0 {
+		return
+	}
+	prefs, _, err := decodePreferences(config.Preferences)
+	if err != nil || prefs.Theme == "" {
+		return
+	}
+	if t, err := loadTheme(prefs.Theme); err == nil {
+		ui = t
+	}
+}
+
+// savePreferences writes the current settings to the config file, keeping
+// the rest of the file and any preferences added by newer versions. A config
+// file that cannot be read is left alone rather than replaced.
+func (a *SimpleAgent) savePreferences() error {
+	config, err := loadConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		config = &Config{}
+	} else if err != nil {
+		return err
+	}
+	_, raw, err := decodePreferences(config.Preferences)
+	if err != nil {
+		return err
+	}
+
+	version := preferencesVersion
+	if v, ok := raw["version"].(float64); ok && int(v) > version {
+		version = int(v)
+	}
+	prefs := Preferences{
+		Version:        version,
+		Theme:          a.theme,
+		AssistantColor: a.assistantColor,
+		UserColor:      a.userColor,
+		SystemColor:    a.systemColor,
+		ToolColor:      a.toolColor,
+		ErrorColor:     a.errorColor,
+		ShowTimestamps: a.showTimestamps,
+		CompactMode:    a.compactMode,
+		ShowHidden:     a.showHidden,
+		AutoSaveChat:   a.autoSaveChat,
+	}
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	var known map[string]any
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+	for k, v := range known {
+		raw[k] = v
+	}
+
+	section, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	config.Preferences = section
+	return saveConfig(config)
+}
+
+// persistPreferences saves the settings after a change, warning when that fails
+func (a *SimpleAgent) persistPreferences() {
+	if err := a.savePreferences(); err != nil {
+		ui.warning.Printf("⚠️  Warning: Could not save preferences: %v\n", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMigratePreferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		want    map[string]any
+	}{
+		{
+			name:    "empty",
+			section: `{}`,
+			want: map[string]any{
+				"version": float64(preferencesVersion),
+			},
+		},
+		{
+			name:    "v1 with defaults",
+			section: `{"version": 1, "assistant_color": "FgLightCyan", "user_color": "FgLightWhite", "system_color": "FgLightBlue", "tool_color": "FgLightGreen", "error_color": "FgLightRed", "auto_save_chat": true}`,
+			want: map[string]any{
+				"version":        float64(preferencesVersion),
+				"auto_save_chat": true,
+			},
+		},
+		{
+			name:    "v1 with chosen colors",
+			section: `{"version": 1, "assistant_color": "FgMagenta", "error_color": "FgLightRed"}`,
+			want: map[string]any{
+				"version":         float64(preferencesVersion),
+				"assistant_color": "FgMagenta",
+			},
+		},
+		{
+			name:    "current",
+			section: `{"version": 2, "theme": "light", "assistant_color": "FgLightCyan", "compact_mode": true}`,
+			want: map[string]any{
+				"version":         float64(preferencesVersion),
+				"theme":           "light",
+				"assistant_color": "FgLightCyan",
+				"compact_mode":    true,
+			},
+		},
+		{
+			name:    "newer version",
+			section: `{"version": 9, "assistant_color": "FgMagenta", "new_setting": "kept"}`,
+			want: map[string]any{
+				"version":         float64(9),
+				"assistant_color": "FgMagenta",
+				"new_setting":     "kept",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, raw, err := decodePreferences(json.RawMessage(tt.section))
+			if err != nil {
+				t.Fatalf("decodePreferences: %v", err)
+			}
+			// Compare as saved, so versions set during migration are numbers too
+			data, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigratePreferencesInvalidVersion(t *testing.T) {
+	for _, section := range []string{`{"version": "2"}`, `{"version": 0}`, `{"version": -1}`} {
+		if _, _, err := decodePreferences(json.RawMessage(section)); err == nil {
+			t.Errorf("decodePreferences(%s) succeeded, want an error", section)
+		}
+	}
+}
+
+func TestSavePreferencesKeepsUnreadableConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, ".open-coder", "config")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	broken := []byte(`{"api_key": "secret", "model": `)
+	if err := os.WriteFile(path, broken, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &SimpleAgent{theme: "light", compactMode: true}
+	if err := a.savePreferences(); err == nil {
+		t.Fatal("savePreferences succeeded over an invalid config file")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(broken) {
+		t.Errorf("config file was rewritten to %s", data)
+	}
+}
+
+func TestSavePreferencesCreatesMissingConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	a := &SimpleAgent{theme: "light", compactMode: true}
+	if err := a.savePreferences(); err != nil {
+		t.Fatalf("savePreferences: %v", err)
+	}
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs, _, err := decodePreferences(config.Preferences)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Version != preferencesVersion || prefs.Theme != "light" || !prefs.CompactMode {
+		t.Errorf("saved preferences = %+v", prefs)
+	}
+}
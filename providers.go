@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+
+	"open-coder/engine"
+)
+
+// FallbackProvider is an alternative endpoint tried, in order, when the
+// primary one keeps failing. Empty fields inherit the primary's values.
+type FallbackProvider struct {
+	BaseURL string `json:"base_url,omitempty"`
+	APIKey  string `json:"api_key,omitempty"`
+	Model   string `json:"model"`
+}
+
+// providers returns the primary provider followed by the fallbacks
+func (a *SimpleAgent) providers(fallbacks []FallbackProvider) []engine.Provider {
+	list := []engine.Provider{{Client: a.openaiClient, Model: a.model, Host: hostOf(a.baseURL)}}
+	for _, fb := range fallbacks {
+		baseURL, apiKey, model := fb.BaseURL, fb.APIKey, fb.Model
+		if baseURL == "" {
+			baseURL = a.baseURL
+		}
+		if apiKey == "" {
+			apiKey = a.apiKey
+		}
+		if model == "" {
+			model = a.model
+		}
+		client := openai.NewClient(
+			option.WithAPIKey(apiKey),
+			option.WithBaseURL(baseURL),
+			option.WithMaxRetries(0),
+		)
+		list = append(list, engine.Provider{Client: &client, Model: model, Host: hostOf(baseURL)})
+	}
+	return list
+}
+
+// hostOf returns the host of a base URL for display
+func hostOf(baseURL string) string {
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return baseURL
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+
+	"open-coder/engine"
+)
+
+// serveSubscriberBuffer is how many events a slow client may fall behind
+// before it is dropped
+const serveSubscriberBuffer = 256
+
+// servePingInterval keeps idle event streams from being closed by proxies
+const servePingInterval = 15 * time.Second
+
+// server exposes sessions of the agent over HTTP. Turn events are streamed
+// as server-sent events; questions the agent asks during a turn are answered
+// with a separate request.
+type server struct {
+	base  *SimpleAgent // Owns the MCP connections shared by every session
+	token string
+
+	mu       sync.Mutex
+	sessions map[string]*serverSession
+}
+
+// serverSession is one conversation and the clients following it
+type serverSession struct {
+	agent *SimpleAgent
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc         // Stops the running turn; nil when idle
+	done      chan struct{}              // Closed when the last turn ended
+	backlog   []serverEvent              // Events of the running turn, for late subscribers
+	subs      map[chan serverEvent]bool  // Clients following the session
+	questions map[string]engine.Question // Unanswered questions by ID
+	asked     int                        // Questions asked so far, for IDs
+}
+
+// serverEvent is an event as sent to clients
+type serverEvent struct {
+	Type string
+	Data map[string]any
+}
+
+// sessionInfo describes a session in responses
+type sessionInfo struct {
+	ID        string    `json:"id"`
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	Messages  int       `json:"messages"`
+	Active    bool      `json:"active"` // Loaded in the server
+	Busy      bool      `json:"busy"`   // A turn is running
+}
+
+// runServe runs `open-coder serve`
+func runServe(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "address to listen on")
+	tokenFlag := flags.String("token", "", "bearer token clients must send (default: $OPEN_CODER_TOKEN or a generated one)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	token, err := serveToken(*tokenFlag)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	base, _, err := startHeadlessAgent(ctx)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+
+	s := &server{base: base, token: token, sessions: make(map[string]*serverSession)}
+	httpServer := &http.Server{Addr: *addr, Handler: s.routes()}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	pterm.Success.Printf("Serving %d tools on http://%s\n", len(base.tools), *addr)
+	pterm.Info.Printf("Bearer token: %s\n", token)
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	s.stopAll()
+	return nil
+}
+
+// serveToken returns the token clients must present: the flag, then
+// OPEN_CODER_TOKEN, then one kept in ~/.open-coder/serve-token, generated on
+// first use
+func serveToken(token string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	if token := strings.TrimSpace(os.Getenv("OPEN_CODER_TOKEN")); token != "" {
+		return token, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	path := filepath.Join(homeDir, ".open-coder", "serve-token")
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(raw)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
+	}
+	return token, nil
+}
+
+// routes returns the server's handler
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", s.handleList)
+	mux.HandleFunc("POST /sessions", s.handleCreate)
+	mux.HandleFunc("GET /sessions/{id}", s.handleGet)
+	mux.HandleFunc("DELETE /sessions/{id}", s.handleDelete)
+	mux.HandleFunc("POST /sessions/{id}/resume", s.handleResume)
+	mux.HandleFunc("POST /sessions/{id}/messages", s.handleMessage)
+	mux.HandleFunc("GET /sessions/{id}/events", s.handleEvents)
+	mux.HandleFunc("POST /sessions/{id}/answers", s.handleAnswer)
+	mux.HandleFunc("POST /sessions/{id}/cancel", s.handleCancel)
+	return s.authorize(mux)
+}
+
+// authorize rejects requests without the bearer token. Browsers cannot set
+// headers on an EventSource, so the token may also come as ?token=.
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	infos := make([]sessionInfo, 0, len(s.sessions))
+	seen := make(map[string]bool)
+	for id, session := range s.sessions {
+		infos = append(infos, session.info())
+		seen[id] = true
+	}
+	s.mu.Unlock()
+
+	// Saved sessions of this directory can be resumed
+	wd, _ := os.Getwd()
+	saved, _ := listSessions(wd)
+	for _, file := range saved {
+		if !seen[file.ID] {
+			infos = append(infos, sessionInfo{
+				ID:        file.ID,
+				Model:     file.Model,
+				CreatedAt: file.CreatedAt,
+				UpdatedAt: file.UpdatedAt,
+				Messages:  len(file.Messages),
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	session := s.add(s.newAgent())
+	writeJSON(w, http.StatusCreated, session.info())
+}
+
+func (s *server) handleGet(w http.ResponseWriter, r *http.Request) {
+	session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, session.info())
+}
+
+func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := sessionPath(id); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	session := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if session != nil {
+		// The turn saves the session as it ends, so let it end first
+		session.stop()
+		session.wait()
+	} else if _, err := loadSession(id); err != nil {
+		writeError(w, http.StatusNotFound, "no such session")
+		return
+	}
+	if err := deleteSession(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleResume(w http.ResponseWriter, r *http.Request) {
+	session, err := s.resume(r.PathValue("id"))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		writeError(w, http.StatusNotFound, "no such session")
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, session.info())
+}
+
+func (s *server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	var body struct {
+		Input string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Input) == "" {
+		writeError(w, http.StatusBadRequest, `expected a JSON body with a non-empty "input"`)
+		return
+	}
+
+	// Subscribe first so the stream starts with the turn's first event
+	events := session.subscribe(false)
+	defer session.unsubscribe(events)
+	if !session.start(s.base.ctx, body.Input) {
+		writeError(w, http.StatusConflict, "a turn is already running in this session")
+		return
+	}
+	streamEvents(w, r, events, true)
+}
+
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	events := session.subscribe(true)
+	defer session.unsubscribe(events)
+	streamEvents(w, r, events, false)
+}
+
+func (s *server) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	var body struct {
+		QuestionID string `json:"question_id"`
+		Choice     *int   `json:"choice"`
+		Text       string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "expected a JSON body")
+		return
+	}
+
+	session.mu.Lock()
+	question, ok := session.questions[body.QuestionID]
+	delete(session.questions, body.QuestionID)
+	session.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such question, or it was already answered")
+		return
+	}
+
+	reply := engine.Reply{Choice: -1, Text: body.Text}
+	if body.Choice != nil {
+		if *body.Choice < 0 || *body.Choice >= len(question.Options) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("choice must be between 0 and %d", len(question.Options)-1))
+			return
+		}
+		reply = engine.Reply{Choice: *body.Choice, Text: question.Options[*body.Choice]}
+	}
+	question.Answer(reply)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	if !session.stop() {
+		writeError(w, http.StatusConflict, "no turn is running in this session")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newAgent starts the agent of a new session. Tools that are not read-only
+// only run once a client allows them, answering the question that asks.
+func (s *server) newAgent() *SimpleAgent {
+	agent := s.base.newSession()
+	agent.engine.ConfirmTools = true
+	return agent
+}
+
+// newServerSession wraps an agent as a session for clients
+func newServerSession(agent *SimpleAgent) *serverSession {
+	return &serverSession{
+		agent:     agent,
+		subs:      make(map[chan serverEvent]bool),
+		questions: make(map[string]engine.Question),
+	}
+}
+
+// add makes a session available to clients
+func (s *server) add(agent *SimpleAgent) *serverSession {
+	session := newServerSession(agent)
+	s.mu.Lock()
+	s.sessions[agent.sessionID] = session
+	s.mu.Unlock()
+	return session
+}
+
+// resume returns the active session with the ID, loading the saved session
+// when there is none. The check and the insert happen under one lock, so
+// concurrent requests cannot load the same session twice.
+func (s *server) resume(id string) (*serverSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session := s.sessions[id]; session != nil {
+		return session, nil
+	}
+
+	saved, err := loadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	agent := s.newAgent()
+	agent.restoreSession(saved)
+	session := newServerSession(agent)
+	s.sessions[agent.sessionID] = session
+	return session, nil
+}
+
+// session returns the active session named in the path, answering the
+// request itself when there is none
+func (s *server) session(w http.ResponseWriter, r *http.Request) *serverSession {
+	s.mu.Lock()
+	session := s.sessions[r.PathValue("id")]
+	s.mu.Unlock()
+	if session == nil {
+		writeError(w, http.StatusNotFound, "no such active session; create or resume one first")
+	}
+	return session
+}
+
+// stopAll stops every running turn and waits for them to end
+func (s *server) stopAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		session.stop()
+		session.wait()
+	}
+}
+
+// info describes the session
+func (s *serverSession) info() sessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := sessionInfo{
+		ID:        s.agent.sessionID,
+		Model:     s.agent.model,
+		CreatedAt: s.agent.sessionStarted,
+		Active:    true,
+		Busy:      s.cancel != nil,
+	}
+	// The conversation belongs to the turn while one runs
+	if s.cancel == nil {
+		info.Messages = len(s.agent.engine.Messages)
+	}
+	return info
+}
+
+// start runs a turn in the background, reporting false when one is already
+// running
+func (s *serverSession) start(ctx context.Context, input string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel, s.done = cancel, make(chan struct{})
+
+	go func() {
+		defer cancel()
+		for ev := range s.agent.Run(ctx, input) {
+			if q, ok := ev.(engine.Question); ok {
+				s.ask(q)
+				continue
+			}
+			if typ, data := encodeEvent(ev); typ != "" {
+				s.publish(serverEvent{Type: typ, Data: data})
+			}
+		}
+		s.finish()
+	}()
+	return true
+}
+
+// ask keeps a question until a client answers it
+func (s *serverSession) ask(q engine.Question) {
+	s.mu.Lock()
+	s.asked++
+	id := "q" + strconv.Itoa(s.asked)
+	s.questions[id] = q
+	s.mu.Unlock()
+
+	options := q.Options
+	if options == nil {
+		options = []string{}
+	}
+	data := map[string]any{
+		"id":         id,
+		"prompt":     q.Prompt,
+		"options":    options,
+		"allow_text": q.AllowText,
+	}
+	if q.ToolCallID != "" {
+		data["tool_call_id"] = q.ToolCallID
+	}
+	s.publish(serverEvent{Type: "question", Data: data})
+}
+
+// finish ends the running turn
+func (s *serverSession) finish() {
+	s.publish(serverEvent{Type: "done", Data: map[string]any{}})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel = nil
+	s.backlog = nil
+	clear(s.questions)
+	close(s.done)
+}
+
+// wait returns once no turn is running
+func (s *serverSession) wait() {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// stop cancels the running turn, reporting whether there was one
+func (s *serverSession) stop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		return false
+	}
+	s.cancel()
+	return true
+}
+
+// publish sends an event to every subscriber. A subscriber that has fallen
+// too far behind is dropped rather than holding up the turn.
+func (s *serverSession) publish(ev serverEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backlog = append(s.backlog, ev)
+	for ch := range s.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe follows the session's events. With replay the events of the
+// running turn so far are delivered first.
+func (s *serverSession) subscribe(replay bool) chan serverEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan serverEvent, serveSubscriberBuffer+len(s.backlog))
+	if replay {
+		for _, ev := range s.backlog {
+			ch <- ev
+		}
+	}
+	s.subs[ch] = true
+	return ch
+}
+
+// unsubscribe stops following the session
+func (s *serverSession) unsubscribe(ch chan serverEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[ch] {
+		delete(s.subs, ch)
+		close(ch)
+	}
+}
+
+// streamEvents writes events as server-sent events until the client goes
+// away, the subscription is dropped or, with untilDone, the turn ends
+func streamEvents(w http.ResponseWriter, r *http.Request, events <-chan serverEvent, untilDone bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(servePingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(ev.Data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			if untilDone && ev.Type == "done" {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// encodeEvent converts a turn event to its type and payload for clients. It
+// returns an empty type for events clients have no use for.
+func encodeEvent(ev engine.Event) (string, map[string]any) {
+	switch ev := ev.(type) {
+	case engine.TurnStarted:
+		return "turn_started", map[string]any{"input": ev.Input}
+	case engine.TurnFinished:
+		return "turn_finished", map[string]any{"elapsed_ms": ev.Elapsed.Milliseconds()}
+	case engine.ResponseStarted:
+		return "response_started", map[string]any{}
+	case engine.TextDelta:
+		return "text_delta", map[string]any{"text": ev.Text}
+	case engine.ResponseFinished:
+		return "response_finished", map[string]any{"error": errorText(ev.Err)}
+	case engine.Usage:
+		return "usage", map[string]any{
+			"prompt_tokens":     ev.PromptTokens,
+			"completion_tokens": ev.CompletionTokens,
+			"total_tokens":      ev.TotalTokens,
+		}
+	case engine.Notice:
+		level := map[engine.NoticeLevel]string{
+			engine.NoticeInfo:    "info",
+			engine.NoticeWarning: "warning",
+			engine.NoticeError:   "error",
+		}[ev.Level]
+		return "notice", map[string]any{"level": level, "text": ev.Text}
+	case engine.ToolCallStarted:
+		return "tool_call_started", map[string]any{"id": ev.ID, "name": ev.Name, "args": ev.Args}
+	case engine.ToolCallInvalid:
+		return "tool_call_invalid", map[string]any{"id": ev.ID, "name": ev.Name, "error": errorText(ev.Err)}
+	case engine.ToolCallRunning:
+		return "tool_call_running", map[string]any{"id": ev.ID, "label": ev.Label}
+	case engine.ToolCallResult:
+		return "tool_call_result", map[string]any{
+			"id":          ev.ID,
+			"name":        ev.Name,
+			"result":      ev.Result,
+			"error":       errorText(ev.Err),
+			"duration_ms": ev.Duration.Milliseconds(),
+		}
+	case engine.TodosChanged:
+		return "todos_changed", map[string]any{"items": ev.Items}
+	case engine.Error:
+		return "error", map[string]any{"error": errorText(ev.Err), "canceled": errors.Is(ev.Err, context.Canceled)}
+	}
+	// Batch progress duplicates the per-call events
+	return "", nil
+}
+
+// errorText returns the error's message, or "" for none
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// writeJSON writes v as the response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// sessionVersion changes whenever the session file format does
+const sessionVersion = 1
+
+// sessionFile is the on-disk state of a session: its todo list and, when
+// auto-save is on, the conversation
+type sessionFile struct {
+	Version   int                                      `json:"version"`
+	ID        string                                   `json:"id"`
+	Dir       string                                   `json:"dir"`
+	Model     string                                   `json:"model"`
+	CreatedAt time.Time                                `json:"created_at"`
+	UpdatedAt time.Time                                `json:"updated_at"`
+	Todos     []todoItem                               `json:"todos,omitempty"`
+	Messages  []openai.ChatCompletionMessageParamUnion `json:"messages,omitempty"`
+}
+
+// getSessionsDir returns the directory holding saved sessions
+func getSessionsDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = "~" // fallback
+	}
+	return filepath.Join(homeDir, ".open-coder", "sessions")
+}
+
+// newSessionID returns a sortable, unique session ID
+func newSessionID() string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// saveSession writes the session state. Nothing is written until there is a
+// todo list or a conversation to auto-save. Failures are ignored; saving only
+// helps a later session pick up where this one stopped.
+func (a *SimpleAgent) saveSession() {
+	if a.sessionID == "" {
+		return
+	}
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+
+	var todos []todoItem
+	if a.todos != nil {
+		todos = a.todos.snapshot()
+	}
+	if !a.sessionSaved && len(todos) == 0 && !a.autoSaveChat {
+		return
+	}
+
+	var wd string
+	a.inWorkDir(func() { wd, _ = os.Getwd() })
+	session := sessionFile{
+		Version:   sessionVersion,
+		ID:        a.sessionID,
+		Dir:       wd,
+		Model:     a.model,
+		CreatedAt: a.sessionStarted,
+		UpdatedAt: time.Now(),
+		Todos:     todos,
+	}
+	if a.autoSaveChat {
+		session.Messages = a.engine.Messages
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(getSessionsDir(), 0700); err != nil {
+		return
+	}
+	path := filepath.Join(getSessionsDir(), a.sessionID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, path); err == nil {
+		a.sessionSaved = true
+	}
+}
+
+// listSessions returns the saved sessions for dir, most recently updated first
+func listSessions(dir string) ([]*sessionFile, error) {
+	entries, err := os.ReadDir(getSessionsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*sessionFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(getSessionsDir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		var session sessionFile
+		if err := json.Unmarshal(data, &session); err != nil || session.Version != sessionVersion || session.Dir != dir {
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt) })
+	return sessions, nil
+}
+
+// latestSession returns the most recently updated saved session for dir
+func latestSession(dir string) (*sessionFile, error) {
+	sessions, err := listSessions(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return sessions[0], nil
+}
+
+// sessionIDPattern matches the IDs made by newSessionID
+var sessionIDPattern = regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{6}$`)
+
+// sessionPath returns the file of a saved session, rejecting anything that
+// is not a session ID so it cannot name another file
+func sessionPath(id string) (string, error) {
+	if !sessionIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	return filepath.Join(getSessionsDir(), id+".json"), nil
+}
+
+// loadSession reads a saved session by ID
+func loadSession(id string) (*sessionFile, error) {
+	path, err := sessionPath(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var session sessionFile
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("reading session %s: %w", id, err)
+	}
+	if session.Version != sessionVersion {
+		return nil, fmt.Errorf("session %s was saved in an unsupported format (version %d)", id, session.Version)
+	}
+	return &session, nil
+}
+
+// deleteSession removes a saved session; a session never saved is not an error
+func deleteSession(id string) error {
+	path, err := sessionPath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// newSession starts a separate conversation that shares the agent's
+// configuration, MCP connections and tools but has its own history, todo
+// list and built-in tool state. Its conversation is always saved so that it
+// can be resumed.
+func (a *SimpleAgent) newSession() *SimpleAgent {
+	session := &SimpleAgent{
+		ctx:             a.ctx,
+		mcpClient:       a.mcpClient,
+		servers:         a.servers,
+		openaiClient:    a.openaiClient,
+		model:           a.model,
+		apiKey:          a.apiKey,
+		baseURL:         a.baseURL,
+		userID:          a.userID,
+		tools:           a.tools,
+		theme:           a.theme,
+		autoSaveChat:    true,
+		toolServers:     a.toolServers,
+		toolSchemas:     a.toolSchemas,
+		serialServers:   a.serialServers,
+		readOnlyTools:   a.readOnlyTools,
+		subAgentModel:   a.subAgentModel,
+		builtins:        defaultBuiltinTools(),
+		askUserFallback: a.askUserFallback,
+		todos:           &todoList{},
+		sessionID:       newSessionID(),
+		sessionStarted:  time.Now(),
+	}
+	session.useEngine(a.engine.Config)
+	session.InitConversation(a.systemPrompt)
+	return session
+}
+
+// restoreSession continues a saved session: its ID, todo list and, when the
+// conversation was saved, the conversation
+func (a *SimpleAgent) restoreSession(saved *sessionFile) {
+	a.sessionID, a.sessionStarted, a.sessionSaved = saved.ID, saved.CreatedAt, true
+	a.todos.set(saved.Todos)
+	a.todos.takeChanged()
+	if len(saved.Messages) > 0 {
+		a.engine.Messages = saved.Messages
+	} else {
+		a.InitConversation(a.systemPrompt)
+	}
+}
+
+// restoreTodos carries over an unfinished todo list from the last session in
+// the working directory, so long tasks survive a restart. It returns how many
+// items were restored.
+func (a *SimpleAgent) restoreTodos() int {
+	wd, err := os.Getwd()
+	if err != nil {
+		return 0
+	}
+	session, err := latestSession(wd)
+	if err != nil {
+		return 0
+	}
+	for _, item := range session.Todos {
+		if item.Status != todoCompleted {
+			a.todos.set(session.Todos)
+			a.todos.takeChanged()
+			return len(session.Todos)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"open-coder/engine"
+)
+
+// subAgentExcludedTools are never given to sub-agents: they may not start
+// sub-agents of their own, have no user to talk to and do not own the todo list
+var subAgentExcludedTools = map[string]bool{
+	"delegate_task": true,
+	"ask_user":      true,
+	"todo_write":    true,
+	"todo_read":     true,
+}
+
+// subAgentPrompt is the system prompt of a sub-agent
+const subAgentPrompt = `You are a sub-agent working on one task for another assistant, which will only see your final reply.
+Use the tools available to you to complete the task. Work efficiently: search before reading whole files and read only what you need.
+When you are done, reply with a concise summary of what you found or did: the key facts, file paths and line numbers, and anything left unresolved. Do not include long file contents.`
+
+// delegateTaskTool hands a task to a sub-agent
+type delegateTaskTool struct{}
+
+func (t *delegateTaskTool) Name() string { return "delegate_task" }
+
+func (t *delegateTaskTool) Description() string {
+	return "Hand a self-contained task to a sub-agent that works in its own context and returns only a summary. " +
+		"Use it for broad exploration or searches whose intermediate results you do not need to see, " +
+		"and call it several times in one response to run independent tasks in parallel."
+}
+
+func (t *delegateTaskTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"task": map[string]any{
+				"type":        "string",
+				"description": "What the sub-agent should do and what its summary should contain. It cannot see this conversation, so include all needed context",
+			},
+			"tools": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Names of the tools the sub-agent may use (default: the read-only tools)",
+			},
+			"model": map[string]any{
+				"type":        "string",
+				"description": "Model for the sub-agent (default: the configured sub-agent model, or the current model)",
+			},
+		},
+		"required": []any{"task"},
+	}
+}
+
+// ReadOnly is true because sub-agents only get tools this agent offers, so in
+// plan mode they cannot change anything either
+func (t *delegateTaskTool) ReadOnly() bool { return true }
+
+// Call runs a sub-agent and returns its summary. The sub-agent has its own
+// messages, may use only the requested subset of the agent's tools and
+// reports nothing but its final reply, so its intermediate tool output never
+// reaches the agent's context.
+func (t *delegateTaskTool) Call(a *SimpleAgent, args map[string]any) (string, error) {
+	task, _ := args["task"].(string)
+	if strings.TrimSpace(task) == "" {
+		return "", fmt.Errorf("task is required")
+	}
+
+	model := a.subAgentModel
+	if m, ok := args["model"].(string); ok && m != "" {
+		model = m
+	}
+	if model == "" {
+		model = a.model
+	}
+
+	// Only tools this agent offers right now, so plan mode stays read-only
+	allowed := make(map[string]bool)
+	if names, ok := args["tools"].([]any); ok && len(names) > 0 {
+		for _, n := range names {
+			name, _ := n.(string)
+			if _, offered := a.toolSchemas[name]; !offered || subAgentExcludedTools[name] {
+				return "", fmt.Errorf("tool %q is not available to sub-agents", name)
+			}
+			allowed[name] = true
+		}
+	} else {
+		for name := range a.toolSchemas {
+			if a.readOnlyTools[name] && !subAgentExcludedTools[name] {
+				allowed[name] = true
+			}
+		}
+	}
+
+	child := &SimpleAgent{
+		ctx:           a.ctx,
+		openaiClient:  a.openaiClient,
+		model:         model,
+		servers:       a.servers,
+		toolServers:   a.toolServers,
+		builtins:      a.builtins,
+		readOnlyTools: a.readOnlyTools,
+		tools:         filterTools(a.tools, allowed),
+		userID:        a.userID,
+		inDir:         a.inDir,
+	}
+	child.toolSchemas = toolSchemaIndex(child.tools)
+
+	// The agent's providers with the sub-agent's model on the primary one;
+	// the fallbacks keep their own models, as their endpoints may lack it
+	providers := slices.Clone(a.engine.Providers)
+	providers[0].Model = model
+
+	child.engine = engine.New(engine.Config{
+		Providers:      providers,
+		Tools:          agentTools{child},
+		Limits:         a.engine.Limits,
+		MaxRetries:     a.engine.MaxRetries,
+		MaxToolRepairs: a.engine.MaxToolRepairs,
+		AtLimit: func(reason string) (engine.LimitAction, string) {
+			return engine.LimitWrapUp, fmt.Sprintf("Stop here (%s). Reply with a summary of what you found so far and what remains.", reason)
+		},
+	}, subAgentPrompt)
+	return child.runSubAgent(task)
+}
+
+// runSubAgent works on a task until the model stops calling tools and
+// returns its final reply. Nothing is shown and there is nobody to ask;
+// when a turn limit is reached the sub-agent is asked for a summary of its
+// progress instead.
+func (a *SimpleAgent) runSubAgent(task string) (string, error) {
+	err := a.engine.Turn(a.ctx, task, func(ev engine.Event) {
+		if q, ok := ev.(engine.Question); ok {
+			q.Answer(engine.Reply{Choice: -1, Err: engine.ErrNoUser})
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("sub-agent failed: %w", err)
+	}
+	summary := strings.TrimSpace(a.engine.LastReply)
+	if summary == "" {
+		summary = "The sub-agent finished without a summary."
+	}
+	return summary, nil
+}
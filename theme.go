@@ -0,0 +1,547 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// defaultThemeName is used when the preferences name no theme
+const defaultThemeName = "dark"
+
+// Text attributes of a Style
+const (
+	attrBold uint8 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+)
+
+// colorsDisabled turns all styles into plain text; see https://no-color.org
+var colorsDisabled = os.Getenv("NO_COLOR") != ""
+
+// trueColor reports whether the terminal shows 24-bit colors; hex colors
+// are approximated with the 256-color palette otherwise
+var trueColor = func() bool {
+	ct := strings.ToLower(os.Getenv("COLORTERM"))
+	return ct == "truecolor" || ct == "24bit"
+}()
+
+// Style is how a UI element is drawn: a foreground and background color and
+// text attributes. Its print methods mirror pterm.Color, so styles can be
+// used wherever a pterm color was. The zero Style prints plain text.
+type Style struct {
+	fg, bg string // SGR color parameters, e.g. "96" or "38;5;208"
+	attrs  uint8
+}
+
+// Bold returns the style with bold text
+func (s Style) Bold() Style { s.attrs |= attrBold; return s }
+
+// Italic returns the style with italic text
+func (s Style) Italic() Style { s.attrs |= attrItalic; return s }
+
+// Underline returns the style with underlined text
+func (s Style) Underline() Style { s.attrs |= attrUnderline; return s }
+
+// sequence is the escape sequence that switches to the style
+func (s Style) sequence() string {
+	var params []string
+	for _, a := range []struct {
+		bit  uint8
+		code string
+	}{{attrBold, "1"}, {attrDim, "2"}, {attrItalic, "3"}, {attrUnderline, "4"}} {
+		if s.attrs&a.bit != 0 {
+			params = append(params, a.code)
+		}
+	}
+	if s.fg != "" {
+		params = append(params, s.fg)
+	}
+	if s.bg != "" {
+		params = append(params, s.bg)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// apply wraps text in the style, restarting it on every line so that
+// line-based redraws keep their colors
+func (s Style) apply(text string) string {
+	seq := s.sequence()
+	if colorsDisabled || seq == "" || text == "" {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = seq + line + "\x1b[0m"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Sprint formats like fmt.Sprint and applies the style
+func (s Style) Sprint(a ...any) string { return s.apply(fmt.Sprint(a...)) }
+
+// Sprintf formats like fmt.Sprintf and applies the style
+func (s Style) Sprintf(format string, a ...any) string {
+	return s.apply(fmt.Sprintf(format, a...))
+}
+
+// Print writes styled text
+func (s Style) Print(a ...any) { pterm.Print(s.Sprint(a...)) }
+
+// Printf writes styled formatted text
+func (s Style) Printf(format string, a ...any) { pterm.Print(s.Sprintf(format, a...)) }
+
+// Println writes styled text followed by a newline
+func (s Style) Println(a ...any) {
+	pterm.Println(s.apply(strings.TrimSuffix(fmt.Sprintln(a...), "\n")))
+}
+
+// namedColors maps color names to their foreground SGR codes. Names also
+// work in the pterm spelling (FgLightCyan) that earlier versions saved.
+var namedColors = map[string]int{
+	"black": 30, "red": 31, "green": 32, "yellow": 33, "blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+	"gray": 90, "grey": 90,
+	"light-red": 91, "light-green": 92, "light-yellow": 93, "light-blue": 94,
+	"light-magenta": 95, "light-cyan": 96, "light-white": 97,
+}
+
+// colorNames lists the named colors in the order the settings menu offers them
+var colorNames = []string{
+	"light-cyan", "cyan", "light-blue", "blue", "light-green", "green", "light-yellow", "yellow",
+	"light-red", "red", "light-magenta", "magenta", "light-white", "white", "gray", "black",
+}
+
+// parseColor turns a color name, a 256-color index (0-255) or a hex color
+// (#rgb or #rrggbb) into SGR parameters for the foreground, or the
+// background when bg is set
+func parseColor(spec string, bg bool) (string, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	name := strings.TrimPrefix(spec, "fg")
+	if strings.HasPrefix(name, "light") && !strings.HasPrefix(name, "light-") {
+		name = "light-" + strings.TrimPrefix(name, "light")
+	}
+	if code, ok := namedColors[name]; ok {
+		if bg {
+			code += 10
+		}
+		return strconv.Itoa(code), nil
+	}
+
+	base := "38"
+	if bg {
+		base = "48"
+	}
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 0 || n > 255 {
+			return "", fmt.Errorf("color %d is outside 0-255", n)
+		}
+		return fmt.Sprintf("%s;5;%d", base, n), nil
+	}
+	if strings.HasPrefix(spec, "#") {
+		hex := spec[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != 6 || err != nil {
+			return "", fmt.Errorf("invalid hex color %q", spec)
+		}
+		r, g, b := int(v>>16), int(v>>8&0xff), int(v&0xff)
+		if trueColor {
+			return fmt.Sprintf("%s;2;%d;%d;%d", base, r, g, b), nil
+		}
+		return fmt.Sprintf("%s;5;%d", base, rgbTo256(r, g, b)), nil
+	}
+	return "", fmt.Errorf("unknown color %q", spec)
+}
+
+// rgbTo256 returns the closest color of the 256-color palette's color cube
+// or gray ramp
+func rgbTo256(r, g, b int) int {
+	level := func(v int) int {
+		if v < 48 {
+			return 0
+		}
+		if v < 115 {
+			return 1
+		}
+		return (v - 35) / 40
+	}
+	steps := []int{0, 95, 135, 175, 215, 255}
+	ri, gi, bi := level(r), level(g), level(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := sq(steps[ri]-r) + sq(steps[gi]-g) + sq(steps[bi]-b)
+
+	avg := (r + g + b) / 3
+	grayIndex := min(max((avg-8)/10, 0), 23)
+	grayLevel := 8 + 10*grayIndex
+	grayDist := sq(grayLevel-r) + sq(grayLevel-g) + sq(grayLevel-b)
+	if grayDist < cubeDist {
+		return 232 + grayIndex
+	}
+	return cube
+}
+
+func sq(v int) int { return v * v }
+
+// parseStyle parses a style: space-separated colors and attributes, with
+// "on <color>" for the background, e.g. "bold #ff8800 on 236"
+func parseStyle(spec string) (Style, error) {
+	var s Style
+	fields := strings.Fields(spec)
+	for i := 0; i < len(fields); i++ {
+		switch f := strings.ToLower(fields[i]); f {
+		case "bold":
+			s.attrs |= attrBold
+		case "dim":
+			s.attrs |= attrDim
+		case "italic":
+			s.attrs |= attrItalic
+		case "underline":
+			s.attrs |= attrUnderline
+		case "default", "none":
+		case "on":
+			if i+1 == len(fields) {
+				return Style{}, fmt.Errorf("missing background color in %q", spec)
+			}
+			i++
+			bg, err := parseColor(fields[i], true)
+			if err != nil {
+				return Style{}, err
+			}
+			s.bg = bg
+		default:
+			fg, err := parseColor(f, false)
+			if err != nil {
+				return Style{}, err
+			}
+			s.fg = fg
+		}
+	}
+	return s, nil
+}
+
+// uiTheme holds the style of every UI element
+type uiTheme struct {
+	name string
+
+	// Conversation
+	assistant, user, system, tool, errorText Style
+
+	// Menus and notices
+	text, title, success, warning, muted, accent Style
+
+	header, banner, toolBorder, spinner Style
+
+	diffAdded, diffRemoved, diffHunk Style
+
+	markdownHeading, markdownCode, markdownBorder Style
+
+	codeText, codeKeyword, codeString, codeNumber, codeComment Style
+}
+
+// elements maps the keys of theme files to the theme's styles
+func (t *uiTheme) elements() map[string]*Style {
+	return map[string]*Style{
+		"assistant":        &t.assistant,
+		"user":             &t.user,
+		"system":           &t.system,
+		"tool":             &t.tool,
+		"error":            &t.errorText,
+		"text":             &t.text,
+		"title":            &t.title,
+		"success":          &t.success,
+		"warning":          &t.warning,
+		"muted":            &t.muted,
+		"accent":           &t.accent,
+		"header":           &t.header,
+		"banner":           &t.banner,
+		"tool_border":      &t.toolBorder,
+		"spinner":          &t.spinner,
+		"diff_added":       &t.diffAdded,
+		"diff_removed":     &t.diffRemoved,
+		"diff_hunk":        &t.diffHunk,
+		"markdown_heading": &t.markdownHeading,
+		"markdown_code":    &t.markdownCode,
+		"markdown_border":  &t.markdownBorder,
+		"code_text":        &t.codeText,
+		"code_keyword":     &t.codeKeyword,
+		"code_string":      &t.codeString,
+		"code_number":      &t.codeNumber,
+		"code_comment":     &t.codeComment,
+	}
+}
+
+// themeFile is a theme as written in JSON. Styles it leaves out come from
+// the theme it extends, dark by default.
+type themeFile struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Extends     string            `json:"extends,omitempty"`
+	Styles      map[string]string `json:"styles"`
+
+	user bool // Loaded from the themes directory rather than built in
+}
+
+// builtinThemes ship with the agent. dark matches the original colors.
+var builtinThemes = map[string]themeFile{
+	"dark": {
+		Name:        "dark",
+		Description: "Bright colors for dark terminals (default)",
+		Styles: map[string]string{
+			"assistant": "light-cyan", "user": "light-white", "system": "light-blue",
+			"tool": "light-green", "error": "light-red",
+			"text": "light-white", "title": "light-cyan", "success": "light-green",
+			"warning": "light-yellow", "muted": "gray", "accent": "bold light-yellow",
+			"header": "light-white on black", "banner": "light-cyan",
+			"tool_border": "light-green", "spinner": "light-cyan",
+			"diff_added": "light-green", "diff_removed": "light-red", "diff_hunk": "cyan",
+			"markdown_heading": "bold", "markdown_code": "light-yellow", "markdown_border": "gray",
+			"code_text": "white", "code_keyword": "light-magenta", "code_string": "light-green",
+			"code_number": "light-yellow", "code_comment": "gray",
+		},
+	},
+	"light": {
+		Name:        "light",
+		Description: "Darker colors that stay readable on light backgrounds",
+		Styles: map[string]string{
+			"assistant": "#005f87", "user": "#1c1c1c", "system": "#5f5f87",
+			"tool": "#005f00", "error": "#af0000",
+			"text": "#1c1c1c", "title": "bold #005f87", "success": "#005f00",
+			"warning": "#875f00", "muted": "#767676", "accent": "bold #af5f00",
+			"header": "#ffffff on #005f87", "banner": "#005f87",
+			"tool_border": "#5f8700", "spinner": "#005f87",
+			"diff_added": "#005f00", "diff_removed": "#af0000", "diff_hunk": "#5f5faf",
+			"markdown_heading": "bold", "markdown_code": "#875f00", "markdown_border": "#9e9e9e",
+			"code_text": "#1c1c1c", "code_keyword": "#8700af", "code_string": "#005f00",
+			"code_number": "#af5f00", "code_comment": "#808080",
+		},
+	},
+	"high-contrast": {
+		Name:        "high-contrast",
+		Description: "Bold, saturated colors and no gray text",
+		Styles: map[string]string{
+			"assistant": "bold light-white", "user": "bold light-yellow", "system": "bold light-cyan",
+			"tool": "bold light-green", "error": "bold light-white on red",
+			"text": "light-white", "title": "bold underline light-white", "success": "bold light-green",
+			"warning": "bold black on light-yellow", "muted": "light-white", "accent": "bold underline light-yellow",
+			"header": "bold black on light-white", "banner": "bold light-white",
+			"tool_border": "bold light-green", "spinner": "bold light-yellow",
+			"diff_added": "bold light-green", "diff_removed": "bold light-red", "diff_hunk": "bold light-cyan",
+			"markdown_heading": "bold underline", "markdown_code": "bold light-yellow", "markdown_border": "light-white",
+			"code_text": "light-white", "code_keyword": "bold light-cyan", "code_string": "bold light-green",
+			"code_number": "bold light-yellow", "code_comment": "italic light-white",
+		},
+	},
+}
+
+// ui is the active theme. Everything drawn in the terminal takes its styles
+// from here, so one theme applies to the whole session.
+var ui = mustBuiltinTheme(defaultThemeName)
+
+// mustBuiltinTheme resolves a built-in theme, which is known to be valid
+func mustBuiltinTheme(name string) *uiTheme {
+	t, err := resolveTheme(builtinThemes[name], nil, 0)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// getThemesDir returns the directory holding user themes
+func getThemesDir() string {
+	return filepath.Join(filepath.Dir(getConfigPath()), "themes")
+}
+
+// loadUserThemes reads the themes in ~/.open-coder/themes/*.json, keyed by
+// their name, which defaults to the file name. Files that cannot be read are
+// reported in errs and skipped.
+func loadUserThemes() (themes map[string]themeFile, errs []error) {
+	themes = make(map[string]themeFile)
+	paths, _ := filepath.Glob(filepath.Join(getThemesDir(), "*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var tf themeFile
+		if err := json.Unmarshal(data, &tf); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(path), err))
+			continue
+		}
+		if tf.Name == "" {
+			tf.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		tf.user = true
+		themes[tf.Name] = tf
+	}
+	return themes, errs
+}
+
+// themeNames lists the built-in themes followed by the user themes
+func themeNames() []string {
+	names := []string{"dark", "light", "high-contrast"}
+	user, _ := loadUserThemes()
+	var extra []string
+	for name := range user {
+		if _, builtin := builtinThemes[name]; !builtin {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	return append(names, extra...)
+}
+
+// findTheme looks a theme up by name; user themes replace built-in ones of
+// the same name
+func findTheme(name string, user map[string]themeFile) (themeFile, bool) {
+	if tf, ok := user[name]; ok {
+		return tf, true
+	}
+	tf, ok := builtinThemes[name]
+	return tf, ok
+}
+
+// resolveTheme builds a theme, filling in what it leaves out from the theme
+// it extends. Every theme but the built-in dark one extends another, dark
+// when it names none.
+func resolveTheme(tf themeFile, user map[string]themeFile, depth int) (*uiTheme, error) {
+	var t *uiTheme
+	if tf.Extends != "" || tf.Name != defaultThemeName || tf.user {
+		parentName := tf.Extends
+		if parentName == "" {
+			parentName = defaultThemeName
+		}
+		if depth > 8 {
+			return nil, fmt.Errorf("theme %s extends itself", tf.Name)
+		}
+		parent, ok := findTheme(parentName, user)
+		if !ok {
+			return nil, fmt.Errorf("theme %s extends unknown theme %s", tf.Name, parentName)
+		}
+		if parentName == tf.Name {
+			// A user theme named like a built-in one extends the built-in one
+			parent = builtinThemes[parentName]
+		}
+		base, err := resolveTheme(parent, user, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		copied := *base
+		t = &copied
+	} else {
+		t = &uiTheme{}
+	}
+	t.name = tf.Name
+
+	elements := t.elements()
+	for key, spec := range tf.Styles {
+		target, ok := elements[key]
+		if !ok {
+			return nil, fmt.Errorf("theme %s: unknown element %q", tf.Name, key)
+		}
+		style, err := parseStyle(spec)
+		if err != nil {
+			return nil, fmt.Errorf("theme %s, %s: %w", tf.Name, key, err)
+		}
+		*target = style
+	}
+	return t, nil
+}
+
+// loadTheme resolves a built-in or user theme by name
+func loadTheme(name string) (*uiTheme, error) {
+	user, _ := loadUserThemes()
+	tf, ok := findTheme(name, user)
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q", name)
+	}
+	return resolveTheme(tf, user, 0)
+}
+
+// applyTheme makes the named theme the active one, keeping the current one
+// when it cannot be loaded
+func (a *SimpleAgent) applyTheme(name string) error {
+	if name == "" {
+		name = defaultThemeName
+	}
+	t, err := loadTheme(name)
+	if err != nil {
+		return err
+	}
+	ui = t
+	a.theme = name
+	return nil
+}
+
+// roleStyle returns the style of a conversation role: the color chosen in
+// the settings menu, or the theme's
+func roleStyle(override string, themed Style) Style {
+	if override == "" {
+		return themed
+	}
+	fg, err := parseColor(override, false)
+	if err != nil {
+		return themed
+	}
+	return Style{fg: fg}
+}
+
+// themedSpinner returns a spinner drawn in the theme's spinner style
+func themedSpinner() *pterm.SpinnerPrinter {
+	frames := make([]string, len(pterm.DefaultSpinner.Sequence))
+	for i, frame := range pterm.DefaultSpinner.Sequence {
+		frames[i] = ui.spinner.Sprint(frame)
+	}
+	return pterm.DefaultSpinner.WithSequence(frames...).WithStyle(pterm.NewStyle())
+}
+
+// printHeader prints a full-width header bar
+func printHeader(title string) {
+	width := max(pterm.GetTerminalWidth(), len(title)+4)
+	pad := (width - len([]rune(title))) / 2
+	line := strings.Repeat(" ", pad) + title
+	line += strings.Repeat(" ", max(0, width-len([]rune(line))))
+	pterm.Println()
+	pterm.Println(ui.header.Sprint(line))
+	pterm.Println()
+}
+
+// inherit fills in the colors a style leaves unset from base and adds
+// base's attributes
+func (s Style) inherit(base Style) Style {
+	if s.fg == "" {
+		s.fg = base.fg
+	}
+	if s.bg == "" {
+		s.bg = base.bg
+	}
+	s.attrs |= base.attrs
+	return s
+}
+
+// themedBox returns a box whose border is drawn in the theme's tool border style
+func themedBox() *pterm.BoxPrinter {
+	b := ui.toolBorder.Sprint
+	return pterm.DefaultBox.
+		WithBoxStyle(pterm.NewStyle()).
+		WithVerticalString(b(pterm.DefaultBox.VerticalString)).
+		WithHorizontalString(b(pterm.DefaultBox.HorizontalString)).
+		WithTopLeftCornerString(b(pterm.DefaultBox.TopLeftCornerString)).
+		WithTopRightCornerString(b(pterm.DefaultBox.TopRightCornerString)).
+		WithBottomLeftCornerString(b(pterm.DefaultBox.BottomLeftCornerString)).
+		WithBottomRightCornerString(b(pterm.DefaultBox.BottomRightCornerString))
+}
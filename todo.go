@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pterm/pterm"
+
+	"open-coder/engine"
+)
+
+// Todo statuses
+const (
+	todoPending    = "pending"
+	todoInProgress = "in_progress"
+	todoCompleted  = "completed"
+)
+
+// todoItem is one entry of the model's todo list; it is shared with front
+// ends through TodosChanged events
+type todoItem = engine.TodoItem
+
+// todoList is the session's todo list. The model replaces it as a whole with
+// todo_write, which keeps the tool simple and the list consistent.
+type todoList struct {
+	mu      sync.Mutex
+	items   []todoItem
+	changed bool // updated since the panel was last shown
+}
+
+// set replaces the list
+func (l *todoList) set(items []todoItem) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = items
+	l.changed = true
+}
+
+// snapshot returns a copy of the items
+func (l *todoList) snapshot() []todoItem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]todoItem(nil), l.items...)
+}
+
+// unfinished reports whether any item is not completed
+func (l *todoList) unfinished() bool {
+	for _, item := range l.snapshot() {
+		if item.Status != todoCompleted {
+			return true
+		}
+	}
+	return false
+}
+
+// takeChanged reports whether the list changed since the last call
+func (l *todoList) takeChanged() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed := l.changed
+	l.changed = false
+	return changed
+}
+
+// formatTodos renders items as a plain checklist for the model
+func formatTodos(items []todoItem) string {
+	if len(items) == 0 {
+		return "The todo list is empty"
+	}
+	var b strings.Builder
+	done := 0
+	for i, item := range items {
+		mark := "[ ]"
+		switch item.Status {
+		case todoCompleted:
+			mark = "[x]"
+			done++
+		case todoInProgress:
+			mark = "[~]"
+		}
+		fmt.Fprintf(&b, "%s %d. %s\n", mark, i+1, item.Content)
+	}
+	fmt.Fprintf(&b, "(%d of %d completed)", done, len(items))
+	return b.String()
+}
+
+// todoReminder is added to a rebuilt conversation so the model picks up an
+// unfinished list where it left off
+func (a *SimpleAgent) todoReminder() string {
+	if a.todos == nil || !a.todos.unfinished() {
+		return ""
+	}
+	return "Your todo list so far; continue from the first unfinished item and keep it updated with todo_write:\n" +
+		formatTodos(a.todos.snapshot())
+}
+
+// showTodoPanel prints the todo list as a checklist panel
+func showTodoPanel(items []todoItem) {
+	lines := make([]string, len(items))
+	done := 0
+	for i, item := range items {
+		switch item.Status {
+		case todoCompleted:
+			lines[i] = ui.success.Sprint("✓ " + item.Content)
+			done++
+		case todoInProgress:
+			lines[i] = ui.title.Sprint("▶ " + item.Content)
+		default:
+			lines[i] = ui.muted.Sprint("○ " + item.Content)
+		}
+	}
+	pterm.Println()
+	themedBox().
+		WithTitle(fmt.Sprintf("Todos (%d/%d)", done, len(items))).
+		WithTitleTopLeft().
+		Println(strings.Join(lines, "\n"))
+}
+
+// todoWriteTool replaces the todo list
+type todoWriteTool struct{}
+
+func (t *todoWriteTool) Name() string { return "todo_write" }
+
+func (t *todoWriteTool) Description() string {
+	return "Create or update your todo list for multi-step work. Send the complete list every time; it replaces the previous one. " +
+		"Mark an item in_progress when you start it (one at a time) and completed as soon as it is done. The list is shown to the user"
+}
+
+func (t *todoWriteTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"todos": map[string]any{
+				"type":        "array",
+				"description": "The complete todo list",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"content": map[string]any{
+							"type":        "string",
+							"description": "What needs to be done",
+						},
+						"status": map[string]any{
+							"type": "string",
+							"enum": []any{todoPending, todoInProgress, todoCompleted},
+						},
+					},
+					"required": []any{"content", "status"},
+				},
+			},
+		},
+		"required": []any{"todos"},
+	}
+}
+
+func (t *todoWriteTool) ReadOnly() bool { return true }
+
+func (t *todoWriteTool) Call(a *SimpleAgent, args map[string]any) (string, error) {
+	if a.todos == nil {
+		return "", fmt.Errorf("todo list is not available here")
+	}
+
+	list, _ := args["todos"].([]any)
+	items := make([]todoItem, 0, len(list))
+	inProgress := 0
+	for _, entry := range list {
+		obj, _ := entry.(map[string]any)
+		content, _ := obj["content"].(string)
+		status, _ := obj["status"].(string)
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		if status == todoInProgress {
+			inProgress++
+		}
+		items = append(items, todoItem{Content: strings.TrimSpace(content), Status: status})
+	}
+	a.todos.set(items)
+	a.saveSession()
+
+	result := "Todo list updated:\n" + formatTodos(items)
+	if inProgress > 1 {
+		result += "\nNote: several items are in_progress; finish one before starting the next."
+	}
+	return result, nil
+}
+
+// todoReadTool returns the todo list
+type todoReadTool struct{}
+
+func (t *todoReadTool) Name() string { return "todo_read" }
+
+func (t *todoReadTool) Description() string {
+	return "Read your current todo list"
+}
+
+func (t *todoReadTool) Parameters() map[string]any {
+	return map[string]any{"type": "object", "properties": map[string]any{}}
+}
+
+func (t *todoReadTool) ReadOnly() bool { return true }
+
+func (t *todoReadTool) Call(a *SimpleAgent, _ map[string]any) (string, error) {
+	if a.todos == nil {
+		return "", fmt.Errorf("todo list is not available here")
+	}
+	return formatTodos(a.todos.snapshot()), nil
+}
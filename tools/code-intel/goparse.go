@@ -0,0 +1,718 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"open-coder/internal/fsutil"
+)
+
+// maxImportingPackages bounds how many packages find_references type-checks
+// when looking for uses of an exported symbol outside its own package
+const maxImportingPackages = 200
+
+// isGoFile reports whether the Go-native fallback can handle path
+func isGoFile(path string) bool {
+	return strings.HasSuffix(path, ".go")
+}
+
+// goListSymbols returns the outline of a Go file using go/parser
+func goListSymbols(path string) ([]symbol, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+	if file == nil {
+		return nil, err
+	}
+
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	var symbols []symbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			s := symbol{name: d.Name.Name, kind: "function", line: line(d.Name.Pos())}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				s.kind = "method"
+				s.name = fmt.Sprintf("(%s).%s", nodeString(fset, d.Recv.List[0].Type), d.Name.Name)
+			}
+			s.detail = shorten(nodeString(fset, d.Type), 120)
+			symbols = append(symbols, s)
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					symbols = append(symbols, typeSymbol(fset, sp))
+				case *ast.ValueSpec:
+					kind := "variable"
+					if d.Tok == token.CONST {
+						kind = "constant"
+					}
+					for _, name := range sp.Names {
+						if name.Name == "_" {
+							continue
+						}
+						s := symbol{name: name.Name, kind: kind, line: line(name.Pos())}
+						if sp.Type != nil {
+							s.detail = shorten(nodeString(fset, sp.Type), 80)
+						}
+						symbols = append(symbols, s)
+					}
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// typeSymbol describes a type declaration, listing struct fields and
+// interface methods as children
+func typeSymbol(fset *token.FileSet, spec *ast.TypeSpec) symbol {
+	s := symbol{name: spec.Name.Name, kind: "type", line: fset.Position(spec.Name.Pos()).Line}
+
+	var fields *ast.FieldList
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		s.kind = "struct"
+		fields = t.Fields
+	case *ast.InterfaceType:
+		s.kind = "interface"
+		fields = t.Methods
+	default:
+		s.detail = shorten(nodeString(fset, spec.Type), 80)
+	}
+	if fields == nil {
+		return s
+	}
+
+	for _, field := range fields.List {
+		kind := "field"
+		if _, ok := field.Type.(*ast.FuncType); ok {
+			kind = "method"
+		}
+		detail := shorten(nodeString(fset, field.Type), 80)
+		if len(field.Names) == 0 {
+			// Embedded field or interface
+			s.children = append(s.children, symbol{
+				name: detail, kind: "embedded", line: fset.Position(field.Pos()).Line,
+			})
+			continue
+		}
+		for _, name := range field.Names {
+			s.children = append(s.children, symbol{
+				name: name.Name, kind: kind, detail: detail, line: fset.Position(name.Pos()).Line,
+			})
+		}
+	}
+	return s
+}
+
+// nodeString prints an AST node as Go source
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// shorten collapses a snippet to one line of at most max characters
+func shorten(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "…"
+}
+
+// goFindDefinition resolves the identifier at pos with go/types
+func goFindDefinition(pos sourcePosition) ([]location, error) {
+	goState.Lock()
+	defer goState.Unlock()
+
+	_, obj, err := goObjectAt(pos)
+	if err != nil {
+		return nil, err
+	}
+	if !obj.Pos().IsValid() {
+		return nil, fmt.Errorf("%s is predeclared by the language and has no source definition", obj.Name())
+	}
+	return []location{goLocation(obj.Pos(), "")}, nil
+}
+
+// goFindReferences finds uses of the identifier at pos in its package and,
+// for exported symbols, in every package of the module that imports it
+func goFindReferences(ctx context.Context, pos sourcePosition) ([]location, error) {
+	goState.Lock()
+	defer goState.Unlock()
+
+	pkg, obj, err := goObjectAt(pos)
+	if err != nil {
+		return nil, err
+	}
+	if !obj.Pos().IsValid() {
+		return nil, fmt.Errorf("%s is predeclared by the language; search for it with search_content instead", obj.Name())
+	}
+	target := goState.fset.Position(obj.Pos())
+
+	// Collect the packages to search
+	pkgs := []*goPackage{pkg}
+	if obj.Exported() && obj.Pkg() != nil && pkg.module != nil {
+		importing, err := goImportingPackages(ctx, pkg.module, obj.Pkg().Path())
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range importing {
+			if p.dir != pkg.dir || p.name != pkg.name {
+				pkgs = append(pkgs, p)
+			}
+		}
+	}
+
+	seen := make(map[token.Position]bool)
+	var locs []location
+	for _, p := range pkgs {
+		for _, idents := range []map[*ast.Ident]types.Object{p.info.Defs, p.info.Uses} {
+			for id, o := range idents {
+				if o == nil || goState.fset.Position(o.Pos()) != target {
+					continue
+				}
+				position := goState.fset.Position(id.Pos())
+				if seen[position] {
+					continue
+				}
+				seen[position] = true
+				note := ""
+				if strings.HasSuffix(position.Filename, "_test.go") {
+					note = "in test file"
+				}
+				locs = append(locs, goLocation(id.Pos(), note))
+			}
+		}
+	}
+
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i].path != locs[j].path {
+			return locs[i].path < locs[j].path
+		}
+		if locs[i].line != locs[j].line {
+			return locs[i].line < locs[j].line
+		}
+		return locs[i].column < locs[j].column
+	})
+	return locs, nil
+}
+
+// goHover describes the identifier at pos with its type and doc comment
+func goHover(pos sourcePosition) (string, error) {
+	goState.Lock()
+	defer goState.Unlock()
+
+	pkg, obj, err := goObjectAt(pos)
+	if err != nil {
+		return "", err
+	}
+
+	qualifier := func(p *types.Package) string {
+		if p == pkg.types {
+			return ""
+		}
+		return p.Name()
+	}
+	var signature string
+	if pn, ok := obj.(*types.PkgName); ok {
+		signature = fmt.Sprintf("package %s (%q)", pn.Imported().Name(), pn.Imported().Path())
+	} else {
+		signature = types.ObjectString(obj, qualifier)
+	}
+
+	var b strings.Builder
+	b.WriteString("```go\n")
+	b.WriteString(shortenLines(signature, 40))
+	b.WriteString("\n```\n")
+	if obj.Pos().IsValid() {
+		if doc := goDocComment(goState.fset.Position(obj.Pos())); doc != "" {
+			b.WriteString("\n" + doc)
+		}
+		b.WriteString(fmt.Sprintf("\nDefined at %s:%d\n", displayPath(goState.fset.Position(obj.Pos()).Filename), goState.fset.Position(obj.Pos()).Line))
+	}
+	return b.String(), nil
+}
+
+// shortenLines keeps at most max lines of s
+func shortenLines(s string, max int) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) <= max {
+		return s
+	}
+	return strings.Join(lines[:max], "\n") + fmt.Sprintf("\n// ... %d more lines", len(lines)-max)
+}
+
+// goDiagnostics reports parse and type errors in a Go file
+func goDiagnostics(path string) []diagnostic {
+	goState.Lock()
+	defer goState.Unlock()
+
+	pkg, _, err := goLoadFile(path)
+	if err != nil {
+		return []diagnostic{{path: path, line: 1, column: 1, severity: "error", message: err.Error()}}
+	}
+
+	lines := newLineCache()
+	var diags []diagnostic
+	for _, e := range pkg.errors {
+		var position token.Position
+		var message string
+		switch e := e.(type) {
+		case types.Error:
+			position, message = e.Fset.Position(e.Pos), e.Msg
+		case *scanner.Error:
+			position, message = e.Pos, e.Msg
+		default:
+			continue
+		}
+		if position.Filename != path {
+			continue
+		}
+		diags = append(diags, diagnostic{
+			path:     path,
+			line:     position.Line,
+			column:   byteToRuneColumn(lines.get(path, position.Line), position.Column),
+			severity: "error",
+			message:  message,
+		})
+	}
+	return diags
+}
+
+// goState caches type-checked packages for the lifetime of the server. All
+// packages share one FileSet so positions can be compared across packages.
+var goState = struct {
+	sync.Mutex
+	fset     *token.FileSet
+	std      types.ImporterFrom // packages outside the module: stdlib and dependencies
+	packages map[string]*goPackage
+	loading  map[string]bool
+	modules  map[string]*goModule // directory -> enclosing module, nil if none
+}{
+	fset:     token.NewFileSet(),
+	packages: make(map[string]*goPackage),
+	loading:  make(map[string]bool),
+	modules:  make(map[string]*goModule),
+}
+
+// goModule is a module found via its go.mod file
+type goModule struct {
+	root string
+	path string
+}
+
+// goPackage is one type-checked package in a directory
+type goPackage struct {
+	dir       string
+	name      string
+	tests     bool   // _test.go files are included
+	signature string // file names, sizes and mtimes, used for invalidation
+	module    *goModule
+	files     []*ast.File
+	info      *types.Info
+	types     *types.Package
+	errors    []error
+}
+
+// goLoadFile type-checks the package that contains path, including its tests
+func goLoadFile(path string) (*goPackage, *ast.File, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+	if f == nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %v", displayPath(path), err)
+	}
+
+	pkg, err := goLoadPackage(filepath.Dir(path), f.Name.Name, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range pkg.files {
+		if goState.fset.Position(file.Pos()).Filename == path {
+			return pkg, file, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%s is excluded by build constraints", displayPath(path))
+}
+
+// goObjectAt returns the object the identifier at pos refers to
+func goObjectAt(pos sourcePosition) (*goPackage, types.Object, error) {
+	pkg, file, err := goLoadFile(pos.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenFile := goState.fset.File(file.Pos())
+	if pos.line > tokenFile.LineCount() {
+		return nil, nil, fmt.Errorf("line %d is past the end of %s", pos.line, displayPath(pos.path))
+	}
+	text := newLineCache().get(pos.path, pos.line)
+	offset := len(string(firstRunes(text, pos.column-1)))
+	p := tokenFile.LineStart(pos.line) + token.Pos(offset)
+
+	var ident *ast.Ident
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil || ident != nil || p < n.Pos() || p > n.End() {
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok && p < id.End() {
+			ident = id
+		}
+		return true
+	})
+	if ident == nil {
+		return nil, nil, fmt.Errorf("no identifier at %s:%d:%d", displayPath(pos.path), pos.line, pos.column)
+	}
+
+	obj := pkg.info.Defs[ident]
+	if obj == nil {
+		obj = pkg.info.Uses[ident]
+	}
+	if obj == nil {
+		obj = pkg.info.Implicits[ident]
+	}
+	if obj == nil {
+		return nil, nil, fmt.Errorf("could not resolve %q (the package may not type-check; see diagnostics)", ident.Name)
+	}
+	return pkg, obj, nil
+}
+
+// firstRunes returns the first n runes of s
+func firstRunes(s string, n int) []rune {
+	r := []rune(s)
+	if n < 0 {
+		n = 0
+	}
+	if n > len(r) {
+		n = len(r)
+	}
+	return r[:n]
+}
+
+// goLocation converts a position to a location with a character column
+func goLocation(p token.Pos, note string) location {
+	position := goState.fset.Position(p)
+	line := newLineCache().get(position.Filename, position.Line)
+	return location{
+		path:   position.Filename,
+		line:   position.Line,
+		column: byteToRuneColumn(line, position.Column),
+		note:   note,
+	}
+}
+
+// byteToRuneColumn converts a 1-based byte column to a character column
+func byteToRuneColumn(line string, column int) int {
+	if column-1 > len(line) || column < 1 {
+		return column
+	}
+	return len([]rune(line[:column-1])) + 1
+}
+
+// goLoadPackage type-checks the files of package name in dir, reusing the
+// cached result while no file in the directory has changed. An empty name
+// selects the directory's non-test package.
+func goLoadPackage(dir, name string, tests bool) (*goPackage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig strings.Builder
+	var filenames []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		if !tests && strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, e.Name()); err != nil || !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&sig, "%s:%d:%d;", e.Name(), info.Size(), info.ModTime().UnixNano())
+		filenames = append(filenames, filepath.Join(dir, e.Name()))
+	}
+
+	key := fmt.Sprintf("%s|%s|%t", dir, name, tests)
+	if pkg, ok := goState.packages[key]; ok && pkg.signature == sig.String() {
+		return pkg, nil
+	}
+	if goState.loading[key] {
+		return nil, fmt.Errorf("import cycle through %s", dir)
+	}
+	goState.loading[key] = true
+	defer delete(goState.loading, key)
+
+	pkg := &goPackage{dir: dir, name: name, tests: tests, signature: sig.String(), module: goFindModule(dir)}
+
+	for _, filename := range filenames {
+		file, err := parser.ParseFile(goState.fset, filename, nil, parser.ParseComments|parser.AllErrors)
+		if file == nil {
+			continue
+		}
+		if pkg.name == "" && !strings.HasSuffix(filename, "_test.go") {
+			pkg.name = file.Name.Name
+		}
+		if file.Name.Name != pkg.name {
+			continue
+		}
+		var list scanner.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				pkg.errors = append(pkg.errors, e)
+			}
+		}
+		pkg.files = append(pkg.files, file)
+	}
+	if len(pkg.files) == 0 {
+		return nil, fmt.Errorf("no Go files for package %s in %s", name, displayPath(dir))
+	}
+
+	pkg.info = &types.Info{
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	conf := types.Config{
+		Importer:    &goImporter{},
+		FakeImportC: true,
+		Error:       func(err error) { pkg.errors = append(pkg.errors, err) },
+	}
+	pkg.types, _ = conf.Check(goImportPath(dir, pkg.module), goState.fset, pkg.files, pkg.info)
+
+	// Cache under the requested name and the resolved one
+	goState.packages[key] = pkg
+	goState.packages[fmt.Sprintf("%s|%s|%t", dir, pkg.name, tests)] = pkg
+	return pkg, nil
+}
+
+// goImporter resolves packages of the current module through the mtime-checked
+// cache and everything else from source through go/build
+type goImporter struct{}
+
+func (i *goImporter) Import(path string) (*types.Package, error) {
+	return i.ImportFrom(path, "", 0)
+}
+
+func (i *goImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if mod := goFindModule(srcDir); mod != nil && (path == mod.path || strings.HasPrefix(path, mod.path+"/")) {
+		dir := filepath.Join(mod.root, filepath.FromSlash(strings.TrimPrefix(path, mod.path)))
+		pkg, err := goLoadPackage(dir, "", false)
+		if err != nil {
+			return nil, err
+		}
+		if pkg.types == nil {
+			return nil, fmt.Errorf("failed to type-check %s", path)
+		}
+		return pkg.types, nil
+	}
+
+	if goState.std == nil {
+		goState.std = importer.ForCompiler(goState.fset, "source", nil).(types.ImporterFrom)
+	}
+	return goState.std.ImportFrom(path, srcDir, mode)
+}
+
+// goFindModule returns the module enclosing dir, or nil
+func goFindModule(dir string) *goModule {
+	if dir == "" {
+		return nil
+	}
+	if mod, ok := goState.modules[dir]; ok {
+		return mod
+	}
+
+	var mod *goModule
+	if f, err := os.Open(filepath.Join(dir, "go.mod")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if rest, ok := strings.CutPrefix(line, "module"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+				mod = &goModule{root: dir, path: strings.Trim(strings.TrimSpace(rest), `"`)}
+				break
+			}
+		}
+		f.Close()
+	} else if parent := filepath.Dir(dir); parent != dir {
+		mod = goFindModule(parent)
+	}
+
+	goState.modules[dir] = mod
+	return mod
+}
+
+// goImportPath returns the import path of the package in dir
+func goImportPath(dir string, mod *goModule) string {
+	if mod == nil {
+		return dir
+	}
+	rel, err := filepath.Rel(mod.root, dir)
+	if err != nil || rel == "." {
+		return mod.path
+	}
+	return mod.path + "/" + filepath.ToSlash(rel)
+}
+
+// goImportingPackages type-checks every package in the module whose files
+// mention importPath, including the external test package next to it
+func goImportingPackages(ctx context.Context, mod *goModule, importPath string) ([]*goPackage, error) {
+	quoted := []byte(`"` + importPath + `"`)
+	ownDir := filepath.Join(mod.root, filepath.FromSlash(strings.TrimPrefix(importPath, mod.path)))
+
+	// Directories with a file that imports the package, mapped to package names
+	dirs := make(map[string]map[string]bool)
+	var order []string
+	err := fsutil.Walk(mod.root, fsutil.WalkOptions{}, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path != mod.root && (d.Name() == "testdata" || d.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil && path != mod.root {
+				return filepath.SkipDir // nested module
+			}
+			return nil
+		}
+		if !isGoFile(path) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil || !bytes.Contains(content, quoted) {
+			return nil
+		}
+		f, _ := parser.ParseFile(token.NewFileSet(), path, content, parser.PackageClauseOnly)
+		if f == nil {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]bool)
+			order = append(order, dir)
+		}
+		dirs[dir][f.Name.Name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []*goPackage
+	if own, err := goLoadPackage(ownDir, "", true); err == nil {
+		pkgs = append(pkgs, own)
+	}
+	for _, dir := range order {
+		if len(pkgs) >= maxImportingPackages {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		for name := range dirs[dir] {
+			if pkg, err := goLoadPackage(dir, name, true); err == nil {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// goDocComment returns the doc comment of the declaration at position
+func goDocComment(position token.Position) string {
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, position.Filename, nil, parser.ParseComments)
+	if file == nil {
+		return ""
+	}
+
+	matches := func(id *ast.Ident) bool {
+		p := fset.Position(id.Pos())
+		return p.Line == position.Line && p.Column == position.Column
+	}
+
+	var doc *ast.CommentGroup
+	var genDecl *ast.GenDecl
+	ast.Inspect(file, func(n ast.Node) bool {
+		if doc != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.GenDecl:
+			genDecl = n
+		case *ast.FuncDecl:
+			if matches(n.Name) {
+				doc = n.Doc
+			}
+		case *ast.TypeSpec:
+			if matches(n.Name) {
+				doc = firstDoc(n.Doc, genDecl)
+			}
+		case *ast.ValueSpec:
+			for _, name := range n.Names {
+				if matches(name) {
+					doc = firstDoc(n.Doc, genDecl)
+					if doc == nil {
+						doc = n.Comment
+					}
+				}
+			}
+		case *ast.Field:
+			for _, name := range n.Names {
+				if matches(name) {
+					doc = n.Doc
+					if doc == nil {
+						doc = n.Comment
+					}
+				}
+			}
+		}
+		return true
+	})
+	if doc == nil {
+		return ""
+	}
+	return doc.Text()
+}
+
+// firstDoc prefers a spec's own doc and falls back to its declaration's doc
+// when the declaration has a single spec
+func firstDoc(doc *ast.CommentGroup, decl *ast.GenDecl) *ast.CommentGroup {
+	if doc != nil {
+		return doc
+	}
+	if decl != nil && len(decl.Specs) == 1 {
+		return decl.Doc
+	}
+	return nil
+}
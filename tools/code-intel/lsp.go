@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// requestTimeout bounds a single language server request
+const requestTimeout = 30 * time.Second
+
+// diagnosticsWait is how long to wait for pushed diagnostics after opening a file
+const diagnosticsWait = 5 * time.Second
+
+// languageServer describes how to start a language server for some file types
+type languageServer struct {
+	language   string
+	extensions map[string]string // file extension -> LSP languageId
+	commands   [][]string        // candidate command lines, first installed one wins
+
+	start sync.Mutex // Held while starting, so a slow start only blocks its own language
+}
+
+// languageServers lists the servers that are used when installed
+var languageServers = []languageServer{
+	{
+		language:   "go",
+		extensions: map[string]string{".go": "go"},
+		commands:   [][]string{{"gopls"}},
+	},
+	{
+		language:   "python",
+		extensions: map[string]string{".py": "python", ".pyi": "python"},
+		commands:   [][]string{{"pyright-langserver", "--stdio"}, {"pylsp"}},
+	},
+	{
+		language: "typescript",
+		extensions: map[string]string{
+			".ts": "typescript", ".tsx": "typescriptreact",
+			".js": "javascript", ".jsx": "javascriptreact", ".mjs": "javascript", ".cjs": "javascript",
+		},
+		commands: [][]string{{"typescript-language-server", "--stdio"}},
+	},
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[string]*lspClient)
+)
+
+// languageServerFor returns a running language server for the file, starting
+// one if necessary. It returns an error when none is installed or when
+// OPEN_CODER_DISABLE_LSP is set, so callers can fall back to native parsing.
+func languageServerFor(ctx context.Context, path string) (*lspClient, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	var server *languageServer
+	for i := range languageServers {
+		if _, ok := languageServers[i].extensions[ext]; ok {
+			server = &languageServers[i]
+			break
+		}
+	}
+	if server == nil {
+		return nil, fmt.Errorf("no language server is known for %s files", ext)
+	}
+	if os.Getenv("OPEN_CODER_DISABLE_LSP") != "" {
+		return nil, fmt.Errorf("language servers are disabled by OPEN_CODER_DISABLE_LSP")
+	}
+
+	server.start.Lock()
+	defer server.start.Unlock()
+
+	clientsMu.Lock()
+	client, ok := clients[server.language]
+	clientsMu.Unlock()
+	if ok && client.alive() {
+		return client, nil
+	}
+
+	var tried []string
+	for _, command := range server.commands {
+		tried = append(tried, command[0])
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		client, err := startLanguageServer(ctx, server, command)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start %s: %v", command[0], err)
+		}
+		clientsMu.Lock()
+		clients[server.language] = client
+		clientsMu.Unlock()
+		return client, nil
+	}
+	return nil, fmt.Errorf("no %s language server is installed (tried %s)", server.language, strings.Join(tried, ", "))
+}
+
+// shutdownLanguageServers stops every language server that was started
+func shutdownLanguageServers() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	for name, client := range clients {
+		client.shutdown()
+		delete(clients, name)
+	}
+}
+
+// rpcMessage is a JSON-RPC 2.0 request, response or notification
+type rpcMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  any              `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// openDocument tracks a file the server has been told about
+type openDocument struct {
+	version int
+	modTime time.Time
+}
+
+// lspClient talks to one language server process over stdio
+type lspClient struct {
+	server     *languageServer
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	rootURI    string
+	pullDiags  bool // server supports textDocument/diagnostic
+	writeMu    sync.Mutex
+	nextID     atomic.Int64
+	exited     atomic.Bool
+	pendingMu  sync.Mutex
+	pending    map[int64]chan rpcMessage
+	docsMu     sync.Mutex
+	docs       map[string]*openDocument
+	diagMu     sync.Mutex
+	diags      map[string][]diagnostic
+	diagNotify map[string]chan struct{}
+}
+
+// startLanguageServer launches a server and performs the initialize handshake
+func startLanguageServer(ctx context.Context, server *languageServer, command []string) (*lspClient, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = wd
+	cmd.Stderr = io.Discard
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &lspClient{
+		server:     server,
+		cmd:        cmd,
+		stdin:      stdin,
+		rootURI:    pathToURI(wd),
+		pending:    make(map[int64]chan rpcMessage),
+		docs:       make(map[string]*openDocument),
+		diags:      make(map[string][]diagnostic),
+		diagNotify: make(map[string]chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(stdout))
+	go func() {
+		_ = cmd.Wait()
+		c.exited.Store(true)
+		c.failPending()
+	}()
+
+	var initResult struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+	}
+	err = c.call(ctx, "initialize", map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   c.rootURI,
+		"workspaceFolders": []map[string]string{
+			{"uri": c.rootURI, "name": filepath.Base(wd)},
+		},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"documentSymbol": map[string]any{"hierarchicalDocumentSymbolSupport": true},
+				"hover":          map[string]any{"contentFormat": []string{"markdown", "plaintext"}},
+				"publishDiagnostics": map[string]any{
+					"relatedInformation": false,
+				},
+				"diagnostic": map[string]any{},
+			},
+			"workspace": map[string]any{"workspaceFolders": true},
+		},
+	}, &initResult)
+	if err != nil {
+		c.shutdown()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	_, c.pullDiags = initResult.Capabilities["diagnosticProvider"]
+
+	if err := c.notify("initialized", map[string]any{}); err != nil {
+		c.shutdown()
+		return nil, err
+	}
+	return c, nil
+}
+
+// alive reports whether the server process is still running
+func (c *lspClient) alive() bool {
+	return !c.exited.Load()
+}
+
+// shutdown asks the server to exit and kills it if it does not
+func (c *lspClient) shutdown() {
+	if c.alive() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_ = c.call(ctx, "shutdown", nil, nil)
+		_ = c.notify("exit", nil)
+		cancel()
+	}
+	_ = c.stdin.Close()
+	if c.cmd.Process != nil && c.alive() {
+		time.Sleep(100 * time.Millisecond)
+		if c.alive() {
+			_ = c.cmd.Process.Kill()
+		}
+	}
+}
+
+// call sends a request and decodes its result into out (which may be nil)
+func (c *lspClient) call(ctx context.Context, method string, params any, out any) error {
+	if !c.alive() {
+		return fmt.Errorf("language server has exited")
+	}
+
+	id := c.nextID.Add(1)
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	reply := make(chan rpcMessage, 1)
+
+	c.pendingMu.Lock()
+	c.pending[id] = reply
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.write(rpcMessage{JSONRPC: "2.0", ID: &rawID, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if out != nil && len(msg.Result) > 0 {
+			return json.Unmarshal(msg.Result, out)
+		}
+		return nil
+	case <-ctx.Done():
+		_ = c.notify("$/cancelRequest", map[string]any{"id": id})
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// notify sends a notification
+func (c *lspClient) notify(method string, params any) error {
+	return c.write(rpcMessage{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// write frames and sends a message
+func (c *lspClient) write(msg rpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.stdin.Write(data)
+	return err
+}
+
+// readLoop dispatches responses, server requests and notifications
+func (c *lspClient) readLoop(r *bufio.Reader) {
+	for {
+		length := 0
+		for {
+			header, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			header = strings.TrimSpace(header)
+			if header == "" {
+				break
+			}
+			if name, value, ok := strings.Cut(header, ":"); ok && strings.EqualFold(name, "Content-Length") {
+				length, _ = strconv.Atoi(strings.TrimSpace(value))
+			}
+		}
+		if length <= 0 {
+			continue
+		}
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		var msg rpcMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			continue
+		}
+
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			c.answerServerRequest(msg)
+		case msg.Method == "textDocument/publishDiagnostics":
+			c.storeDiagnostics(body)
+		case msg.ID != nil:
+			id, err := strconv.ParseInt(string(*msg.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			c.pendingMu.Lock()
+			reply, ok := c.pending[id]
+			c.pendingMu.Unlock()
+			if ok {
+				reply <- msg
+			}
+		}
+	}
+}
+
+// answerServerRequest replies to requests the server sends to the client
+func (c *lspClient) answerServerRequest(msg rpcMessage) {
+	var result any
+	if msg.Method == "workspace/configuration" {
+		// One null configuration per requested item
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if raw, err := json.Marshal(msg.Params); err == nil {
+			_ = json.Unmarshal(raw, &params)
+		}
+		result = make([]any, len(params.Items))
+	}
+	resultJSON, _ := json.Marshal(result)
+	_ = c.write(rpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: resultJSON})
+}
+
+// failPending unblocks callers waiting on a server that exited
+func (c *lspClient) failPending() {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	for id, reply := range c.pending {
+		reply <- rpcMessage{Error: &rpcError{Message: "language server exited"}}
+		delete(c.pending, id)
+	}
+}
+
+// lspPosition is a zero-based line and UTF-16 character offset
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lspRange is a span between two positions
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspLocation is a range in a document
+type lspLocation struct {
+	URI       string   `json:"uri"`
+	Range     lspRange `json:"range"`
+	TargetURI string   `json:"targetUri"`
+	// LocationLink fields, used by servers that return links instead of locations
+	TargetSelectionRange *lspRange `json:"targetSelectionRange"`
+}
+
+// syncDocument opens the file on the server or sends its new contents if it
+// changed since it was last sent
+func (c *lspClient) syncDocument(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	uri := pathToURI(path)
+
+	c.docsMu.Lock()
+	defer c.docsMu.Unlock()
+
+	doc, ok := c.docs[path]
+	if ok && doc.modTime.Equal(info.ModTime()) {
+		return uri, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.clearDiagnostics(uri)
+	if !ok {
+		c.docs[path] = &openDocument{version: 1, modTime: info.ModTime()}
+		languageID := c.server.extensions[strings.ToLower(filepath.Ext(path))]
+		return uri, c.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{
+				"uri":        uri,
+				"languageId": languageID,
+				"version":    1,
+				"text":       string(content),
+			},
+		})
+	}
+
+	doc.version++
+	doc.modTime = info.ModTime()
+	return uri, c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": doc.version},
+		"contentChanges": []map[string]any{{"text": string(content)}},
+	})
+}
+
+// positionParams builds TextDocumentPositionParams for a source position
+func (c *lspClient) positionParams(pos sourcePosition) (map[string]any, error) {
+	uri, err := c.syncDocument(pos.path)
+	if err != nil {
+		return nil, err
+	}
+	line := newLineCache().get(pos.path, pos.line)
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     lspPosition{Line: pos.line - 1, Character: runeColumnToUTF16(line, pos.column)},
+	}, nil
+}
+
+// documentSymbols returns the outline of a file
+func (c *lspClient) documentSymbols(ctx context.Context, path string) ([]symbol, error) {
+	uri, err := c.syncDocument(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := c.call(ctx, "textDocument/documentSymbol", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	}, &raw); err != nil {
+		return nil, err
+	}
+	return decodeSymbols(raw), nil
+}
+
+// lspSymbol covers both DocumentSymbol and SymbolInformation results
+type lspSymbol struct {
+	Name           string            `json:"name"`
+	Detail         string            `json:"detail"`
+	Kind           int               `json:"kind"`
+	Range          *lspRange         `json:"range"`
+	SelectionRange *lspRange         `json:"selectionRange"`
+	Location       *lspLocation      `json:"location"`
+	ContainerName  string            `json:"containerName"`
+	Children       []json.RawMessage `json:"children"`
+}
+
+// decodeSymbols converts a documentSymbol response into symbols
+func decodeSymbols(raw []json.RawMessage) []symbol {
+	var out []symbol
+	for _, r := range raw {
+		var s lspSymbol
+		if err := json.Unmarshal(r, &s); err != nil {
+			continue
+		}
+		sym := symbol{name: s.Name, kind: symbolKindName(s.Kind), detail: s.Detail}
+		switch {
+		case s.SelectionRange != nil:
+			sym.line = s.SelectionRange.Start.Line + 1
+		case s.Range != nil:
+			sym.line = s.Range.Start.Line + 1
+		case s.Location != nil:
+			sym.line = s.Location.Range.Start.Line + 1
+			if s.ContainerName != "" {
+				sym.detail = "in " + s.ContainerName
+			}
+		}
+		sym.children = decodeSymbols(s.Children)
+		out = append(out, sym)
+	}
+	return out
+}
+
+// definition returns where the symbol at pos is defined
+func (c *lspClient) definition(ctx context.Context, pos sourcePosition) ([]location, error) {
+	params, err := c.positionParams(pos)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := c.call(ctx, "textDocument/definition", params, &raw); err != nil {
+		return nil, err
+	}
+	return decodeLocations(raw), nil
+}
+
+// references returns every reference to the symbol at pos
+func (c *lspClient) references(ctx context.Context, pos sourcePosition) ([]location, error) {
+	params, err := c.positionParams(pos)
+	if err != nil {
+		return nil, err
+	}
+	params["context"] = map[string]any{"includeDeclaration": true}
+
+	var raw json.RawMessage
+	if err := c.call(ctx, "textDocument/references", params, &raw); err != nil {
+		return nil, err
+	}
+	return decodeLocations(raw), nil
+}
+
+// hover returns the documentation shown for the symbol at pos
+func (c *lspClient) hover(ctx context.Context, pos sourcePosition) (string, error) {
+	params, err := c.positionParams(pos)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := c.call(ctx, "textDocument/hover", params, &result); err != nil {
+		return "", err
+	}
+	return hoverText(result.Contents), nil
+}
+
+// diagnostics returns the problems the server reports for a file
+func (c *lspClient) diagnostics(ctx context.Context, path string) ([]diagnostic, error) {
+	c.diagMu.Lock()
+	uri := pathToURI(path)
+	notify, ok := c.diagNotify[uri]
+	if !ok {
+		notify = make(chan struct{})
+		c.diagNotify[uri] = notify
+	}
+	c.diagMu.Unlock()
+
+	if _, err := c.syncDocument(path); err != nil {
+		return nil, err
+	}
+
+	if c.pullDiags {
+		var report struct {
+			Items []lspDiagnostic `json:"items"`
+		}
+		err := c.call(ctx, "textDocument/diagnostic", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+		}, &report)
+		if err == nil {
+			return convertDiagnostics(path, report.Items), nil
+		}
+	}
+
+	// Otherwise wait for the server to push diagnostics for the file
+	c.diagMu.Lock()
+	stored, have := c.diags[uri]
+	if have {
+		c.diagMu.Unlock()
+		return stored, nil
+	}
+	notify = c.diagNotify[uri]
+	c.diagMu.Unlock()
+
+	select {
+	case <-notify:
+	case <-time.After(diagnosticsWait):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.diagMu.Lock()
+	defer c.diagMu.Unlock()
+	return c.diags[uri], nil
+}
+
+// lspDiagnostic is a diagnostic as sent by the server
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Message  string   `json:"message"`
+	Source   string   `json:"source"`
+}
+
+// storeDiagnostics records a publishDiagnostics notification
+func (c *lspClient) storeDiagnostics(body []byte) {
+	var msg struct {
+		Params struct {
+			URI         string          `json:"uri"`
+			Diagnostics []lspDiagnostic `json:"diagnostics"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return
+	}
+
+	uri := msg.Params.URI
+	c.diagMu.Lock()
+	defer c.diagMu.Unlock()
+	c.diags[uri] = convertDiagnostics(uriToPath(uri), msg.Params.Diagnostics)
+	if ch, ok := c.diagNotify[uri]; ok {
+		close(ch)
+		delete(c.diagNotify, uri)
+	}
+}
+
+// clearDiagnostics forgets stored diagnostics for a document about to change
+func (c *lspClient) clearDiagnostics(uri string) {
+	c.diagMu.Lock()
+	defer c.diagMu.Unlock()
+	delete(c.diags, uri)
+	if _, ok := c.diagNotify[uri]; !ok {
+		c.diagNotify[uri] = make(chan struct{})
+	}
+}
+
+// convertDiagnostics turns server diagnostics into reportable ones
+func convertDiagnostics(path string, in []lspDiagnostic) []diagnostic {
+	lines := newLineCache()
+	out := make([]diagnostic, 0, len(in))
+	for _, d := range in {
+		severity := "error"
+		switch d.Severity {
+		case 2:
+			severity = "warning"
+		case 3:
+			severity = "info"
+		case 4:
+			severity = "hint"
+		}
+		message := d.Message
+		if d.Source != "" {
+			message = fmt.Sprintf("%s [%s]", message, d.Source)
+		}
+		line := d.Range.Start.Line + 1
+		out = append(out, diagnostic{
+			path:     path,
+			line:     line,
+			column:   utf16ToRuneColumn(lines.get(path, line), d.Range.Start.Character),
+			severity: severity,
+			message:  message,
+		})
+	}
+	return out
+}
+
+// decodeLocations converts Location, Location[] or LocationLink[] results
+func decodeLocations(raw json.RawMessage) []location {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var list []lspLocation
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var single lspLocation
+		if err := json.Unmarshal(raw, &single); err != nil {
+			return nil
+		}
+		list = []lspLocation{single}
+	}
+
+	lines := newLineCache()
+	var out []location
+	for _, l := range list {
+		uri, rng := l.URI, l.Range
+		if l.TargetURI != "" {
+			uri = l.TargetURI
+			if l.TargetSelectionRange != nil {
+				rng = *l.TargetSelectionRange
+			}
+		}
+		path := uriToPath(uri)
+		line := rng.Start.Line + 1
+		out = append(out, location{
+			path:   path,
+			line:   line,
+			column: utf16ToRuneColumn(lines.get(path, line), rng.Start.Character),
+		})
+	}
+	return out
+}
+
+// hoverText flattens MarkupContent, MarkedString or MarkedString[] hover contents
+func hoverText(raw json.RawMessage) string {
+	var markup struct {
+		Kind     string `json:"kind"`
+		Value    string `json:"value"`
+		Language string `json:"language"`
+	}
+	if err := json.Unmarshal(raw, &markup); err == nil && markup.Value != "" {
+		if markup.Language != "" {
+			return fmt.Sprintf("```%s\n%s\n```", markup.Language, markup.Value)
+		}
+		return markup.Value
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err == nil {
+		var out []string
+		for _, p := range parts {
+			if s := hoverText(p); s != "" {
+				out = append(out, s)
+			}
+		}
+		return strings.Join(out, "\n\n")
+	}
+	return ""
+}
+
+// symbolKindName maps LSP SymbolKind values to names
+func symbolKindName(kind int) string {
+	names := []string{"", "file", "module", "namespace", "package", "class", "method", "property",
+		"field", "constructor", "enum", "interface", "function", "variable", "constant", "string",
+		"number", "boolean", "array", "object", "key", "null", "enum member", "struct", "event",
+		"operator", "type param"}
+	if kind > 0 && kind < len(names) {
+		return names[kind]
+	}
+	return "symbol"
+}
+
+// pathToURI converts an absolute path to a file:// URI
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// uriToPath converts a file:// URI to a path
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// runeColumnToUTF16 converts a 1-based character column to a UTF-16 offset
+func runeColumnToUTF16(line string, column int) int {
+	offset := 0
+	for i, r := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		offset += len(utf16.Encode([]rune{r}))
+	}
+	return offset
+}
+
+// utf16ToRuneColumn converts a UTF-16 offset to a 1-based character column
+func utf16ToRuneColumn(line string, offset int) int {
+	column := 1
+	units := 0
+	for len(line) > 0 && units < offset {
+		r, size := utf8.DecodeRuneInString(line)
+		units += len(utf16.Encode([]rune{r}))
+		line = line[size:]
+		column++
+	}
+	return column
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func main() {
+	// Create a new MCP server
+	s := server.NewMCPServer(
+		"Code Intelligence CLI 🚀",
+		"1.0.0",
+		server.WithToolCapabilities(false),
+	)
+
+	// Add code navigation tools
+	s.AddTool(createListSymbolsTool(), listSymbolsHandler)
+	s.AddTool(createFindDefinitionTool(), findDefinitionHandler)
+	s.AddTool(createFindReferencesTool(), findReferencesHandler)
+	s.AddTool(createHoverTool(), hoverHandler)
+	s.AddTool(createDiagnosticsTool(), diagnosticsHandler)
+
+	// Start the stdio server
+	if err := server.ServeStdio(s); err != nil {
+		fmt.Printf("Server error: %v\n", err)
+	}
+
+	// Stop any language servers that were started
+	shutdownLanguageServers()
+}
+
+// positionOptions are the parameters shared by the position-based tools
+func positionOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the source file (relative to current directory)"),
+		),
+		mcp.WithNumber("line",
+			mcp.Description("Line number of the symbol (1-based)"),
+		),
+		mcp.WithNumber("column",
+			mcp.Description("Column of the symbol on that line (1-based, in characters)"),
+		),
+		mcp.WithString("symbol",
+			mcp.Description("Symbol name to look up when line/column are not known; its first occurrence in the file (or on the given line) is used"),
+		),
+	}
+}
+
+func createListSymbolsTool() mcp.Tool {
+	return mcp.NewTool("list_symbols",
+		mcp.WithDescription("List the symbols (functions, types, methods, constants, variables) declared in a file, with line numbers. Use this instead of reading a whole file to get an outline"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the source file (relative to current directory)"),
+		),
+	)
+}
+
+func createFindDefinitionTool() mcp.Tool {
+	opts := append([]mcp.ToolOption{
+		mcp.WithDescription("Find where the symbol at a position (or with a given name) is defined"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	}, positionOptions()...)
+	return mcp.NewTool("find_definition", opts...)
+}
+
+func createFindReferencesTool() mcp.Tool {
+	opts := append([]mcp.ToolOption{
+		mcp.WithDescription("Find all references to the symbol at a position (or with a given name) across the workspace"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	}, positionOptions()...)
+	opts = append(opts, mcp.WithNumber("limit",
+		mcp.Description("Maximum number of references to return (default: 100)"),
+	))
+	return mcp.NewTool("find_references", opts...)
+}
+
+func createHoverTool() mcp.Tool {
+	opts := append([]mcp.ToolOption{
+		mcp.WithDescription("Show the type signature and documentation of the symbol at a position (or with a given name)"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	}, positionOptions()...)
+	return mcp.NewTool("hover", opts...)
+}
+
+func createDiagnosticsTool() mcp.Tool {
+	return mcp.NewTool("diagnostics",
+		mcp.WithDescription("Report compile errors and warnings for a file"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the source file (relative to current directory)"),
+		),
+	)
+}
+
+// sourcePosition is a 1-based line and character column in a file
+type sourcePosition struct {
+	path   string // absolute path
+	line   int
+	column int
+}
+
+// location is a result position reported back to the model
+type location struct {
+	path   string
+	line   int
+	column int
+	note   string // optional qualifier, e.g. "in test file"
+}
+
+// symbol is an entry in a file outline
+type symbol struct {
+	name     string
+	kind     string // function, method, struct, interface, constant, ...
+	detail   string // signature or other short description
+	line     int
+	children []symbol
+}
+
+// diagnostic is a compile error or warning in a file
+type diagnostic struct {
+	path     string
+	line     int
+	column   int
+	severity string // error, warning, info or hint
+	message  string
+}
+
+// parsePosition resolves the path/line/column/symbol parameters to a position
+func parsePosition(request mcp.CallToolRequest) (sourcePosition, error) {
+	path := mcp.ParseString(request, "path", "")
+	if path == "" {
+		return sourcePosition{}, fmt.Errorf("path parameter is required")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return sourcePosition{}, fmt.Errorf("invalid path: %v", err)
+	}
+
+	pos := sourcePosition{
+		path:   absPath,
+		line:   mcp.ParseInt(request, "line", 0),
+		column: mcp.ParseInt(request, "column", 0),
+	}
+
+	symbol := mcp.ParseString(request, "symbol", "")
+	if pos.line > 0 && pos.column > 0 {
+		return pos, nil
+	}
+	if symbol == "" {
+		return sourcePosition{}, fmt.Errorf("provide line and column, or a symbol name")
+	}
+
+	line, column, err := findSymbolInFile(absPath, symbol, pos.line)
+	if err != nil {
+		return sourcePosition{}, err
+	}
+	pos.line, pos.column = line, column
+	return pos, nil
+}
+
+// findSymbolInFile locates the first whole-word occurrence of symbol outside
+// comment lines, limited to one line when onLine is set. Qualified names like
+// Type.Method use the last component.
+func findSymbolInFile(path, symbol string, onLine int) (int, int, error) {
+	if i := strings.LastIndex(symbol, "."); i >= 0 {
+		symbol = symbol[i+1:]
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	re := regexp.MustCompile(`\b` + regexp.QuoteMeta(symbol) + `\b`)
+	for i, line := range strings.Split(string(content), "\n") {
+		if onLine > 0 && i+1 != onLine {
+			continue
+		}
+		if onLine == 0 && isCommentLine(line) {
+			continue
+		}
+		if loc := re.FindStringIndex(line); loc != nil {
+			return i + 1, len([]rune(line[:loc[0]])) + 1, nil
+		}
+	}
+
+	if onLine > 0 {
+		return 0, 0, fmt.Errorf("symbol %q not found on line %d of %s", symbol, onLine, path)
+	}
+	return 0, 0, fmt.Errorf("symbol %q not found in %s", symbol, path)
+}
+
+// isCommentLine reports whether a line is a comment in most languages
+func isCommentLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "//") || strings.HasPrefix(line, "#") ||
+		strings.HasPrefix(line, "/*") || strings.HasPrefix(line, "*")
+}
+
+// formatLocations renders locations as path:line:column lines with the source text
+func formatLocations(title string, locs []location, limit int) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s (%d):\n", title, len(locs)))
+	b.WriteString("----------------------------------------\n")
+
+	lines := newLineCache()
+	for i, loc := range locs {
+		if limit > 0 && i >= limit {
+			b.WriteString(fmt.Sprintf("... %d more not shown\n", len(locs)-limit))
+			break
+		}
+		b.WriteString(fmt.Sprintf("%s:%d:%d", displayPath(loc.path), loc.line, loc.column))
+		if text := strings.TrimSpace(lines.get(loc.path, loc.line)); text != "" {
+			b.WriteString("  " + text)
+		}
+		if loc.note != "" {
+			b.WriteString("  (" + loc.note + ")")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// displayPath shows paths relative to the working directory when possible
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// lineCache reads source lines for result formatting
+type lineCache struct {
+	files map[string][]string
+}
+
+func newLineCache() *lineCache {
+	return &lineCache{files: make(map[string][]string)}
+}
+
+// get returns the 1-based line of a file, or "" if unavailable
+func (c *lineCache) get(path string, line int) string {
+	lines, ok := c.files[path]
+	if !ok {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			lines = strings.Split(string(content), "\n")
+		}
+		c.files[path] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return lines[line-1]
+}
+
+func listSymbolsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path := mcp.ParseString(request, "path", "")
+	if path == "" {
+		return mcp.NewToolResultError("path parameter is required"), nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+
+	var symbols []symbol
+	if client, err := languageServerFor(ctx, absPath); err == nil {
+		symbols, err = client.documentSymbols(ctx, absPath)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Language server error: %v", err)), nil
+		}
+	} else if isGoFile(absPath) {
+		symbols, err = goListSymbols(absPath)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to parse file: %v", err)), nil
+		}
+	} else {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if len(symbols) == 0 {
+		return mcp.NewToolResultText("No symbols found in " + path), nil
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Symbols in %s:\n", path))
+	result.WriteString("----------------------------------------\n")
+	writeSymbols(&result, symbols, 0)
+
+	return mcp.NewToolResultText(result.String()), nil
+}
+
+// writeSymbols writes a symbol outline with children indented below parents
+func writeSymbols(b *strings.Builder, symbols []symbol, depth int) {
+	for _, s := range symbols {
+		b.WriteString(fmt.Sprintf("%s%4d: %-10s %s", strings.Repeat("  ", depth), s.line, s.kind, s.name))
+		if s.detail != "" {
+			b.WriteString("  " + s.detail)
+		}
+		b.WriteString("\n")
+		writeSymbols(b, s.children, depth+1)
+	}
+}
+
+func findDefinitionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	pos, err := parsePosition(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var locs []location
+	if client, err := languageServerFor(ctx, pos.path); err == nil {
+		locs, err = client.definition(ctx, pos)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Language server error: %v", err)), nil
+		}
+	} else if isGoFile(pos.path) {
+		locs, err = goFindDefinition(pos)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if len(locs) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("No definition found at %s:%d:%d", displayPath(pos.path), pos.line, pos.column)), nil
+	}
+	return mcp.NewToolResultText(formatLocations("Definitions", locs, 0)), nil
+}
+
+func findReferencesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	pos, err := parsePosition(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	limit := mcp.ParseInt(request, "limit", 100)
+
+	var locs []location
+	if client, err := languageServerFor(ctx, pos.path); err == nil {
+		locs, err = client.references(ctx, pos)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Language server error: %v", err)), nil
+		}
+	} else if isGoFile(pos.path) {
+		locs, err = goFindReferences(ctx, pos)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if len(locs) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("No references found at %s:%d:%d", displayPath(pos.path), pos.line, pos.column)), nil
+	}
+	return mcp.NewToolResultText(formatLocations("References", locs, limit)), nil
+}
+
+func hoverHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	pos, err := parsePosition(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var text string
+	if client, err := languageServerFor(ctx, pos.path); err == nil {
+		text, err = client.hover(ctx, pos)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Language server error: %v", err)), nil
+		}
+	} else if isGoFile(pos.path) {
+		text, err = goHover(pos)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return mcp.NewToolResultText(fmt.Sprintf("No information available at %s:%d:%d", displayPath(pos.path), pos.line, pos.column)), nil
+	}
+	return mcp.NewToolResultText(text), nil
+}
+
+func diagnosticsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path := mcp.ParseString(request, "path", "")
+	if path == "" {
+		return mcp.NewToolResultError("path parameter is required"), nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+
+	var diags []diagnostic
+	if client, err := languageServerFor(ctx, absPath); err == nil {
+		diags, err = client.diagnostics(ctx, absPath)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Language server error: %v", err)), nil
+		}
+	} else if isGoFile(absPath) {
+		diags = goDiagnostics(absPath)
+	} else {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if len(diags) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("✅ No problems found in %s", path)), nil
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Diagnostics for %s (%d):\n", path, len(diags)))
+	result.WriteString("----------------------------------------\n")
+	for _, d := range diags {
+		result.WriteString(fmt.Sprintf("%s:%d:%d: %s: %s\n", displayPath(d.path), d.line, d.column, d.severity, d.message))
+	}
+	return mcp.NewToolResultText(result.String()), nil
+}
@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+
+	"open-coder/internal/fsutil"
+	"open-coder/internal/glob"
+	"open-coder/internal/lines"
+	"open-coder/internal/repomap"
 )
 
 func main() {
@@ -29,6 +37,8 @@ func main() {
 	s.AddTool(createSearchFilesTool(), searchFilesHandler)
 	s.AddTool(createSearchContentTool(), searchContentHandler)
 	s.AddTool(createDeleteFileTool(), deleteFileHandler)
+	s.AddTool(createRepoMapTool(), repoMapHandler)
+	s.AddTool(createReadImageTool(), readImageHandler)
 
 	// Start the stdio server
 	if err := server.ServeStdio(s); err != nil {
@@ -39,6 +49,7 @@ func main() {
 func createReadFileTool() mcp.Tool {
 	return mcp.NewTool("read_file",
 		mcp.WithDescription("Read the contents of a file with optional line numbers"),
+		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithString("path",
 			mcp.Required(),
 			mcp.Description("Path to the file to read (relative to current directory)"),
@@ -71,7 +82,8 @@ func createWriteFileTool() mcp.Tool {
 
 func createListDirectoryTool() mcp.Tool {
 	return mcp.NewTool("list_directory",
-		mcp.WithDescription("List contents of a directory"),
+		mcp.WithDescription("List contents of a directory. Recursive listings skip paths excluded by .gitignore/.ignore, .git and node_modules; prefer repo_map for an overview of a project"),
+		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithString("path",
 			mcp.Description("Path to the directory to list (relative to current directory, defaults to current directory)"),
 		),
@@ -81,25 +93,64 @@ func createListDirectoryTool() mcp.Tool {
 	)
 }
 
+func createRepoMapTool() mcp.Tool {
+	return mcp.NewTool("repo_map",
+		mcp.WithDescription("Get an overview of a repository: its file tree with sizes and languages plus the most referenced top-level symbols of each file, ranked and trimmed to a token budget. Use this before exploring an unfamiliar project"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithString("path",
+			mcp.Description("Root directory of the repository (relative to current directory, defaults to current directory)"),
+		),
+		mcp.WithNumber("max_tokens",
+			mcp.Description("Approximate size of the map in tokens (default: 2000)"),
+		),
+	)
+}
+
+func createReadImageTool() mcp.Tool {
+	return mcp.NewTool("read_image",
+		mcp.WithDescription("Read an image file (PNG, JPEG, GIF or WebP, up to 10 MB) so you can look at it, e.g. a screenshot or diagram"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the image (relative to current directory)"),
+		),
+	)
+}
+
 func createSearchFilesTool() mcp.Tool {
 	return mcp.NewTool("search_files",
-		mcp.WithDescription("Search for files by name pattern"),
+		mcp.WithDescription("Search for files by glob pattern. Skips paths excluded by .gitignore/.ignore, .git and node_modules"),
+		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithString("pattern",
 			mcp.Required(),
-			mcp.Description("Glob pattern to match file names (e.g., '*.txt', '**/test_*.go')"),
+			mcp.Description("Glob pattern matched against paths relative to the base directory. Supports ** and {a,b} (e.g., '*.txt', '**/test_*.go', 'src/**/*.{ts,tsx}'). Patterns without '/' match file names at any depth"),
 		),
 		mcp.WithString("path",
 			mcp.Description("Base directory to search in (relative to current directory, defaults to current directory)"),
 		),
+		mcp.WithArray("exclude",
+			mcp.Description("Glob patterns of paths to leave out of the results (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithBoolean("include_ignored",
+			mcp.Description("Also search paths excluded by ignore files (default: false)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of results to return (default: 200)"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of results to skip, for paging through large result sets (default: 0)"),
+		),
 	)
 }
 
 func createSearchContentTool() mcp.Tool {
 	return mcp.NewTool("search_content",
-		mcp.WithDescription("Search for text content within files"),
+		mcp.WithDescription("Search file contents with a regular expression. Skips binary files and paths excluded by .gitignore/.ignore, .git and node_modules"),
+		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithString("pattern",
 			mcp.Required(),
-			mcp.Description("Text pattern to search for (supports regex)"),
+			mcp.Description("Regular expression to search for (Go RE2 syntax)"),
 		),
 		mcp.WithString("path",
 			mcp.Description("File or directory to search in (relative to current directory)"),
@@ -110,6 +161,35 @@ func createSearchContentTool() mcp.Tool {
 		mcp.WithNumber("context_lines",
 			mcp.Description("Number of context lines to show before and after matches (default: 2)"),
 		),
+		mcp.WithBoolean("case_insensitive",
+			mcp.Description("Match without regard to case (default: false)"),
+		),
+		mcp.WithBoolean("whole_word",
+			mcp.Description("Only match the pattern at word boundaries (default: false)"),
+		),
+		mcp.WithBoolean("literal",
+			mcp.Description("Treat the pattern as plain text instead of a regular expression (default: false)"),
+		),
+		mcp.WithArray("include",
+			mcp.Description("Glob patterns of files to search, e.g. ['*.go', 'src/**/*.ts'] (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("exclude",
+			mcp.Description("Glob patterns of files to skip (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithBoolean("include_ignored",
+			mcp.Description("Also search paths excluded by ignore files (default: false)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of matches to return (default: 100)"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of matches to skip, for paging through large result sets (default: 0)"),
+		),
+		mcp.WithNumber("max_bytes",
+			mcp.Description("Maximum size of the returned matches in bytes (default: 50000)"),
+		),
 	)
 }
 
@@ -129,6 +209,7 @@ func createDeleteFileTool() mcp.Tool {
 func createReadLineRangeTool() mcp.Tool {
 	return mcp.NewTool("read_line_range",
 		mcp.WithDescription("Read specific lines or a range of lines from a file"),
+		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithString("path",
 			mcp.Required(),
 			mcp.Description("Path to the file to read (relative to current directory)"),
@@ -196,36 +277,11 @@ func readFileHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.Cal
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
 	}
 
-	lines := strings.Split(string(content), "\n")
-
-	// Adjust offset to 0-based indexing
-	offset--
-
-	// Handle offset bounds
-	if offset >= len(lines) {
-		return mcp.NewToolResultText(""), nil
-	}
-
-	end := len(lines)
-	if limit > 0 && offset+limit < len(lines) {
-		end = offset + limit
-	}
-
-	resultLines := lines[offset:end]
-
-	var result string
-	if showLineNumbers {
-		var formattedLines []string
-		for i, line := range resultLines {
-			lineNum := offset + i + 1
-			formattedLines = append(formattedLines, fmt.Sprintf("%4d: %s", lineNum, line))
-		}
-		result = strings.Join(formattedLines, "\n")
-	} else {
-		result = strings.Join(resultLines, "\n")
+	end := 0 // through the last line
+	if limit > 0 {
+		end = offset + limit - 1
 	}
-
-	return mcp.NewToolResultText(result), nil
+	return mcp.NewToolResultText(lines.Format(lines.Range(string(content), offset, end), offset, showLineNumbers)), nil
 }
 
 func writeFileHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -275,7 +331,7 @@ func listDirectoryHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 	result.WriteString("----------------------------------------\n")
 
 	if recursive {
-		err = filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
+		err = fsutil.Walk(absPath, fsutil.WalkOptions{}, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
@@ -292,11 +348,11 @@ func listDirectoryHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 			}
 
 			fileType := "📄"
-			if info.IsDir() {
+			if d.IsDir() {
 				fileType = "📁"
 			}
 
-			result.WriteString(fmt.Sprintf("%s%s %s\n", indent, fileType, info.Name()))
+			result.WriteString(fmt.Sprintf("%s%s %s\n", indent, fileType, d.Name()))
 			return nil
 		})
 	} else {
@@ -336,8 +392,15 @@ func searchFilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	if pattern == "" {
 		return mcp.NewToolResultError("pattern parameter is required"), nil
 	}
+	if err := glob.Validate(pattern); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid pattern: %v", err)), nil
+	}
 
 	basePath := mcp.ParseString(request, "path", ".")
+	excludes := request.GetStringSlice("exclude", nil)
+	includeIgnored := mcp.ParseBoolean(request, "include_ignored", false)
+	limit := mcp.ParseInt(request, "limit", 200)
+	offset := mcp.ParseInt(request, "offset", 0)
 
 	// Resolve base path relative to current working directory
 	absBasePath, err := filepath.Abs(basePath)
@@ -346,22 +409,31 @@ func searchFilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	}
 
 	var matches []string
-	err = filepath.Walk(absBasePath, func(path string, info os.FileInfo, err error) error {
+	err = fsutil.Walk(absBasePath, fsutil.WalkOptions{NoIgnore: includeIgnored}, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if path == absBasePath {
+			return nil
+		}
 
-		// Check if the filename matches the pattern
-		matched, err := filepath.Match(pattern, info.Name())
+		// Get relative path from base directory
+		relPath, err := filepath.Rel(absBasePath, path)
 		if err != nil {
-			return err
+			relPath = path
 		}
+		relPath = filepath.ToSlash(relPath)
 
-		if matched {
-			// Get relative path from base directory
-			relPath, err := filepath.Rel(absBasePath, path)
-			if err != nil {
-				relPath = path
+		if matchesAny(excludes, relPath) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if glob.MatchFile(pattern, relPath) {
+			if d.IsDir() {
+				relPath += "/"
 			}
 			matches = append(matches, relPath)
 		}
@@ -377,13 +449,17 @@ func searchFilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 		return mcp.NewToolResultText("No files found matching pattern: " + pattern), nil
 	}
 
-	result := fmt.Sprintf("Found %d files matching pattern '%s':\n", len(matches), pattern)
-	result += "----------------------------------------\n"
-	for _, match := range matches {
-		result += match + "\n"
+	start, end := pageBounds(len(matches), offset, limit)
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Found %d files matching pattern '%s':\n", len(matches), pattern))
+	result.WriteString("----------------------------------------\n")
+	for _, match := range matches[start:end] {
+		result.WriteString(match + "\n")
 	}
+	result.WriteString(pageFooter("results", start, end, len(matches)))
 
-	return mcp.NewToolResultText(result), nil
+	return mcp.NewToolResultText(result.String()), nil
 }
 
 func searchContentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -401,12 +477,58 @@ func searchContentHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 		contextLines = 0
 	}
 
+	includes := request.GetStringSlice("include", nil)
+	excludes := request.GetStringSlice("exclude", nil)
+	includeIgnored := mcp.ParseBoolean(request, "include_ignored", false)
+	limit := mcp.ParseInt(request, "limit", 100)
+	if limit <= 0 {
+		limit = 100
+	}
+	offset := mcp.ParseInt(request, "offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	maxBytes := mcp.ParseInt(request, "max_bytes", 50000)
+	if maxBytes <= 0 {
+		maxBytes = 50000
+	}
+
+	re, err := compileSearchPattern(pattern,
+		mcp.ParseBoolean(request, "literal", false),
+		mcp.ParseBoolean(request, "case_insensitive", false),
+		mcp.ParseBoolean(request, "whole_word", false),
+	)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid pattern: %v", err)), nil
+	}
+
 	// Resolve path relative to current working directory
 	absPath, err := filepath.Abs(searchPath)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
 	}
 
+	if _, err := os.Stat(absPath); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Cannot access path: %v", err)), nil
+	}
+
+	search := &contentSearch{
+		root:         absPath,
+		recursive:    recursive,
+		re:           re,
+		contextLines: contextLines,
+		includes:     includes,
+		excludes:     excludes,
+		noIgnore:     includeIgnored,
+		offset:       offset,
+		maxMatches:   limit,
+		maxBytes:     maxBytes,
+	}
+	found, err := search.run(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error during content search: %v", err)), nil
+	}
+
 	var result strings.Builder
 	result.WriteString(fmt.Sprintf("Searching for pattern '%s' in %s", pattern, absPath))
 	if recursive {
@@ -415,106 +537,75 @@ func searchContentHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 	result.WriteString(":\n")
 	result.WriteString("----------------------------------------\n")
 
-	found := false
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	if found.total == 0 {
+		result.WriteString(fmt.Sprintf("No matches found for pattern: %s (%d files searched)", pattern, found.filesScanned))
+		return mcp.NewToolResultText(result.String()), nil
+	}
 
-		// Skip directories if not doing recursive search
-		if info.IsDir() && !recursive && path != absPath {
-			return filepath.SkipDir
-		}
+	result.WriteString(found.output.String())
+	result.WriteString(found.summary(offset))
 
-		// Only search in regular files
-		if info.IsDir() {
-			return nil
-		}
+	return mcp.NewToolResultText(result.String()), nil
+}
 
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return nil // Skip files that can't be read
-		}
+// compileSearchPattern builds the regular expression used by search_content
+func compileSearchPattern(pattern string, literal, caseInsensitive, wholeWord bool) (*regexp.Regexp, error) {
+	if literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if wholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if caseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
 
-		lines := strings.Split(string(content), "\n")
-		lineNum := 1
-
-		for i, line := range lines {
-			if strings.Contains(line, pattern) {
-				found = true
-
-				// Get relative path
-				relPath, err := filepath.Rel(absPath, path)
-				if err != nil {
-					relPath = path
-				}
-
-				result.WriteString(fmt.Sprintf("%s:%d\n", relPath, lineNum))
-
-				// Show context lines
-				start := i - contextLines
-				if start < 0 {
-					start = 0
-				}
-				end := i + contextLines + 1
-				if end > len(lines) {
-					end = len(lines)
-				}
-
-				for j := start; j < end; j++ {
-					marker := "  "
-					if j == i {
-						marker = "▶ "
-					}
-					result.WriteString(fmt.Sprintf("%s%d: %s\n", marker, j+1, lines[j]))
-				}
-				result.WriteString("\n")
-			}
-			lineNum++
+// matchesAny reports whether a relative path matches any of the glob patterns
+func matchesAny(patterns []string, relPath string) bool {
+	for _, p := range patterns {
+		if glob.MatchFile(p, relPath) {
+			return true
 		}
-
-		return nil
 	}
+	return false
+}
 
-	if recursive {
-		err = filepath.Walk(absPath, walkFn)
-	} else {
-		// Check if it's a file or directory
-		info, err := os.Stat(absPath)
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Cannot access path: %v", err)), nil
+// pageBounds converts offset/limit into a [start, end) window over total
+// results; a negative total leaves the window unclamped
+func pageBounds(total, offset, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	start, end := offset, offset+limit
+	if total >= 0 {
+		if start > total {
+			start = total
 		}
-
-		if info.IsDir() {
-			entries, err := os.ReadDir(absPath)
-			if err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("Cannot read directory: %v", err)), nil
-			}
-
-			for _, entry := range entries {
-				if !entry.IsDir() {
-					filePath := filepath.Join(absPath, entry.Name())
-					fileInfo, err := entry.Info()
-					if err != nil {
-						continue
-					}
-					walkFn(filePath, fileInfo, nil)
-				}
-			}
-		} else {
-			walkFn(absPath, info, nil)
+		if end > total {
+			end = total
 		}
 	}
+	return start, end
+}
 
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error during content search: %v", err)), nil
+// pageFooter describes which slice of the results was returned and how to get more
+func pageFooter(noun string, start, end, total int) string {
+	if start == 0 && end >= total {
+		return ""
 	}
-
-	if !found {
-		result.WriteString("No matches found for pattern: " + pattern)
+	if start >= end {
+		return fmt.Sprintf("\nOffset %d is past the last of %d %s.\n", start, total, noun)
 	}
-
-	return mcp.NewToolResultText(result.String()), nil
+	footer := fmt.Sprintf("\nShowing %s %d-%d of %d.", noun, start+1, end, total)
+	if end < total {
+		footer += fmt.Sprintf(" Use offset=%d to see more.", end)
+	}
+	return footer + "\n"
 }
 
 func deleteFileHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -545,7 +636,7 @@ func deleteFileHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 
 	if recursive && info.IsDir() {
 		// Delete directory recursively
-		err = filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
+		err = fsutil.Walk(absPath, fsutil.WalkOptions{}, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
@@ -616,36 +707,7 @@ func readLineRangeHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
 	}
 
-	lines := strings.Split(string(content), "\n")
-
-	// Adjust to 0-based indexing
-	startIdx := startLine - 1
-	endIdx := endLine
-
-	// Handle bounds
-	if startIdx >= len(lines) {
-		return mcp.NewToolResultText(""), nil
-	}
-
-	if endIdx > len(lines) {
-		endIdx = len(lines)
-	}
-
-	resultLines := lines[startIdx:endIdx]
-
-	var result string
-	if showLineNumbers {
-		var formattedLines []string
-		for i, line := range resultLines {
-			lineNum := startIdx + i + 1
-			formattedLines = append(formattedLines, fmt.Sprintf("%4d: %s", lineNum, line))
-		}
-		result = strings.Join(formattedLines, "\n")
-	} else {
-		result = strings.Join(resultLines, "\n")
-	}
-
-	return mcp.NewToolResultText(result), nil
+	return mcp.NewToolResultText(lines.Format(lines.Range(string(content), startLine, endLine), startLine, showLineNumbers)), nil
 }
 
 func editLineRangeHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -669,7 +731,7 @@ func editLineRangeHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 		return mcp.NewToolResultError("content parameter is required"), nil
 	}
 
-	operation := mcp.ParseString(request, "operation", "replace")
+	operation := mcp.ParseString(request, "operation", lines.Replace)
 
 	// Resolve path relative to current working directory
 	absPath, err := filepath.Abs(path)
@@ -683,59 +745,61 @@ func editLineRangeHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
 	}
 
-	lines := strings.Split(string(currentContent), "\n")
-	newContentLines := strings.Split(content, "\n")
-
-	// Adjust to 0-based indexing
-	startIdx := startLine - 1
-	endIdx := endLine
-
-	// Handle bounds
-	if startIdx > len(lines) {
-		return mcp.NewToolResultError(fmt.Sprintf("start_line %d exceeds file length (%d lines)", startLine, len(lines))), nil
+	result, err := lines.Edit(string(currentContent), startLine, endLine, content, operation)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	if endIdx > len(lines) {
-		endIdx = len(lines)
+	// Ensure directory exists
+	dir := filepath.Dir(absPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to create directory: %v", err)), nil
 	}
 
-	var resultLines []string
+	err = os.WriteFile(absPath, []byte(result), 0644)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to write file: %v", err)), nil
+	}
 
-	switch operation {
-	case "replace":
-		// Replace the specified range with new content
-		resultLines = append(resultLines, lines[:startIdx]...)
-		resultLines = append(resultLines, newContentLines...)
-		resultLines = append(resultLines, lines[endIdx:]...)
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully edited lines %d-%d in %s using operation '%s'", startLine, endLine, path, operation)), nil
+}
 
-	case "insert_before":
-		// Insert new content before the specified line
-		resultLines = append(resultLines, lines[:startIdx]...)
-		resultLines = append(resultLines, newContentLines...)
-		resultLines = append(resultLines, lines[startIdx:]...)
+func repoMapHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path := mcp.ParseString(request, "path", ".")
+	maxTokens := mcp.ParseInt(request, "max_tokens", repomap.DefaultTokenBudget)
 
-	case "insert_after":
-		// Insert new content after the specified line (or range)
-		resultLines = append(resultLines, lines[:endIdx]...)
-		resultLines = append(resultLines, newContentLines...)
-		resultLines = append(resultLines, lines[endIdx:]...)
+	info, err := os.Stat(path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	if !info.IsDir() {
+		return mcp.NewToolResultError(fmt.Sprintf("%s is not a directory", path)), nil
+	}
 
-	default:
-		return mcp.NewToolResultError(fmt.Sprintf("Invalid operation: %s. Must be 'replace', 'insert_before', or 'insert_after'", operation)), nil
+	m, err := repomap.Build(repomap.Options{Root: path})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to build repository map: %v", err)), nil
 	}
 
-	result := strings.Join(resultLines, "\n")
+	return mcp.NewToolResultText(m.Render(maxTokens)), nil
+}
 
-	// Ensure directory exists
-	dir := filepath.Dir(absPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create directory: %v", err)), nil
+func readImageHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path := mcp.ParseString(request, "path", "")
+	if path == "" {
+		return mcp.NewToolResultError("path parameter is required"), nil
 	}
 
-	err = os.WriteFile(absPath, []byte(result), 0644)
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to write file: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully edited lines %d-%d in %s using operation '%s'", startLine, endLine, path, operation)), nil
+	data, mimeType, err := fsutil.ReadImage(absPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read image: %v", err)), nil
+	}
+
+	text := fmt.Sprintf("Image %s (%s, %d bytes)", path, mimeType, len(data))
+	return mcp.NewToolResultImage(text, base64.StdEncoding.EncodeToString(data), mimeType), nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		name                 string
+		total, offset, limit int
+		wantStart, wantEnd   int
+	}{
+		{name: "first page", total: 250, offset: 0, limit: 100, wantStart: 0, wantEnd: 100},
+		{name: "middle page", total: 250, offset: 100, limit: 100, wantStart: 100, wantEnd: 200},
+		{name: "last page", total: 250, offset: 200, limit: 100, wantStart: 200, wantEnd: 250},
+		{name: "everything fits", total: 5, offset: 0, limit: 100, wantStart: 0, wantEnd: 5},
+		{name: "default limit", total: 250, offset: 0, limit: 0, wantStart: 0, wantEnd: 100},
+		{name: "negative limit", total: 250, offset: 10, limit: -5, wantStart: 10, wantEnd: 110},
+		{name: "negative offset", total: 250, offset: -3, limit: 10, wantStart: 0, wantEnd: 10},
+		{name: "offset past the end", total: 5, offset: 9, limit: 10, wantStart: 5, wantEnd: 5},
+		{name: "offset at the end", total: 5, offset: 5, limit: 10, wantStart: 5, wantEnd: 5},
+		{name: "no results", total: 0, offset: 0, limit: 10, wantStart: 0, wantEnd: 0},
+		{name: "unknown total", total: -1, offset: 20, limit: 10, wantStart: 20, wantEnd: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := pageBounds(tt.total, tt.offset, tt.limit)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("pageBounds(%d, %d, %d) = %d, %d, want %d, %d",
+					tt.total, tt.offset, tt.limit, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestPageFooter(t *testing.T) {
+	tests := []struct {
+		name              string
+		start, end, total int
+		want              string
+	}{
+		{name: "everything shown", start: 0, end: 5, total: 5, want: ""},
+		{name: "nothing found", start: 0, end: 0, total: 0, want: ""},
+		{name: "first page", start: 0, end: 100, total: 250, want: "\nShowing results 1-100 of 250. Use offset=100 to see more.\n"},
+		{name: "last page", start: 200, end: 250, total: 250, want: "\nShowing results 201-250 of 250.\n"},
+		{name: "past the end", start: 5, end: 5, total: 5, want: "\nOffset 5 is past the last of 5 results.\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageFooter("results", tt.start, tt.end, tt.total); got != tt.want {
+				t.Errorf("pageFooter(%d, %d, %d) = %q, want %q", tt.start, tt.end, tt.total, got, tt.want)
+			}
+		})
+	}
+}
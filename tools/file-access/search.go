@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"open-coder/internal/fsutil"
+)
+
+// maxLineLength bounds a single line when scanning; longer lines (minified
+// bundles, generated data) end the scan of that file
+const maxLineLength = 1024 * 1024
+
+// maxDisplayLineLength truncates long lines in the output
+const maxDisplayLineLength = 300
+
+// contentSearch describes a parallel search_content run
+type contentSearch struct {
+	root         string // absolute file or directory to search
+	recursive    bool
+	re           *regexp.Regexp
+	contextLines int
+	includes     []string
+	excludes     []string
+	noIgnore     bool
+	offset       int // matches to skip before output starts
+	maxMatches   int // matches to include in the output
+	maxBytes     int // size budget for the formatted matches
+	workers      int
+}
+
+// contentSearchResult is the outcome of a content search
+type contentSearchResult struct {
+	output       strings.Builder
+	shown        int  // matches written to output
+	total        int  // matches found across all scanned files
+	filesScanned int  // text files searched
+	bytesLimited bool // output stopped because maxBytes was reached
+}
+
+// searchJob is a file queued for scanning, numbered in walk order
+type searchJob struct {
+	seq  int
+	path string
+	rel  string
+}
+
+// fileResult holds the formatted matches of one file
+type fileResult struct {
+	seq     int
+	scanned bool
+	blocks  []string // one formatted block per match, nil in count-only mode
+	count   int
+}
+
+// run walks the tree, scans files on a worker pool and merges results in walk
+// order so paging is deterministic. Once the output budget is full, workers
+// switch to counting matches so the summary can report how many were omitted.
+func (s *contentSearch) run(ctx context.Context) (*contentSearchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := s.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan searchJob, workers*4)
+	results := make(chan fileResult, workers*4)
+	var countOnly atomic.Bool
+
+	// Producer: walk the tree in order
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		walkErr <- s.walk(ctx, jobs)
+	}()
+
+	// Workers: scan files line by line
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					results <- fileResult{seq: job.seq}
+					continue
+				}
+				results <- s.scanFile(ctx, job, countOnly.Load())
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Collector: reorder results and apply the output budget
+	result := &contentSearchResult{}
+	budget := s.offset + s.maxMatches
+	pending := make(map[int]fileResult)
+	next := 0
+
+	for res := range results {
+		pending[res.seq] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if r.scanned {
+				result.filesScanned++
+			}
+			for i := 0; i < r.count; i++ {
+				result.total++
+				if result.total <= s.offset || countOnly.Load() {
+					continue
+				}
+				if i >= len(r.blocks) {
+					// Scanned in count-only mode before the budget was known to be full
+					continue
+				}
+				block := r.blocks[i]
+				if result.output.Len()+len(block) > s.maxBytes && result.shown > 0 {
+					result.bytesLimited = true
+					countOnly.Store(true)
+					continue
+				}
+				result.output.WriteString(block)
+				result.shown++
+				if result.total >= budget {
+					countOnly.Store(true)
+				}
+			}
+		}
+	}
+
+	if err := <-walkErr; err != nil {
+		return result, err
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// walk sends every candidate file to jobs in walk order
+func (s *contentSearch) walk(ctx context.Context, jobs chan<- searchJob) error {
+	info, err := os.Stat(s.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		jobs <- searchJob{path: s.root, rel: filepath.Base(s.root)}
+		return nil
+	}
+
+	seq := 0
+	opts := fsutil.WalkOptions{NoIgnore: s.noIgnore}
+	if !s.recursive {
+		opts.MaxDepth = 1
+	}
+	return fsutil.Walk(s.root, opts, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path != s.root && !s.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			rel = path
+		}
+		rel = filepath.ToSlash(rel)
+		if len(s.includes) > 0 && !matchesAny(s.includes, rel) {
+			return nil
+		}
+		if matchesAny(s.excludes, rel) {
+			return nil
+		}
+
+		select {
+		case jobs <- searchJob{seq: seq, path: path, rel: rel}:
+			seq++
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	})
+}
+
+// matchBlock is a match whose trailing context is still being collected
+type matchBlock struct {
+	b         strings.Builder
+	remaining int
+}
+
+// scanFile streams a file line by line, formatting each match with its context
+func (s *contentSearch) scanFile(ctx context.Context, job searchJob, countOnly bool) fileResult {
+	res := fileResult{seq: job.seq}
+
+	f, err := os.Open(job.path)
+	if err != nil {
+		return res // Skip files that can't be read
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	if head, _ := reader.Peek(8000); fsutil.LooksBinary(head) {
+		return res
+	}
+	res.scanned = true
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+
+	// Preceding lines for leading context, reusing their buffers
+	before := make([][]byte, 0, s.contextLines)
+	var spare []byte
+	var open []*matchBlock
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		if lineNum%4096 == 0 && ctx.Err() != nil {
+			break
+		}
+		line := scanner.Bytes()
+		matched := s.re.Match(line)
+		if countOnly {
+			if matched {
+				res.count++
+			}
+			continue
+		}
+
+		// Feed trailing context to blocks still waiting for it
+		for _, blk := range open {
+			if blk.remaining > 0 {
+				fmt.Fprintf(&blk.b, "  %d: %s\n", lineNum, truncateLine(line))
+				blk.remaining--
+			}
+		}
+		for len(open) > 0 && open[0].remaining == 0 {
+			open[0].b.WriteString("\n")
+			res.blocks = append(res.blocks, open[0].b.String())
+			open = open[1:]
+		}
+
+		if matched {
+			res.count++
+			blk := &matchBlock{remaining: s.contextLines}
+			fmt.Fprintf(&blk.b, "%s:%d\n", job.rel, lineNum)
+			for i, prev := range before {
+				fmt.Fprintf(&blk.b, "  %d: %s\n", lineNum-len(before)+i, truncateLine(prev))
+			}
+			fmt.Fprintf(&blk.b, "▶ %d: %s\n", lineNum, truncateLine(line))
+			open = append(open, blk)
+		}
+
+		if s.contextLines > 0 {
+			if len(before) == s.contextLines {
+				spare = before[0]
+				copy(before, before[1:])
+				before = before[:len(before)-1]
+			}
+			before = append(before, append(spare[:0], line...))
+			spare = nil
+		}
+	}
+
+	for _, blk := range open {
+		blk.b.WriteString("\n")
+		res.blocks = append(res.blocks, blk.b.String())
+	}
+	return res
+}
+
+// truncateLine shortens very long lines for display
+func truncateLine(line []byte) string {
+	if len(line) <= maxDisplayLineLength {
+		return string(line)
+	}
+	cut := maxDisplayLineLength
+	for cut > 0 && !isRuneStart(line[cut]) {
+		cut--
+	}
+	return string(line[:cut]) + fmt.Sprintf(" … (%d more bytes)", len(line)-cut)
+}
+
+// isRuneStart reports whether b begins a UTF-8 sequence
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// summary describes how much of the result set was shown and what was omitted
+func (r *contentSearchResult) summary(offset int) string {
+	omitted := r.total - offset - r.shown
+	if offset > r.total {
+		omitted = 0
+	}
+	if omitted <= 0 && offset == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	if r.shown == 0 {
+		fmt.Fprintf(&b, "\nOffset %d is past the last of %d matches.\n", offset, r.total)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "\nShowing matches %d-%d of %d", offset+1, offset+r.shown, r.total)
+	if omitted > 0 {
+		fmt.Fprintf(&b, " (%d omitted", omitted)
+		if r.bytesLimited {
+			b.WriteString(", output size limit reached")
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(".")
+	if omitted > 0 {
+		fmt.Fprintf(&b, " Use offset=%d to see more, or narrow the search with include/exclude.", offset+r.shown)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
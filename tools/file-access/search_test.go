@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// buildSyntheticTree creates dirs*filesPerDir source files of linesPerFile
+// lines each, with a match roughly every 50 lines, plus ignored and binary
+// files the search must skip
+func buildSyntheticTree(b *testing.B, dirs, filesPerDir, linesPerFile int) string {
+	b.Helper()
+	root := b.TempDir()
+
+	var content strings.Builder
+	for i := 0; i < linesPerFile; i++ {
+		if i%50 == 0 {
+			fmt.Fprintf(&content, "\t// TODO: handle case %d\n", i)
+		} else {
+			fmt.Fprintf(&content, "\tvalue%d := compute(%d, \"filler text for the synthetic tree\")\n", i, i)
+		}
+	}
+	data := []byte(content.String())
+
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%03d", d))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < filesPerDir; f++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.go", f)), data, 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, "blob.bin"), append([]byte{0, 1, 2}, data...), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	ignored := filepath.Join(root, "node_modules", "dep")
+	if err := os.MkdirAll(ignored, 0755); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ignored, "index.js"), data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	return root
+}
+
+func BenchmarkContentSearch(b *testing.B) {
+	root := buildSyntheticTree(b, 100, 50, 400)
+	re := regexp.MustCompile(`TODO: handle case \d+`)
+
+	for _, workers := range []int{1, 0} {
+		name := fmt.Sprintf("workers=%d", workers)
+		if workers == 0 {
+			name = "workers=NumCPU"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				search := &contentSearch{
+					root:         root,
+					recursive:    true,
+					re:           re,
+					contextLines: 2,
+					maxMatches:   100,
+					maxBytes:     50000,
+					workers:      workers,
+				}
+				result, err := search.run(context.Background())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if result.filesScanned != 100*50 {
+					b.Fatalf("scanned %d files, want %d", result.filesScanned, 100*50)
+				}
+				if result.shown != 100 || result.total != 100*50*8 {
+					b.Fatalf("shown %d of %d matches", result.shown, result.total)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// toolSchemaIndex maps tool names to the parameter schemas sent to the model
+func toolSchemaIndex(tools []openai.ChatCompletionToolUnionParam) map[string]map[string]any {
+	schemas := make(map[string]map[string]any, len(tools))
+	for _, tool := range tools {
+		if fn := tool.OfFunction; fn != nil {
+			if _, taken := schemas[fn.Function.Name]; !taken {
+				schemas[fn.Function.Name] = fn.Function.Parameters
+			}
+		}
+	}
+	return schemas
+}
+
+// parseToolArguments decodes a tool call's arguments and checks them against
+// the tool's cached schema. The returned error is written for the model, so
+// it can correct the call.
+func (a *SimpleAgent) parseToolArguments(name, raw string) (map[string]any, error) {
+	schema, known := a.toolSchemas[name]
+	if !known {
+		return nil, fmt.Errorf("unknown tool %q; available tools: %s", name, strings.Join(a.toolNames(), ", "))
+	}
+
+	args := map[string]any{}
+	if strings.TrimSpace(raw) != "" {
+		var decoded any
+		if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+			return nil, fmt.Errorf("arguments are not valid JSON (%v); send a single JSON object", err)
+		}
+		obj, ok := decoded.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("arguments must be a JSON object, got %s", jsonTypeOf(decoded))
+		}
+		args = obj
+	}
+
+	var problems []string
+	validateValue(schema, args, "", &problems)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid arguments:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return args, nil
+}
+
+// toolNames lists the cached tool names in sorted order
+func (a *SimpleAgent) toolNames() []string {
+	names := make([]string, 0, len(a.toolSchemas))
+	for name := range a.toolSchemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateValue checks a decoded JSON value against the subset of JSON Schema
+// tool servers use: type, enum, required, properties, additionalProperties
+// and items. Problems are appended with their path.
+func validateValue(schema map[string]any, value any, path string, problems *[]string) {
+	if schema == nil {
+		return
+	}
+	label := path
+	if label == "" {
+		label = "arguments"
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		actual := jsonTypeOf(value)
+		matched := false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", label, strings.Join(types, " or "), actual))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		found := false
+		for _, allowed := range enum {
+			if jsonEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			options := make([]string, len(enum))
+			for i, e := range enum {
+				b, _ := json.Marshal(e)
+				options[i] = string(b)
+			}
+			*problems = append(*problems, fmt.Sprintf("%s: must be one of %s", label, strings.Join(options, ", ")))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, req := range schemaStrings(schema["required"]) {
+			if _, ok := v[req]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required field %q", label, joinPath(path, req)))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propSchema, ok := props[key].(map[string]any); ok {
+				validateValue(propSchema, v[key], joinPath(path, key), problems)
+			} else if extra, ok := schema["additionalProperties"]; ok && extra == false {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown field %q", label, joinPath(path, key)))
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", label, i), problems)
+			}
+		}
+	}
+}
+
+// schemaTypes returns a schema's "type", which may be a string or a list
+func schemaTypes(t any) []string {
+	switch v := t.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		return schemaStrings(v)
+	}
+	return nil
+}
+
+// schemaStrings returns the strings of a decoded JSON array
+func schemaStrings(v any) []string {
+	var out []string
+	switch list := v.(type) {
+	case []any:
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+	case []string:
+		out = list
+	}
+	return out
+}
+
+// jsonTypeOf names the JSON Schema type of a decoded value
+func jsonTypeOf(v any) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual compares two decoded JSON values
+func jsonEqual(a, b any) bool {
+	ab, errA := json.Marshal(a)
+	bb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ab) == string(bb)
+}
+
+// joinPath appends a field name to a dotted argument path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
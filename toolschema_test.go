@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestJSONTypeOf(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{nil, "null"},
+		{true, "boolean"},
+		{float64(3), "integer"},
+		{float64(-0), "integer"},
+		{3.5, "number"},
+		{math.Inf(1), "number"},
+		{"3", "string"},
+		{[]any{}, "array"},
+		{map[string]any{}, "object"},
+		{int64(3), "int64"},
+	}
+
+	for _, tt := range tests {
+		if got := jsonTypeOf(tt.value); got != tt.want {
+			t.Errorf("jsonTypeOf(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	const fileSchema = `{
+		"type": "object",
+		"properties": {
+			"path":  {"type": "string"},
+			"mode":  {"type": "string", "enum": ["read", "write"]},
+			"limit": {"type": "integer"},
+			"ratio": {"type": "number"},
+			"lines": {"type": "array", "items": {"type": "integer"}},
+			"range": {
+				"type": "object",
+				"properties": {"start": {"type": "integer"}},
+				"required": ["start"],
+				"additionalProperties": false
+			}
+		},
+		"required": ["path"],
+		"additionalProperties": false
+	}`
+
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   []string
+	}{
+		{
+			name:   "valid",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "mode": "read", "limit": 10, "ratio": 0.5, "lines": [1, 2], "range": {"start": 3}}`,
+		},
+		{
+			name:   "wrong type",
+			schema: fileSchema,
+			value:  `{"path": 7}`,
+			want:   []string{`path: expected string, got integer`},
+		},
+		{
+			name:   "not an object",
+			schema: fileSchema,
+			value:  `"a.go"`,
+			want:   []string{`arguments: expected object, got string`},
+		},
+		{
+			name:   "type list",
+			schema: `{"type": ["string", "null"]}`,
+			value:  `null`,
+		},
+		{
+			name:   "type list mismatch",
+			schema: `{"type": ["string", "null"]}`,
+			value:  `false`,
+			want:   []string{`arguments: expected string or null, got boolean`},
+		},
+		{
+			name:   "enum",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "mode": "append"}`,
+			want:   []string{`mode: must be one of "read", "write"`},
+		},
+		{
+			name:   "enum of numbers",
+			schema: `{"enum": [1, 2]}`,
+			value:  `2`,
+		},
+		{
+			name:   "missing required field",
+			schema: fileSchema,
+			value:  `{"mode": "read"}`,
+			want:   []string{`arguments: missing required field "path"`},
+		},
+		{
+			name:   "missing nested required field",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "range": {}}`,
+			want:   []string{`range: missing required field "range.start"`},
+		},
+		{
+			name:   "unknown field",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "recursive": true}`,
+			want:   []string{`arguments: unknown field "recursive"`},
+		},
+		{
+			name:   "unknown nested field",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "range": {"start": 1, "end": 2}}`,
+			want:   []string{`range: unknown field "range.end"`},
+		},
+		{
+			name:   "additional properties allowed",
+			schema: `{"type": "object", "properties": {"path": {"type": "string"}}}`,
+			value:  `{"path": "a.go", "recursive": true}`,
+		},
+		{
+			name:   "array items",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "lines": [1, "two", 3.5]}`,
+			want: []string{
+				`lines[1]: expected integer, got string`,
+				`lines[2]: expected integer, got number`,
+			},
+		},
+		{
+			name:   "integer where a number is expected",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "ratio": 2}`,
+		},
+		{
+			name:   "number where an integer is expected",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "limit": 2.5}`,
+			want:   []string{`limit: expected integer, got number`},
+		},
+		{
+			name:   "whole number as an integer",
+			schema: fileSchema,
+			value:  `{"path": "a.go", "limit": 2.0}`,
+		},
+		{
+			name:   "problems in field order",
+			schema: fileSchema,
+			value:  `{"path": 1, "mode": "x", "limit": "y"}`,
+			want: []string{
+				`limit: expected integer, got string`,
+				`mode: must be one of "read", "write"`,
+				`path: expected string, got integer`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]any
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatalf("schema: %v", err)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("value: %v", err)
+			}
+
+			var problems []string
+			validateValue(schema, value, "", &problems)
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("validateValue() problems = %q, want %q", problems, tt.want)
+			}
+		})
+	}
+}
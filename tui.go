@@ -0,0 +1,1033 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"atomicgo.dev/keyboard"
+	"atomicgo.dev/keyboard/keys"
+	"github.com/mattn/go-runewidth"
+	"github.com/pterm/pterm"
+
+	"open-coder/engine"
+)
+
+// TUI layout and timing
+const (
+	// tuiTick is how often the screen checks for a resize and animates the spinner
+	tuiTick = 120 * time.Millisecond
+	// tuiResultLines is how many lines of a tool result an expanded node shows
+	tuiResultLines = 20
+	// tuiModalWidth is the widest a modal overlay gets
+	tuiModalWidth = 72
+)
+
+// tuiSpinnerFrames animate running tool calls and the status bar
+var tuiSpinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// errQuestionDismissed answers a question closed with Esc
+var errQuestionDismissed = errors.New("the user dismissed the question")
+
+// tuiEntryKind is what a transcript entry shows
+type tuiEntryKind int
+
+const (
+	entryUser      tuiEntryKind = iota // the user's message
+	entryAssistant                     // header of the assistant's turn
+	entryText                          // assistant text, streamed in
+	entryNotice                        // status message
+	entryTool                          // tool call node
+	entryTodos                         // the todo list after an update
+	entryInfo                          // muted detail, e.g. how long a turn took
+)
+
+// tuiEntry is one item of the transcript
+type tuiEntry struct {
+	kind  tuiEntryKind
+	text  string
+	level engine.NoticeLevel
+	when  time.Time
+	todos []todoItem
+
+	// Tool calls
+	id       string
+	name     string
+	label    string
+	args     map[string]any
+	status   string // "pending", "queued", "running", "done" or "failed"
+	result   string
+	err      error
+	duration time.Duration
+	expanded bool
+}
+
+// tuiModal is an overlay that takes the keyboard: a question from the turn
+// or the settings
+type tuiModal struct {
+	question *engine.Question
+	options  []string
+	cursor   int
+	typing   bool // entering a free-form answer
+	text     []rune
+	settings bool
+	err      string
+}
+
+// tui is the full-screen front end: a scrollable transcript with a tree of
+// tool calls, an input box that grows with its content, a status bar, and
+// overlays for questions and settings. Turns run in the background and
+// report to it through Handle.
+type tui struct {
+	agent *SimpleAgent
+
+	mu        sync.Mutex
+	entries   []*tuiEntry
+	tools     map[string]*tuiEntry // tool call ID -> node, for the current turn
+	text      *tuiEntry            // assistant text being streamed
+	selected  *tuiEntry            // tool node picked with Ctrl+P/Ctrl+N
+	expandAll bool
+
+	input     []rune
+	cursor    int
+	inputRows int // input height chosen with Ctrl+Up/Down
+	scroll    int // transcript lines scrolled up from the bottom
+	page      int // transcript height at the last draw
+
+	busy    bool
+	cancel  context.CancelFunc // stops the running turn
+	started time.Time
+	tokens  int64
+	frame   int
+
+	modal         *tuiModal
+	width, height int
+
+	dirty chan struct{}
+}
+
+// RunTUI shows the full-screen interface until the user quits
+func (a *SimpleAgent) RunTUI() error {
+	if !stdinIsTerminal() {
+		return errors.New("the TUI needs an interactive terminal")
+	}
+
+	t := &tui{
+		agent:     a,
+		tools:     make(map[string]*tuiEntry),
+		inputRows: 1,
+		dirty:     make(chan struct{}, 1),
+	}
+	t.width, t.height = pterm.GetTerminalWidth(), pterm.GetTerminalHeight()
+	t.add(&tuiEntry{kind: entryNotice, text: "Enter sends · Ctrl+J new line · PgUp/PgDn scroll · Ctrl+T expand tool calls · Ctrl+S settings · Ctrl+C quit"})
+
+	// Anything printed the usual way would draw over the screen
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l") // alternate screen, hidden cursor
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+
+	done := make(chan struct{})
+	var drawing sync.WaitGroup
+	drawing.Add(1)
+	go func() {
+		defer drawing.Done()
+		t.drawLoop(done)
+	}()
+
+	err := keyboard.Listen(t.key)
+	close(done)
+	drawing.Wait()
+	if err != nil {
+		return fmt.Errorf("failed to read keys: %w", err)
+	}
+	return nil
+}
+
+// drawLoop redraws the screen when something changed, when the terminal was
+// resized, and to animate the spinner while a turn runs
+func (t *tui) drawLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(tuiTick)
+	defer ticker.Stop()
+
+	t.draw()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.dirty:
+			t.draw()
+		case <-ticker.C:
+			t.mu.Lock()
+			w, h := pterm.GetTerminalWidth(), pterm.GetTerminalHeight()
+			changed := w != t.width || h != t.height || t.busy
+			t.width, t.height = w, h
+			if t.busy {
+				t.frame++
+			}
+			t.mu.Unlock()
+			if changed {
+				t.draw()
+			}
+		}
+	}
+}
+
+// redraw asks the draw loop for a new frame
+func (t *tui) redraw() {
+	select {
+	case t.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// draw writes a whole frame
+func (t *tui) draw() {
+	t.mu.Lock()
+	frame := t.render()
+	t.mu.Unlock()
+	os.Stdout.WriteString(frame)
+}
+
+// add appends an entry to the transcript and follows the bottom
+func (t *tui) add(e *tuiEntry) *tuiEntry {
+	if e.when.IsZero() {
+		e.when = time.Now()
+	}
+	t.entries = append(t.entries, e)
+	return e
+}
+
+// Handle records an event of the running turn
+func (t *tui) Handle(ev engine.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.redraw()
+
+	switch ev := ev.(type) {
+	case engine.TurnStarted:
+		t.tools = make(map[string]*tuiEntry)
+		t.add(&tuiEntry{kind: entryAssistant})
+
+	case engine.ResponseStarted, engine.ResponseFinished:
+		t.text = nil
+
+	case engine.TextDelta:
+		if t.text == nil {
+			t.text = t.add(&tuiEntry{kind: entryText})
+		}
+		t.text.text += ev.Text
+
+	case engine.Usage:
+		t.tokens += ev.TotalTokens
+
+	case engine.Notice:
+		t.add(&tuiEntry{kind: entryNotice, level: ev.Level, text: strings.TrimLeft(ev.Text, "\n")})
+
+	case engine.ToolCallInvalid:
+		t.add(&tuiEntry{kind: entryTool, id: ev.ID, name: ev.Name, label: ev.Name, status: "failed", err: ev.Err, expanded: t.expandAll})
+
+	case engine.ToolCallStarted:
+		t.tools[ev.ID] = t.add(&tuiEntry{
+			kind:     entryTool,
+			id:       ev.ID,
+			name:     ev.Name,
+			label:    engine.ToolCallLabel(ev.Name, ev.Args),
+			args:     ev.Args,
+			status:   "pending",
+			expanded: t.expandAll,
+		})
+
+	case engine.ToolBatchStarted:
+		for _, call := range ev.Calls {
+			if e := t.tools[call.ID]; e != nil {
+				e.status = "queued"
+			}
+		}
+
+	case engine.ToolCallRunning:
+		if e := t.tools[ev.ID]; e != nil {
+			e.status = "running"
+		}
+
+	case engine.ToolCallDone:
+		if e := t.tools[ev.ID]; e != nil {
+			e.status, e.err, e.duration = "done", ev.Err, ev.Duration
+			if ev.Err != nil {
+				e.status = "failed"
+			}
+		}
+
+	case engine.ToolCallResult:
+		e := t.tools[ev.ID]
+		if e == nil {
+			e = t.add(&tuiEntry{kind: entryTool, id: ev.ID, name: ev.Name, label: engine.ToolCallLabel(ev.Name, ev.Args), args: ev.Args, expanded: t.expandAll})
+		}
+		e.status, e.result, e.err, e.duration = "done", ev.Result, ev.Err, ev.Duration
+		if ev.Err != nil {
+			e.status = "failed"
+		}
+
+	case engine.TodosChanged:
+		t.add(&tuiEntry{kind: entryTodos, todos: ev.Items})
+
+	case engine.Error:
+		level, text := engine.NoticeError, fmt.Sprintf("Error: %v", ev.Err)
+		if errors.Is(ev.Err, context.Canceled) {
+			level, text = engine.NoticeWarning, "Turn stopped."
+		}
+		t.add(&tuiEntry{kind: entryNotice, level: level, text: text})
+
+	case engine.TurnFinished:
+		if t.agent.showTimestamps {
+			t.add(&tuiEntry{kind: entryInfo, text: "⏱  Turn took " + formatElapsed(ev.Elapsed)})
+		}
+
+	case engine.Question:
+		m := &tuiModal{question: &ev, options: ev.Options}
+		if ev.AllowText && len(ev.Options) > 0 {
+			m.options = append(append([]string{}, ev.Options...), otherAnswer)
+		}
+		m.typing = len(m.options) == 0
+		t.modal = m
+	}
+}
+
+// key handles a key press; it returns true to leave the TUI
+func (t *tui) key(k keys.Key) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.redraw()
+
+	if t.modal != nil {
+		t.modalKey(k)
+		return false, nil
+	}
+	switch k.Code {
+	case keys.CtrlC:
+		if !t.busy {
+			return true, nil
+		}
+		t.cancel()
+		t.add(&tuiEntry{kind: entryNotice, level: engine.NoticeWarning, text: "Stopping the turn..."})
+	case keys.CtrlD:
+		if len(t.input) == 0 {
+			return !t.busy, nil
+		}
+		t.deleteRunes(t.cursor, t.cursor+1)
+	case keys.Enter:
+		if k.AltPressed {
+			t.insert('\n')
+			break
+		}
+		return t.submit(), nil
+	case keys.CtrlJ:
+		t.insert('\n')
+	case keys.RuneKey:
+		t.insert(k.Runes...)
+	case keys.Space:
+		t.insert(' ')
+	case keys.Tab:
+		t.insert(' ', ' ', ' ', ' ')
+	case keys.Backspace, keys.CtrlH:
+		t.deleteRunes(t.cursor-1, t.cursor)
+	case keys.Delete:
+		t.deleteRunes(t.cursor, t.cursor+1)
+	case keys.CtrlW:
+		start := t.cursor
+		for start > 0 && t.input[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && t.input[start-1] != ' ' && t.input[start-1] != '\n' {
+			start--
+		}
+		t.deleteRunes(start, t.cursor)
+	case keys.CtrlU:
+		t.input, t.cursor = nil, 0
+	case keys.Left:
+		t.cursor = max(0, t.cursor-1)
+	case keys.Right:
+		t.cursor = min(len(t.input), t.cursor+1)
+	case keys.Home, keys.CtrlA:
+		t.cursor = 0
+	case keys.End, keys.CtrlE:
+		t.cursor = len(t.input)
+	case keys.Up:
+		t.scroll++
+	case keys.Down:
+		t.scroll = max(0, t.scroll-1)
+	case keys.PgUp:
+		t.scroll += max(1, t.page-1)
+	case keys.PgDown:
+		t.scroll = max(0, t.scroll-max(1, t.page-1))
+	case keys.CtrlL:
+		t.scroll = 0
+	case keys.CtrlUp:
+		t.inputRows = min(t.inputRows+1, max(1, t.height/2))
+	case keys.CtrlDown:
+		t.inputRows = max(1, t.inputRows-1)
+	case keys.CtrlT:
+		t.expandAll = !t.expandAll
+		for _, e := range t.entries {
+			e.expanded = t.expandAll
+		}
+	case keys.CtrlP:
+		t.selectTool(-1)
+	case keys.CtrlN:
+		t.selectTool(1)
+	case keys.CtrlO:
+		if e := t.selected; e != nil {
+			e.expanded = !e.expanded
+		} else if e := t.lastTool(); e != nil {
+			e.expanded = !e.expanded
+		}
+	case keys.Esc:
+		t.selected = nil
+	case keys.CtrlS:
+		t.modal = &tuiModal{settings: true}
+	}
+	return false, nil
+}
+
+// insert types runes at the cursor
+func (t *tui) insert(runes ...rune) {
+	var clean []rune
+	for _, r := range runes {
+		if r == '\r' {
+			r = '\n' // pasted line breaks
+		}
+		clean = append(clean, r)
+	}
+	t.input = append(t.input[:t.cursor], append(clean, t.input[t.cursor:]...)...)
+	t.cursor += len(clean)
+}
+
+// deleteRunes removes input[from:to], clamped to the input
+func (t *tui) deleteRunes(from, to int) {
+	from, to = max(0, from), min(len(t.input), to)
+	if from >= to {
+		return
+	}
+	t.input = append(t.input[:from], t.input[to:]...)
+	t.cursor = from
+}
+
+// submit handles the typed message: a command, or a new turn in the
+// background. It returns true to leave the TUI.
+func (t *tui) submit() bool {
+	text := strings.TrimSpace(string(t.input))
+	if text == "" {
+		return false
+	}
+	lower := strings.ToLower(text)
+	notice := func(level engine.NoticeLevel, msg string) {
+		t.add(&tuiEntry{kind: entryNotice, level: level, text: msg})
+	}
+
+	switch {
+	case lower == "exit" || lower == "quit" || lower == "bye":
+		if !t.busy {
+			return true
+		}
+		notice(engine.NoticeWarning, "A turn is still running; press Ctrl+C to stop it first")
+		return false
+	case lower == "/settings":
+		t.input, t.cursor = nil, 0
+		t.modal = &tuiModal{settings: true}
+		return false
+	case lower == "/plan" || strings.HasPrefix(lower, "/plan "):
+		notice(engine.NoticeWarning, "/plan is only available in the plain interface (run without --tui)")
+		return false
+	case bareMention.MatchString(text):
+		notice(engine.NoticeWarning, "The file browser is not available here; type @path to attach a file")
+		return false
+	case t.busy:
+		notice(engine.NoticeWarning, "Wait for the current turn to finish")
+		return false
+	}
+
+	t.input, t.cursor, t.scroll = nil, 0, 0
+	t.selected = nil
+	t.add(&tuiEntry{kind: entryUser, text: text})
+	ctx, cancel := context.WithCancel(t.agent.ctx)
+	t.busy, t.cancel, t.started = true, cancel, time.Now()
+	go t.run(ctx, text)
+	return false
+}
+
+// run processes one message in the background, showing its events
+func (t *tui) run(ctx context.Context, text string) {
+	for ev := range t.agent.Run(ctx, text) {
+		t.Handle(ev)
+	}
+
+	t.mu.Lock()
+	if t.modal != nil && t.modal.question != nil {
+		t.modal = nil // the turn no longer waits for an answer
+	}
+	t.busy = false
+	t.cancel()
+	t.mu.Unlock()
+	t.redraw()
+}
+
+// selectTool moves the selection to the previous or next tool node
+func (t *tui) selectTool(delta int) {
+	var nodes []*tuiEntry
+	current := -1
+	for _, e := range t.entries {
+		if e.kind == entryTool {
+			if e == t.selected {
+				current = len(nodes)
+			}
+			nodes = append(nodes, e)
+		}
+	}
+	if len(nodes) == 0 {
+		return
+	}
+	if current < 0 {
+		current = len(nodes) // start from the most recent
+	}
+	t.selected = nodes[max(0, min(len(nodes)-1, current+delta))]
+}
+
+// lastTool returns the most recent tool node
+func (t *tui) lastTool() *tuiEntry {
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		if t.entries[i].kind == entryTool {
+			return t.entries[i]
+		}
+	}
+	return nil
+}
+
+// modalKey handles a key while an overlay is open
+func (t *tui) modalKey(k keys.Key) {
+	m := t.modal
+	if m.settings {
+		t.settingsKey(k)
+		return
+	}
+
+	q := m.question
+	if m.typing {
+		switch k.Code {
+		case keys.Enter:
+			q.Answer(engine.Reply{Choice: -1, Text: strings.TrimSpace(string(m.text))})
+			t.modal = nil
+		case keys.Esc, keys.CtrlC:
+			if len(m.options) > 0 {
+				m.typing = false // back to the options
+				return
+			}
+			q.Answer(engine.Reply{Choice: -1, Err: errQuestionDismissed})
+			t.modal = nil
+		case keys.RuneKey:
+			m.text = append(m.text, k.Runes...)
+		case keys.Space:
+			m.text = append(m.text, ' ')
+		case keys.Backspace, keys.CtrlH:
+			if len(m.text) > 0 {
+				m.text = m.text[:len(m.text)-1]
+			}
+		case keys.CtrlU:
+			m.text = nil
+		}
+		return
+	}
+
+	switch k.Code {
+	case keys.Up, keys.CtrlP:
+		m.cursor = max(0, m.cursor-1)
+	case keys.Down, keys.CtrlN, keys.Tab:
+		m.cursor = min(len(m.options)-1, m.cursor+1)
+	case keys.Enter:
+		if m.cursor < len(q.Options) {
+			q.Answer(engine.Reply{Choice: m.cursor, Text: q.Options[m.cursor]})
+			t.modal = nil
+			return
+		}
+		m.typing = true
+	case keys.Esc, keys.CtrlC:
+		q.Answer(engine.Reply{Choice: -1, Err: errQuestionDismissed})
+		t.modal = nil
+	}
+}
+
+// settingsItems labels the settings that can be changed from the overlay
+func (t *tui) settingsItems() []string {
+	a := t.agent
+	onOff := func(on bool) string {
+		if on {
+			return "on"
+		}
+		return "off"
+	}
+	theme := a.theme
+	if theme == "" {
+		theme = defaultThemeName
+	}
+	return []string{
+		"Theme: ‹ " + theme + " ›",
+		"Compact mode: " + onOff(a.compactMode),
+		"Show timestamps: " + onOff(a.showTimestamps),
+		"Show hidden files: " + onOff(a.showHidden),
+		"Auto-save chat: " + onOff(a.autoSaveChat),
+	}
+}
+
+// settingsKey changes a setting and saves the preferences. Settings stay as
+// they are while a turn runs, since its output reads them.
+func (t *tui) settingsKey(k keys.Key) {
+	a := t.agent
+	m := t.modal
+	step := 1
+	switch k.Code {
+	case keys.Up, keys.CtrlP:
+		m.cursor = max(0, m.cursor-1)
+		return
+	case keys.Down, keys.CtrlN, keys.Tab:
+		m.cursor = min(len(t.settingsItems())-1, m.cursor+1)
+		return
+	case keys.Esc, keys.CtrlC, keys.CtrlS:
+		t.modal = nil
+		return
+	case keys.Left:
+		step = -1
+	case keys.Right, keys.Enter, keys.Space:
+	default:
+		return
+	}
+
+	if t.busy {
+		m.err = "Settings can be changed once the current turn finishes"
+		return
+	}
+	m.err = ""
+	switch m.cursor {
+	case 0:
+		names := themeNames()
+		current := 0
+		for i, name := range names {
+			if name == a.theme {
+				current = i
+			}
+		}
+		if err := a.applyTheme(names[(current+step+len(names))%len(names)]); err != nil {
+			m.err = err.Error()
+			return
+		}
+	case 1:
+		a.compactMode = !a.compactMode
+	case 2:
+		a.showTimestamps = !a.showTimestamps
+	case 3:
+		a.showHidden = !a.showHidden
+	case 4:
+		a.autoSaveChat = !a.autoSaveChat
+	}
+	if err := a.savePreferences(); err != nil {
+		m.err = fmt.Sprintf("Could not save preferences: %v", err)
+	}
+}
+
+// render builds a whole frame: transcript, input box and status bar, with
+// the overlay on top
+func (t *tui) render() string {
+	w, h := max(t.width, 20), max(t.height, 6)
+
+	input, cursorRow := t.inputLines(w - 2)
+	rows := min(max(t.inputRows, len(input)), max(1, h/2))
+	top := max(0, min(cursorRow-rows+1, len(input)-rows)) // keep the cursor in view
+	input = input[top:min(len(input), top+rows)]
+	for len(input) < rows {
+		input = append(input, "")
+	}
+
+	page := h - rows - 2 // the border above the input and the status bar
+	t.page = page
+	lines := t.transcript(w)
+	t.scroll = max(0, min(t.scroll, len(lines)-page))
+	end := len(lines) - t.scroll
+	view := lines[max(0, end-page):end]
+
+	screen := make([]string, 0, h)
+	screen = append(screen, view...)
+	for len(screen) < page {
+		screen = append(screen, "")
+	}
+	if t.modal != nil {
+		t.overlay(screen, w)
+	}
+	screen = append(screen, t.border(w))
+	for i, line := range input {
+		prefix := "  "
+		if top+i == 0 {
+			prefix = t.agent.getUserColorStyle().Sprint("▸ ")
+		}
+		screen = append(screen, prefix+line)
+	}
+	screen = append(screen, t.statusBar(w))
+
+	var b strings.Builder
+	for i, line := range screen {
+		fmt.Fprintf(&b, "\x1b[%d;1H\x1b[0m%s\x1b[0m\x1b[K", i+1, line)
+	}
+	return b.String()
+}
+
+// inputLines wraps the input to width cells, drawing the cursor, and returns
+// the row the cursor is on
+func (t *tui) inputLines(width int) ([]string, int) {
+	width = max(width, 1)
+	var lines []string
+	var line strings.Builder
+	col, cursorRow := 0, 0
+	flush := func() {
+		lines = append(lines, line.String())
+		line.Reset()
+		col = 0
+	}
+	for i := 0; i <= len(t.input); i++ {
+		if i == len(t.input) {
+			if i == t.cursor {
+				cursorRow = len(lines)
+				line.WriteString("\x1b[7m \x1b[27m")
+			}
+			break
+		}
+		r := t.input[i]
+		rw := runewidth.RuneWidth(r)
+		if r != '\n' && col+rw > width {
+			flush()
+		}
+		if i == t.cursor {
+			cursorRow = len(lines)
+			shown := string(r)
+			if r == '\n' {
+				shown = " "
+			}
+			line.WriteString("\x1b[7m" + shown + "\x1b[27m")
+		} else if r != '\n' {
+			line.WriteRune(r)
+		}
+		if r == '\n' {
+			flush()
+			continue
+		}
+		col += rw
+	}
+	flush()
+	return lines, cursorRow
+}
+
+// border is the line above the input box, with key hints
+func (t *tui) border(w int) string {
+	hint := " Enter send · Ctrl+J newline · Ctrl+↑/↓ resize · Ctrl+T/Ctrl+O tools · Ctrl+S settings "
+	if t.scroll > 0 {
+		hint = fmt.Sprintf(" ↑ %d lines up · Ctrl+L to follow ·%s", t.scroll, hint)
+	}
+	return ui.muted.Sprint(fitWidth("──"+hint+strings.Repeat("─", w), w))
+}
+
+// statusBar shows the model, tokens used, servers, directory and activity
+func (t *tui) statusBar(w int) string {
+	a := t.agent
+	cwd, _ := os.Getwd()
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		if rel, err := filepath.Rel(home, cwd); err == nil && !strings.HasPrefix(rel, "..") {
+			cwd = filepath.Join("~", rel)
+		}
+	}
+
+	state := "ready"
+	if t.busy {
+		state = fmt.Sprintf("%s working %s", tuiSpinnerFrames[t.frame%len(tuiSpinnerFrames)], formatElapsed(time.Since(t.started).Round(time.Second)))
+	}
+	left := fmt.Sprintf(" %s │ %d tokens │ %d servers │ %s", a.model, t.tokens, len(a.servers), cwd)
+	right := state + " "
+	gap := w - runewidth.StringWidth(left) - runewidth.StringWidth(right)
+	if gap < 1 {
+		return ui.header.Sprint(fitWidth(left, w))
+	}
+	return ui.header.Sprint(left + strings.Repeat(" ", gap) + right)
+}
+
+// transcript renders every entry into lines at most w cells wide
+func (t *tui) transcript(w int) []string {
+	a := t.agent
+	var out []string
+	add := func(style Style, indent, text string) {
+		for _, line := range wrapText(text, w-runewidth.StringWidth(indent)) {
+			out = append(out, indent+style.Sprint(line))
+		}
+	}
+	gap := func() {
+		if !a.compactMode && len(out) > 0 {
+			out = append(out, "")
+		}
+	}
+	stamp := func(e *tuiEntry) string {
+		if !a.showTimestamps {
+			return ""
+		}
+		return ui.muted.Sprint(e.when.Format("15:04:05")) + " "
+	}
+
+	for i, e := range t.entries {
+		switch e.kind {
+		case entryUser:
+			gap()
+			out = append(out, stamp(e)+a.getUserColorStyle().Sprint("You ▸"))
+			add(ui.text, "  ", e.text)
+		case entryAssistant:
+			gap()
+			out = append(out, stamp(e)+a.getAssistantColorStyle().Sprint("Assistant ▸"))
+		case entryText:
+			out = append(out, t.markdownLines(e.text, w)...)
+		case entryNotice:
+			style := a.getSystemColorStyle()
+			switch e.level {
+			case engine.NoticeWarning:
+				style = ui.warning
+			case engine.NoticeError:
+				style = a.getErrorColorStyle()
+			}
+			add(style, "  ", e.text)
+		case entryTool:
+			last := i == len(t.entries)-1 || t.entries[i+1].kind != entryTool
+			out = append(out, t.toolLines(e, last, w)...)
+		case entryTodos:
+			out = append(out, "  "+ui.title.Sprint("📋 Todos"))
+			for _, item := range e.todos {
+				mark, style := "○", ui.text
+				switch item.Status {
+				case "completed":
+					mark, style = "✓", ui.success
+				case "in_progress":
+					mark, style = "▶", ui.accent
+				}
+				add(style, "    ", mark+" "+item.Content)
+			}
+		case entryInfo:
+			add(ui.muted, "  ", e.text)
+		}
+	}
+	return out
+}
+
+// toolLines renders a tool call node of the tree and, when expanded, its
+// arguments and result
+func (t *tui) toolLines(e *tuiEntry, last bool, w int) []string {
+	a := t.agent
+	branch, stem := "├─", "│ "
+	if last {
+		branch, stem = "└─", "  "
+	}
+	fold := "▸"
+	if e.expanded {
+		fold = "▾"
+	}
+
+	icon, style := "○", a.getToolColorStyle()
+	switch e.status {
+	case "queued":
+		icon = "…"
+	case "running":
+		icon = tuiSpinnerFrames[t.frame%len(tuiSpinnerFrames)]
+	case "done":
+		icon, style = "✓", ui.success
+	case "failed":
+		icon, style = "✗", a.getErrorColorStyle()
+	}
+	head := fmt.Sprintf("%s %s %s", fold, icon, e.label)
+	if e.duration > 0 {
+		head += " (" + formatElapsed(e.duration) + ")"
+	}
+	if e == t.selected {
+		style = style.Bold().Underline()
+	}
+
+	border := a.getToolBorderStyle()
+	out := []string{"  " + border.Sprint(branch) + " " + style.Sprint(fitWidth(head, w-5))}
+	if !e.expanded {
+		return out
+	}
+
+	indent := "  " + border.Sprint(stem) + "   "
+	detail := func(style Style, text string) {
+		for _, line := range wrapText(text, w-7) {
+			out = append(out, indent+style.Sprint(line))
+		}
+	}
+	if len(e.args) > 0 {
+		args, _ := json.Marshal(e.args)
+		detail(ui.muted, "args: "+string(args))
+	}
+	switch {
+	case e.err != nil:
+		detail(a.getErrorColorStyle(), "error: "+e.err.Error())
+	case e.result != "":
+		lines := strings.Split(strings.TrimRight(e.result, "\n"), "\n")
+		paint := func(line string) string { return a.getSystemColorStyle().Sprint(line) }
+		if isUnifiedDiff(e.result) {
+			paint = diffLine
+		}
+		for j, line := range lines {
+			if j == tuiResultLines {
+				detail(ui.muted, fmt.Sprintf("… %d more lines", len(lines)-j))
+				break
+			}
+			for _, piece := range wrapText(line, w-7) {
+				out = append(out, indent+paint(piece))
+			}
+		}
+	}
+	return out
+}
+
+// markdownLines styles assistant text line by line: headings, fenced code
+// and diffs stand out, the rest is shown as written
+func (t *tui) markdownLines(text string, w int) []string {
+	a := t.agent
+	var out []string
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if fence == "" {
+				fence = strings.TrimPrefix(trimmed, "```")
+				if fence == "" {
+					fence = "text"
+				}
+			} else {
+				fence = ""
+			}
+			out = append(out, "  "+ui.markdownBorder.Sprint(fitWidth(trimmed, w-2)))
+			continue
+		}
+
+		paint := func(s string) string { return a.getAssistantColorStyle().Sprint(s) }
+		switch {
+		case fence == "diff" || fence == "patch":
+			paint = diffLine
+		case fence != "":
+			paint = func(s string) string { return ui.codeText.Sprint(s) }
+		case strings.HasPrefix(trimmed, "#"):
+			line = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			paint = func(s string) string { return ui.markdownHeading.inherit(ui.text).Sprint(s) }
+		}
+		for _, piece := range wrapText(line, w-2) {
+			out = append(out, "  "+paint(piece))
+		}
+	}
+	return out
+}
+
+// overlay draws the open modal over the middle of the transcript
+func (t *tui) overlay(screen []string, w int) {
+	m := t.modal
+	inner := min(w-4, tuiModalWidth) - 4
+	if inner < 10 {
+		return
+	}
+
+	type row struct {
+		text  string
+		style Style
+	}
+	var rows []row
+	add := func(style Style, text string) {
+		for _, line := range wrapText(text, inner) {
+			rows = append(rows, row{line, style})
+		}
+	}
+
+	var hint string
+	if m.settings {
+		add(ui.title.Bold(), "Settings")
+		rows = append(rows, row{})
+		for i, item := range t.settingsItems() {
+			if i == m.cursor {
+				add(ui.accent.Bold(), "› "+item)
+			} else {
+				add(ui.text, "  "+item)
+			}
+		}
+		if m.err != "" {
+			rows = append(rows, row{})
+			add(ui.errorText, m.err)
+		}
+		hint = "↑/↓ choose · Enter/←/→ change · Esc close"
+	} else {
+		add(ui.accent.Bold(), m.question.Prompt)
+		rows = append(rows, row{})
+		if m.typing {
+			add(ui.text, "Answer: "+string(m.text)+"█")
+			hint = "Enter send · Esc back"
+		} else {
+			for i, option := range m.options {
+				if i == m.cursor {
+					add(ui.accent.Bold(), "› "+option)
+				} else {
+					add(ui.text, "  "+option)
+				}
+			}
+			hint = "↑/↓ choose · Enter confirm · Esc dismiss"
+		}
+	}
+	rows = append(rows, row{})
+	add(ui.muted, hint)
+
+	border := ui.toolBorder
+	box := []string{border.Sprint("╭" + strings.Repeat("─", inner+2) + "╮")}
+	for _, r := range rows {
+		pad := strings.Repeat(" ", max(0, inner-runewidth.StringWidth(r.text)))
+		box = append(box, border.Sprint("│ ")+r.style.Sprint(r.text)+pad+border.Sprint(" │"))
+	}
+	box = append(box, border.Sprint("╰"+strings.Repeat("─", inner+2)+"╯"))
+
+	left := strings.Repeat(" ", max(0, (w-inner-4)/2))
+	first := max(0, (len(screen)-len(box))/2)
+	for i, line := range box {
+		if first+i < len(screen) {
+			screen[first+i] = left + line
+		}
+	}
+}
+
+// wrapText breaks text into lines at most width cells wide, at spaces where
+// possible
+func wrapText(text string, width int) []string {
+	width = max(width, 1)
+	var out []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n") {
+		for runewidth.StringWidth(line) > width {
+			cut := runewidth.Truncate(line, width, "")
+			if cut == "" {
+				_, size := utf8.DecodeRuneInString(line)
+				cut = line[:size]
+			} else if i := strings.LastIndexByte(cut, ' '); i > 0 {
+				cut = cut[:i]
+			}
+			out = append(out, cut)
+			line = strings.TrimLeft(line[len(cut):], " ")
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// fitWidth cuts s to at most width cells
+func fitWidth(s string, width int) string {
+	return runewidth.Truncate(s, max(width, 0), "")
+}